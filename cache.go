@@ -0,0 +1,258 @@
+package pickem4me
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// defaultPredictionCacheTTL is how long predictions are cached unless PREDICTION_CACHE_TTL says otherwise.
+const defaultPredictionCacheTTL = 15 * time.Minute
+
+// predictions caches the predictions of models across invocations of a warm function instance.
+var predictions = newPredictionCache(predictionCacheTTLFromEnv(), "")
+
+// predictionCacheTTLFromEnv reads the cache TTL from PREDICTION_CACHE_TTL (a Go duration, where "0" disables the cache).
+func predictionCacheTTLFromEnv() time.Duration {
+	s := os.Getenv("PREDICTION_CACHE_TTL")
+	if s == "" {
+		return defaultPredictionCacheTTL
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		logger.Warnf("Bad PREDICTION_CACHE_TTL '%s': using %v", s, defaultPredictionCacheTTL)
+		return defaultPredictionCacheTTL
+	}
+	return ttl
+}
+
+// SetPredictionCache replaces the prediction cache with one that keeps predictions for the given TTL (zero disables caching).
+// If dir is not empty, predictions are also cached on disk in that directory so that they survive between runs of the CLI.
+func SetPredictionCache(ttl time.Duration, dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed making prediction cache directory '%s': %v", dir, err)
+		}
+	}
+	predictions = newPredictionCache(ttl, dir)
+	return nil
+}
+
+// cacheKey identifies the predictions of a model in a prediction tracker.
+type cacheKey struct {
+	tracker string
+	model   string
+}
+
+// cachedPredictions are the predictions of a model as they were read at a given time.
+type cachedPredictions struct {
+	trackerTime time.Time
+	loaded      time.Time
+	predictions []bpefs.Prediction
+	refs        []*firestore.DocumentRef
+}
+
+// predictionCache caches the predictions of models keyed by prediction tracker and model performance document.
+// Entries expire after a TTL, and are invalidated as soon as a newer prediction tracker is seen.
+// It is safe for concurrent use.
+type predictionCache struct {
+	ttl time.Duration
+	dir string
+
+	mu          sync.Mutex
+	entries     map[cacheKey]*cachedPredictions
+	trackerTime time.Time
+}
+
+func newPredictionCache(ttl time.Duration, dir string) *predictionCache {
+	return &predictionCache{
+		ttl:     ttl,
+		dir:     dir,
+		entries: make(map[cacheKey]*cachedPredictions),
+	}
+}
+
+// observeTracker records the timestamp of the latest prediction tracker, invalidating everything cached from older trackers.
+func (c *predictionCache) observeTracker(ctx context.Context, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !t.After(c.trackerTime) {
+		return
+	}
+	if !c.trackerTime.IsZero() {
+		logFrom(ctx).Infof("Newer prediction tracker seen (%v): invalidating cached predictions", t)
+	}
+	c.trackerTime = t
+	for key, e := range c.entries {
+		if e.trackerTime.Before(t) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// fresh reports whether an entry is neither expired nor from an outdated tracker.
+// The caller must hold the lock.
+func (c *predictionCache) fresh(e *cachedPredictions) bool {
+	return now().Sub(e.loaded) < c.ttl && !e.trackerTime.Before(c.trackerTime)
+}
+
+// get returns the predictions of the model performance document, reading them from Firestore if they are not cached.
+func (c *predictionCache) get(ctx context.Context, modelPerf *firestore.DocumentRef) ([]bpefs.Prediction, []*firestore.DocumentRef, error) {
+	key := cacheKey{tracker: refPath(modelPerf.Parent.Parent), model: refPath(modelPerf)}
+
+	if c.ttl > 0 {
+		c.mu.Lock()
+		cached := c.entries[key]
+		if cached == nil && c.dir != "" {
+			if cached = c.readDisk(ctx, key); cached != nil {
+				c.entries[key] = cached
+			}
+		}
+		if cached != nil && c.fresh(cached) {
+			c.mu.Unlock()
+			logFrom(ctx).Infof("Using %d cached predictions from model '%s'", len(cached.predictions), modelPerf.ID)
+			preds, refs := cached.copy()
+			return preds, refs, nil
+		}
+		c.mu.Unlock()
+	}
+
+	predictionDocs, err := modelPerf.Collection("predictions").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, nil, backendError(err, "failed getting predictions from model '%s'", modelPerf.ID)
+	}
+	e := &cachedPredictions{
+		loaded:      now(),
+		predictions: make([]bpefs.Prediction, len(predictionDocs)),
+		refs:        make([]*firestore.DocumentRef, len(predictionDocs)),
+	}
+	for i, doc := range predictionDocs {
+		e.refs[i] = doc.Ref
+		if err := doc.DataTo(&e.predictions[i]); err != nil {
+			return nil, nil, newError(KindInconsistent, "failed parsing prediction '%s': %v", doc.Ref.ID, err)
+		}
+	}
+
+	if c.ttl > 0 {
+		c.mu.Lock()
+		e.trackerTime = c.trackerTime
+		c.entries[key] = e
+		if c.dir != "" {
+			c.writeDisk(ctx, key, e)
+		}
+		c.mu.Unlock()
+	}
+	preds, refs := e.copy()
+	return preds, refs, nil
+}
+
+// copy returns copies of the cached predictions so that callers can modify them.
+func (e *cachedPredictions) copy() ([]bpefs.Prediction, []*firestore.DocumentRef) {
+	preds := make([]bpefs.Prediction, len(e.predictions))
+	copy(preds, e.predictions)
+	refs := make([]*firestore.DocumentRef, len(e.refs))
+	copy(refs, e.refs)
+	return preds, refs
+}
+
+// diskPredictions are cached predictions as stored on disk.
+// Document references are stored as paths and rebuilt when read.
+type diskPredictions struct {
+	Tracker     string           `json:"tracker"`
+	TrackerTime time.Time        `json:"trackerTime"`
+	Model       string           `json:"model"`
+	Loaded      time.Time        `json:"loaded"`
+	Predictions []diskPrediction `json:"predictions"`
+}
+
+// diskPrediction is a prediction as stored on disk.
+type diskPrediction struct {
+	Path    string  `json:"path"`
+	Home    string  `json:"home"`
+	Road    string  `json:"road"`
+	Neutral bool    `json:"neutral"`
+	Spread  float64 `json:"spread"`
+}
+
+// diskPath returns the path of the cache file for a key.
+func (c *predictionCache) diskPath(key cacheKey) string {
+	sum := sha1.Sum([]byte(key.tracker + "\x00" + key.model))
+	return filepath.Join(c.dir, "predictions-"+hex.EncodeToString(sum[:])+".json")
+}
+
+// readDisk reads an entry from disk, returning nil if there is no usable entry.
+func (c *predictionCache) readDisk(ctx context.Context, key cacheKey) *cachedPredictions {
+	b, err := os.ReadFile(c.diskPath(key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logFrom(ctx).Warnf("Failed reading prediction cache: %v", err)
+		}
+		return nil
+	}
+	var dp diskPredictions
+	if err := json.Unmarshal(b, &dp); err != nil {
+		logFrom(ctx).Warnf("Failed parsing prediction cache: %v", err)
+		return nil
+	}
+	if dp.Tracker != key.tracker || dp.Model != key.model {
+		return nil
+	}
+	e := &cachedPredictions{
+		trackerTime: dp.TrackerTime,
+		loaded:      dp.Loaded,
+		predictions: make([]bpefs.Prediction, len(dp.Predictions)),
+		refs:        make([]*firestore.DocumentRef, len(dp.Predictions)),
+	}
+	for i, p := range dp.Predictions {
+		e.refs[i] = fsclient.Doc(p.Path)
+		e.predictions[i] = bpefs.Prediction{
+			HomeTeam:    fsclient.Doc(p.Home),
+			AwayTeam:    fsclient.Doc(p.Road),
+			NeutralSite: p.Neutral,
+			Spread:      p.Spread,
+		}
+		if e.refs[i] == nil || e.predictions[i].HomeTeam == nil || e.predictions[i].AwayTeam == nil {
+			logFrom(ctx).Warnf("Prediction cache for model '%s' has bad paths: ignoring", key.model)
+			return nil
+		}
+	}
+	return e
+}
+
+// writeDisk writes an entry to disk, logging (but otherwise ignoring) failures.
+func (c *predictionCache) writeDisk(ctx context.Context, key cacheKey, e *cachedPredictions) {
+	dp := diskPredictions{
+		Tracker:     key.tracker,
+		TrackerTime: e.trackerTime,
+		Model:       key.model,
+		Loaded:      e.loaded,
+		Predictions: make([]diskPrediction, len(e.predictions)),
+	}
+	for i, p := range e.predictions {
+		dp.Predictions[i] = diskPrediction{
+			Path:    refPath(e.refs[i]),
+			Home:    refPath(p.HomeTeam),
+			Road:    refPath(p.AwayTeam),
+			Neutral: p.NeutralSite,
+			Spread:  p.Spread,
+		}
+	}
+	b, err := json.Marshal(dp)
+	if err != nil {
+		logFrom(ctx).Warnf("Failed encoding prediction cache: %v", err)
+		return
+	}
+	if err := os.WriteFile(c.diskPath(key), b, 0o644); err != nil {
+		logFrom(ctx).Warnf("Failed writing prediction cache: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package pickem4me
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+func TestPredictionCacheTTLFromEnv(t *testing.T) {
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", defaultPredictionCacheTTL},
+		{"1h", time.Hour},
+		{"0", 0},
+		{"forever", defaultPredictionCacheTTL},
+	}
+	for _, tt := range tests {
+		t.Setenv("PREDICTION_CACHE_TTL", tt.env)
+		if got := predictionCacheTTLFromEnv(); got != tt.want {
+			t.Errorf("PREDICTION_CACHE_TTL=%q: expected %v, got %v", tt.env, tt.want, got)
+		}
+	}
+}
+
+// setNow fixes the time seen by the package for the rest of the test.
+func setNow(t *testing.T, t0 time.Time) {
+	old := now
+	now = func() time.Time { return t0 }
+	t.Cleanup(func() { now = old })
+}
+
+func TestPredictionCacheFresh(t *testing.T) {
+	t0 := time.Date(2021, 10, 2, 12, 0, 0, 0, time.UTC)
+	setNow(t, t0)
+	tracker := t0.Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		loaded  time.Time
+		tracker time.Time
+		want    bool
+	}{
+		{"new", t0.Add(-time.Minute), tracker, true},
+		{"expired", t0.Add(-15 * time.Minute), tracker, false},
+		{"outdated tracker", t0.Add(-time.Minute), tracker.Add(-time.Hour), false},
+		{"newer tracker", t0.Add(-time.Minute), tracker.Add(time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newPredictionCache(15*time.Minute, "")
+			c.trackerTime = tracker
+			if got := c.fresh(&cachedPredictions{loaded: tt.loaded, trackerTime: tt.tracker}); got != tt.want {
+				t.Errorf("expected fresh %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPredictionCacheGetCopies(t *testing.T) {
+	t0 := time.Date(2021, 10, 2, 12, 0, 0, 0, time.UTC)
+	setNow(t, t0)
+	ctx := context.Background()
+
+	modelPerf := testClient.Doc("prediction_tracker/2021-10-02/model_performance/line")
+	c := newPredictionCache(time.Hour, "")
+	c.entries[cacheKey{tracker: refPath(modelPerf.Parent.Parent), model: refPath(modelPerf)}] = &cachedPredictions{
+		loaded:      t0,
+		predictions: []bpefs.Prediction{{HomeTeam: teamRef("iowa"), AwayTeam: teamRef("michigan"), Spread: 3}},
+		refs:        []*firestore.DocumentRef{modelPerf.Collection("predictions").Doc("1")},
+	}
+
+	preds, refs, err := c.get(ctx, modelPerf)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(preds) != 1 || len(refs) != 1 || preds[0].Spread != 3 {
+		t.Fatalf("expected the cached prediction, got %v", preds)
+	}
+	preds[0].Spread = -3
+	preds[0].HomeTeam, preds[0].AwayTeam = preds[0].AwayTeam, preds[0].HomeTeam
+	refs[0] = nil
+
+	again, againRefs, err := c.get(ctx, modelPerf)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if again[0].Spread != 3 || again[0].HomeTeam.ID != "iowa" || againRefs[0] == nil {
+		t.Errorf("expected changes to returned predictions not to change the cache, got %+v", again[0])
+	}
+}
+
+func TestPredictionCacheObserveTracker(t *testing.T) {
+	t0 := time.Date(2021, 10, 2, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	c := newPredictionCache(time.Hour, "")
+	c.observeTracker(ctx, t0)
+	old := cacheKey{tracker: "old", model: "line"}
+	current := cacheKey{tracker: "current", model: "line"}
+	c.entries[old] = &cachedPredictions{trackerTime: t0}
+	c.entries[current] = &cachedPredictions{trackerTime: t0.Add(time.Hour)}
+
+	c.observeTracker(ctx, t0.Add(-time.Hour))
+	if len(c.entries) != 2 || !c.trackerTime.Equal(t0) {
+		t.Fatalf("expected an older tracker to change nothing, got %d entries at %v", len(c.entries), c.trackerTime)
+	}
+	c.observeTracker(ctx, t0.Add(time.Hour))
+	if _, ok := c.entries[old]; ok {
+		t.Errorf("expected entry from an outdated tracker to be invalidated")
+	}
+	if _, ok := c.entries[current]; !ok {
+		t.Errorf("expected entry from the current tracker to stay")
+	}
+}
+
+func TestPredictionCacheDisk(t *testing.T) {
+	old := fsclient
+	fsclient = testClient
+	t.Cleanup(func() { fsclient = old })
+
+	t0 := time.Date(2021, 10, 2, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	dir := t.TempDir()
+	key := cacheKey{tracker: "prediction_tracker/2021-10-02", model: "prediction_tracker/2021-10-02/model_performance/line"}
+	e := &cachedPredictions{
+		trackerTime: t0,
+		loaded:      t0,
+		predictions: []bpefs.Prediction{{HomeTeam: teamRef("iowa"), AwayTeam: teamRef("michigan"), NeutralSite: true, Spread: 3}},
+		refs:        []*firestore.DocumentRef{testClient.Doc(key.model + "/predictions/1")},
+	}
+	newPredictionCache(time.Hour, dir).writeDisk(ctx, key, e)
+
+	got := newPredictionCache(time.Hour, dir).readDisk(ctx, key)
+	if got == nil {
+		t.Fatal("expected a cached entry on disk")
+	}
+	p := got.predictions[0]
+	if !got.loaded.Equal(t0) || refPath(p.HomeTeam) != "teams/iowa" || refPath(p.AwayTeam) != "teams/michigan" || !p.NeutralSite || p.Spread != 3 {
+		t.Errorf("expected the entry written, got %+v", p)
+	}
+	if refPath(got.refs[0]) != key.model+"/predictions/1" {
+		t.Errorf("expected reference '%s', got '%s'", key.model+"/predictions/1", refPath(got.refs[0]))
+	}
+	if got := newPredictionCache(time.Hour, dir).readDisk(ctx, cacheKey{tracker: key.tracker, model: "other"}); got != nil {
+		t.Errorf("expected no entry for another model, got %+v", got)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/reallyasi9/pickem4me"
+	"gopkg.in/yaml.v3"
+)
+
+// configHelp describes the configuration file in the usage.
+const configHelp = `Configuration:
+	Defaults for flags can be kept in named profiles in a YAML configuration file, by default
+	pickem4me.yaml in the user configuration directory (such as ~/.config/pickem4me.yaml).
+	Flags given on the command line override the values of the profile. For example:
+
+	profile: work                  # the profile used unless -profile is given
+	profiles:
+	  work:
+	    project: my-project
+	    credentials: ~/keys/pickem.json
+	    models:                    # paths to the models to pick with
+	      straightUp: models/abc
+	      noisySpread: models/def
+	      superdog: models/ghi
+	      fallback: models/jkl
+	    selection:                 # how models are chosen when no path is given
+	      straightUp: {metric: suw, order: desc}
+	      noisySpread: {metric: mae, order: asc}
+	    formats: [xlsx, md]
+	    destinations:
+	      events: https://example.com/hooks/picks
+	      telemetry: telemetry.jsonl
+`
+
+// config is the configuration file of the CLI.
+type config struct {
+	// Profile is the name of the profile to use unless another is given with -profile.
+	Profile string `yaml:"profile"`
+
+	// Profiles are the named profiles.
+	Profiles map[string]profile `yaml:"profiles"`
+}
+
+// profile holds defaults for the flags of the CLI.
+type profile struct {
+	Project     string `yaml:"project"`
+	Credentials string `yaml:"credentials"`
+
+	Models struct {
+		StraightUp  string `yaml:"straightUp"`
+		NoisySpread string `yaml:"noisySpread"`
+		Superdog    string `yaml:"superdog"`
+		Fallback    string `yaml:"fallback"`
+	} `yaml:"models"`
+
+	Selection struct {
+		StraightUp  *criterion `yaml:"straightUp"`
+		NoisySpread *criterion `yaml:"noisySpread"`
+		Superdog    *criterion `yaml:"superdog"`
+	} `yaml:"selection"`
+
+	Formats []string `yaml:"formats"`
+
+	Destinations struct {
+		Events    string `yaml:"events"`
+		Telemetry string `yaml:"telemetry"`
+	} `yaml:"destinations"`
+}
+
+// criterion is how the best model for a type of game is chosen.
+type criterion struct {
+	// Metric is the metric by which models are ranked, as listed by the models command.
+	Metric string `yaml:"metric"`
+
+	// Order is asc to choose the model with the least value of the metric, or desc for the greatest.
+	Order string `yaml:"order"`
+}
+
+// defaultConfigFile returns the path to the configuration file used unless -config is given.
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pickem4me.yaml")
+}
+
+// loadProfile reads the named profile from a configuration file, or the profile the file names if name is empty.
+// A missing file is not an error unless it was named explicitly; nil is returned if there is no profile to use.
+func loadProfile(file string, explicit bool, name string) (*profile, error) {
+	if file == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		if name != "" {
+			return nil, fmt.Errorf("no profile '%s': configuration file '%s' does not exist", name, file)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading configuration: %v", err)
+	}
+	var cfg config
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed parsing configuration '%s': %v", file, err)
+	}
+	if name == "" {
+		name = cfg.Profile
+	}
+	if name == "" {
+		if len(cfg.Profiles) == 1 {
+			for _, p := range cfg.Profiles {
+				return &p, nil
+			}
+		}
+		return nil, nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("no profile '%s' in configuration '%s'", name, file)
+	}
+	return &p, nil
+}
+
+// apply sets the flags that were not given on the command line from the profile, and sets the criteria for
+// choosing models. Only flags that exist in the given flag sets are set.
+func (p *profile) apply(sets ...*flag.FlagSet) error {
+	given := make(map[string]bool)
+	for _, fs := range sets {
+		fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	}
+	values := []struct{ name, value string }{
+		{"project", p.Project},
+		{"credentials", expandHome(p.Credentials)},
+		{"straightmodel", p.Models.StraightUp},
+		{"noisyspreadmodel", p.Models.NoisySpread},
+		{"superdogmodel", p.Models.Superdog},
+		{"fallbackmodel", p.Models.Fallback},
+		{"format", strings.Join(p.Formats, ",")},
+		{"events", p.Destinations.Events},
+		{"telemetry", p.Destinations.Telemetry},
+	}
+	for _, v := range values {
+		if v.value == "" || given[v.name] {
+			continue
+		}
+		for _, fs := range sets {
+			if fs.Lookup(v.name) == nil {
+				continue
+			}
+			if err := fs.Set(v.name, v.value); err != nil {
+				return fmt.Errorf("bad %s in profile: %v", v.name, err)
+			}
+			break
+		}
+	}
+
+	criteria := []struct {
+		gameType string
+		c        *criterion
+	}{
+		{"StraightUp", p.Selection.StraightUp},
+		{"NoisySpread", p.Selection.NoisySpread},
+		{"Superdog", p.Selection.Superdog},
+	}
+	for _, c := range criteria {
+		if c.c == nil {
+			continue
+		}
+		var desc bool
+		switch c.c.Order {
+		case "asc", "":
+		case "desc":
+			desc = true
+		default:
+			return fmt.Errorf("bad order '%s' of %s selection in profile: expected asc or desc", c.c.Order, c.gameType)
+		}
+		if err := pickem4me.SetModelCriterion(c.gameType, c.c.Metric, desc); err != nil {
+			return fmt.Errorf("bad %s selection in profile: %v", c.gameType, err)
+		}
+	}
+	return nil
+}
+
+// configure applies the profile chosen by the -config and -profile flags, if any, to the global flags and the flags
+// of a command.
+func configure(c *command) error {
+	file, explicit := _CONFIG, _CONFIG != ""
+	if !explicit {
+		file = defaultConfigFile()
+	}
+	p, err := loadProfile(file, explicit, _PROFILE)
+	if err != nil || p == nil {
+		return err
+	}
+	return p.apply(flag.CommandLine, c.flags)
+}
+
+// expandHome replaces a leading ~/ in a path with the home directory of the user.
+func expandHome(p string) string {
+	if !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[2:])
+}
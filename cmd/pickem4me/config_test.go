@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reallyasi9/pickem4me"
+)
+
+const testConfig = `profile: work
+profiles:
+  work:
+    project: work-project
+    models:
+      straightUp: models/abc
+    formats: [xlsx, md]
+    destinations:
+      events: https://example.com/hooks/picks
+  home:
+    project: home-project
+    selection:
+      straightUp: {metric: mae, order: asc}
+`
+
+// writeConfig writes a configuration file for a test and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "pickem4me.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadProfile(t *testing.T) {
+	config := writeConfig(t, testConfig)
+	single := writeConfig(t, "profiles:\n  only:\n    project: only-project\n")
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+
+	tests := []struct {
+		name        string
+		file        string
+		explicit    bool
+		profile     string
+		wantProject string
+		wantErr     string
+	}{
+		{"no file", "", false, "", "", ""},
+		{"named in the file", config, true, "", "work-project", ""},
+		{"named by flag", config, true, "home", "home-project", ""},
+		{"unknown profile", config, true, "play", "", "no profile 'play'"},
+		{"only profile", single, false, "", "only-project", ""},
+		{"default file missing", missing, false, "", "", ""},
+		{"default file missing with a profile", missing, false, "work", "", "does not exist"},
+		{"named file missing", missing, true, "", "", "failed reading configuration"},
+		{"unknown field", writeConfig(t, "profiles:\n  work:\n    projects: x\n"), true, "", "", "failed parsing configuration"},
+		{"empty file", writeConfig(t, ""), true, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := loadProfile(tt.file, tt.explicit, tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadProfile: %v", err)
+			}
+			if tt.wantProject == "" {
+				if p != nil {
+					t.Errorf("expected no profile, got %+v", p)
+				}
+				return
+			}
+			if p == nil || p.Project != tt.wantProject {
+				t.Errorf("expected project '%s', got %+v", tt.wantProject, p)
+			}
+		})
+	}
+}
+
+// restoreModelCriteria restores the default criteria for choosing models when a test ends.
+func restoreModelCriteria(t *testing.T) {
+	t.Cleanup(func() {
+		pickem4me.SetModelCriterion("StraightUp", "suw", true)
+		pickem4me.SetModelCriterion("NoisySpread", "mae", false)
+		pickem4me.SetModelCriterion("Superdog", "mae", false)
+	})
+}
+
+func TestProfileApply(t *testing.T) {
+	restoreModelCriteria(t)
+	p, err := loadProfile(writeConfig(t, testConfig), true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	global := flag.NewFlagSet("pickem4me", flag.ContinueOnError)
+	project := global.String("project", "", "")
+	credentials := global.String("credentials", "", "")
+	c := pickCommand()
+	if err := c.flags.Parse([]string{"-format", "json"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.apply(global, c.flags); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	if *project != "work-project" || *credentials != "" {
+		t.Errorf("expected project from the profile and no credentials, got '%s' and '%s'", *project, *credentials)
+	}
+	want := map[string]string{
+		"straightmodel":    "models/abc",
+		"noisyspreadmodel": "",
+		"format":           "json", // given on the command line
+		"events":           "https://example.com/hooks/picks",
+	}
+	for name, value := range want {
+		if got := c.flags.Lookup(name).Value.String(); got != value {
+			t.Errorf("-%s: expected '%s', got '%s'", name, value, got)
+		}
+	}
+
+	// Flags that the command does not have are ignored.
+	if err := p.apply(global, slatesCommand().flags); err != nil {
+		t.Errorf("apply to a command without model flags: %v", err)
+	}
+}
+
+func TestProfileApplySelection(t *testing.T) {
+	restoreModelCriteria(t)
+	tests := []struct {
+		name      string
+		selection string
+		wantErr   string
+	}{
+		{"ascending", "{metric: mae, order: asc}", ""},
+		{"descending", "{metric: suw, order: desc}", ""},
+		{"default order", "{metric: mae}", ""},
+		{"bad order", "{metric: mae, order: up}", "bad order 'up'"},
+		{"bad metric", "{metric: luck}", "bad StraightUp selection"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := loadProfile(writeConfig(t, "profiles:\n  p:\n    selection:\n      straightUp: "+tt.selection+"\n"), true, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.apply(flag.NewFlagSet("pickem4me", flag.ContinueOnError))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("apply: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
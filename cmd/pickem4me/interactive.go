@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/reallyasi9/pickem4me"
+)
+
+const interactiveHelp = `Commands:
+	list                      List every game with its pick and the probability that the pick is correct.
+	flip <row> [<row>...]     Pick the other team in straight-up or noisy spread games.
+	dog <row>|none            Pick the underdog of another superdog game, or no superdog.
+	dogs                      Compare the expected values of the superdogs.
+	streak <team>[,<team>]    Change the streak pick.
+	streak none               Remove the streak pick.
+	overrides                 List the picks changed by hand.
+	write                     Store, write, and deliver the picks, and quit.
+	quit                      Quit without storing, writing, or delivering anything.
+	help                      Print this help.
+`
+
+// draft is a pick set that can be overridden by hand before it is committed, such as a *pickem4me.Draft.
+type draft interface {
+	Picks() *pickem4me.PickSet
+	Teams() *pickem4me.TeamResolver
+	FlipPick(row int) error
+	ChooseSuperdog(row int) error
+	SetStreak(names []string) error
+	Commit() (*pickem4me.PickSet, error)
+	Discard()
+}
+
+// interactive lets the user override picks by hand before they are committed. It returns the committed picks,
+// or nil if the user quits without writing them.
+func interactive(ctx context.Context, pem pickem4me.PickEmMessage, in io.Reader, out io.Writer) (*pickem4me.PickSet, error) {
+	d, err := pickem4me.NewDraft(ctx, pem)
+	if err != nil {
+		return nil, err
+	}
+	return edit(d, in, out)
+}
+
+// edit reads commands that override the picks of a draft until the draft is committed or the user quits.
+// A draft that is not committed is discarded.
+func edit(d draft, in io.Reader, out io.Writer) (*pickem4me.PickSet, error) {
+	defer d.Discard()
+	teams := d.Teams()
+	listGames(out, d.Picks(), teams)
+	printScore(out, d.Picks())
+	fmt.Fprintln(out, "\nType 'help' for commands.")
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			break
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, args := fields[0], fields[1:]
+		var err error
+		changed := false
+		switch cmd {
+		case "list", "l":
+			listGames(out, d.Picks(), teams)
+		case "flip", "f":
+			if len(args) == 0 {
+				err = fmt.Errorf("flip which row?")
+			}
+			for _, arg := range args {
+				var row int
+				if row, err = strconv.Atoi(arg); err != nil {
+					err = fmt.Errorf("bad row '%s'", arg)
+					break
+				}
+				if err = d.FlipPick(row); err != nil {
+					break
+				}
+				changed = true
+			}
+		case "dog", "d":
+			if len(args) != 1 {
+				err = fmt.Errorf("dog takes a row, or none")
+				break
+			}
+			row := 0
+			if args[0] != "none" {
+				if row, err = strconv.Atoi(args[0]); err != nil {
+					err = fmt.Errorf("bad row '%s'", args[0])
+					break
+				}
+			}
+			if err = d.ChooseSuperdog(row); err == nil {
+				listDogs(out, d.Picks(), teams)
+				changed = true
+			}
+		case "dogs":
+			listDogs(out, d.Picks(), teams)
+		case "streak", "s":
+			if len(args) == 0 {
+				err = fmt.Errorf("streak takes teams, or none")
+				break
+			}
+			var names []string
+			if joined := strings.Join(args, " "); joined != "none" {
+				for _, name := range strings.Split(joined, ",") {
+					names = append(names, strings.TrimSpace(name))
+				}
+			}
+			if err = d.SetStreak(names); err == nil {
+				changed = true
+			}
+		case "overrides", "o":
+			listOverrides(out, d.Picks(), teams)
+		case "write", "w":
+			return d.Commit()
+		case "quit", "q":
+			fmt.Fprintln(out, "Nothing was stored, written, or delivered.")
+			return nil, nil
+		case "help", "?":
+			fmt.Fprint(out, interactiveHelp)
+		default:
+			err = fmt.Errorf("unknown command '%s': type 'help' for commands", cmd)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+		}
+		if changed {
+			printScore(out, d.Picks())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(out, "Nothing was stored, written, or delivered.")
+	return nil, nil
+}
+
+// listGames prints every game with its pick.
+func listGames(w io.Writer, ps *pickem4me.PickSet, teams *pickem4me.TeamResolver) {
+	ex := ps.Export()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Row\tType\tGame\tPick\tProbability\t")
+	for _, g := range ex.Games {
+		var game string
+		if g.Type == pickem4me.ExportSuperdog {
+			game = fmt.Sprintf("%s over %s (%d points)", teamName(teams, g.Underdog), teamName(teams, g.Overdog), g.Value)
+		} else {
+			game = fmt.Sprintf("%s at %s", teamName(teams, g.Road), teamName(teams, g.Home))
+			if g.NoisySpread != 0 {
+				game += fmt.Sprintf(" (%+d)", g.NoisySpread)
+			}
+		}
+		pick := teamName(teams, g.Pick)
+		prob := fmt.Sprintf("%.3f", g.Confidence())
+		if g.Type == pickem4me.ExportSuperdog {
+			prob = fmt.Sprintf("%.3f", g.PredictedProbability)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", g.Row, g.Type, game, pick, prob, marks(ps, g))
+	}
+	if ex.Streak != nil {
+		fmt.Fprintf(tw, "\tstreak\t\t%s\t%.3f\t%s\n", teamNames(teams, strings.Join(ex.Streak.Picks, ",")), ex.Streak.PredictedProbability, streakMark(ps))
+	}
+	tw.Flush()
+}
+
+// marks returns marks for a game that is locked or overridden.
+func marks(ps *pickem4me.PickSet, g pickem4me.ExportedPick) string {
+	var m []string
+	if g.Locked {
+		m = append(m, "locked")
+	}
+	for _, o := range ps.Overrides {
+		if o.Row == g.Row && o.Kind != pickem4me.OverrideStreak {
+			m = append(m, "override")
+		}
+	}
+	return strings.Join(m, ", ")
+}
+
+func streakMark(ps *pickem4me.PickSet) string {
+	for _, o := range ps.Overrides {
+		if o.Kind == pickem4me.OverrideStreak {
+			return "override"
+		}
+	}
+	return ""
+}
+
+// listDogs prints the expected values of the superdogs.
+func listDogs(w io.Writer, ps *pickem4me.PickSet, teams *pickem4me.TeamResolver) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Row\tUnderdog\tOverdog\tValue\tProbability\tEV\t")
+	for _, g := range ps.Export().Games {
+		if g.Type != pickem4me.ExportSuperdog {
+			continue
+		}
+		mark := ""
+		if g.Pick != "" {
+			mark = "picked"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%.3f\t%.3f\t%s\n", g.Row, teamName(teams, g.Underdog), teamName(teams, g.Overdog), g.Value, g.PredictedProbability, g.PredictedProbability*float64(g.Value), mark)
+	}
+	tw.Flush()
+}
+
+// listOverrides prints the picks changed by hand.
+func listOverrides(w io.Writer, ps *pickem4me.PickSet, teams *pickem4me.TeamResolver) {
+	if len(ps.Overrides) == 0 {
+		fmt.Fprintln(w, "No picks have been changed.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Row\tKind\tModel\tPick")
+	for _, o := range ps.Overrides {
+		row := ""
+		if o.Row != 0 {
+			row = strconv.Itoa(o.Row)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", row, o.Kind, teamNames(teams, strings.Join(o.Model, ",")), teamNames(teams, strings.Join(o.Pick, ",")))
+	}
+	tw.Flush()
+}
+
+// printScore prints the expected score of the picks.
+func printScore(w io.Writer, ps *pickem4me.PickSet) {
+	s := pickem4me.ExpectedScore(ps)
+	fmt.Fprintf(w, "Expected score %.1f ± %.1f out of %d\n", s.Expected, s.StdDev, s.Max)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+	"github.com/reallyasi9/pickem4me"
+)
+
+// testClient makes document references only. It cannot reach a Firestore server.
+var testClient = func() *firestore.Client {
+	c, err := firestore.NewClient(context.Background(), "pickem4me-test", option.WithoutAuthentication(),
+		option.WithEndpoint("localhost:1"), option.WithGRPCDialOption(grpc.WithInsecure()))
+	if err != nil {
+		panic(err)
+	}
+	return c
+}()
+
+// fakeDraft records the overrides asked of it.
+type fakeDraft struct {
+	ps        *pickem4me.PickSet
+	teams     *pickem4me.TeamResolver
+	calls     []string
+	commitErr error
+	committed bool
+	discarded bool
+}
+
+// newFakeDraft makes a draft of Iowa over Michigan in row 1 and the Purdue superdog in row 6.
+func newFakeDraft() *fakeDraft {
+	team := func(id string) *firestore.DocumentRef { return testClient.Collection("teams").Doc(id) }
+	teams := pickem4me.NewTeamResolver()
+	for _, id := range []string{"iowa", "michigan", "purdue", "indiana"} {
+		teams.AddTeam(team(id), bpefs.Team{School: strings.Title(id)})
+	}
+	return &fakeDraft{
+		ps: &pickem4me.PickSet{
+			StraightUp: []*bpefs.StraightUpPick{{Row: 1, HomeTeam: team("iowa"), AwayTeam: team("michigan"), Pick: team("iowa"), PredictedProbability: 0.7}},
+			Superdog:   []*bpefs.SuperDogPick{{Row: 6, Underdog: team("purdue"), Overdog: team("indiana"), Value: 10, PredictedProbability: 0.3, Pick: team("purdue")}},
+		},
+		teams: teams,
+	}
+}
+
+func (d *fakeDraft) Picks() *pickem4me.PickSet      { return d.ps }
+func (d *fakeDraft) Teams() *pickem4me.TeamResolver { return d.teams }
+
+func (d *fakeDraft) FlipPick(row int) error {
+	d.calls = append(d.calls, fmt.Sprintf("flip %d", row))
+	if row != 1 {
+		return fmt.Errorf("no game in row %d", row)
+	}
+	return nil
+}
+
+func (d *fakeDraft) ChooseSuperdog(row int) error {
+	d.calls = append(d.calls, fmt.Sprintf("dog %d", row))
+	return nil
+}
+
+func (d *fakeDraft) SetStreak(names []string) error {
+	d.calls = append(d.calls, "streak "+strings.Join(names, ","))
+	return nil
+}
+
+func (d *fakeDraft) Commit() (*pickem4me.PickSet, error) {
+	d.committed = true
+	if d.commitErr != nil {
+		return nil, d.commitErr
+	}
+	return d.ps, nil
+}
+
+func (d *fakeDraft) Discard() {
+	d.discarded = true
+}
+
+func TestEdit(t *testing.T) {
+	tests := []struct {
+		name          string
+		in            string
+		commitErr     error
+		wantCalls     []string
+		wantCommitted bool
+		wantErr       bool
+		wantOut       []string
+	}{
+		{"quit", "quit\n", nil, nil, false, false, []string{"Iowa", "Purdue over Indiana", "Nothing was stored"}},
+		{"end of input", "flip 1\n", nil, []string{"flip 1"}, false, false, []string{"Nothing was stored"}},
+		{"write", "flip 1\nwrite\n", nil, []string{"flip 1"}, true, false, nil},
+		{"failed write", "w\n", errors.New("the games in rows 1 started"), nil, true, true, nil},
+		{
+			name:      "commands",
+			in:        "f 1 2 1\nd none\nd 6\ns Ohio State, Michigan\ns none\n\nbogus\nhelp\nq\n",
+			wantCalls: []string{"flip 1", "flip 2", "dog 0", "dog 6", "streak Ohio State,Michigan", "streak "},
+			wantOut:   []string{"Error: no game in row 2", "unknown command 'bogus'", "Commands:", "Expected score"},
+		},
+		{
+			name:    "bad arguments",
+			in:      "flip\nflip x\ndog\ndog y\nstreak\n",
+			wantOut: []string{"flip which row?", "bad row 'x'", "dog takes a row, or none", "bad row 'y'", "streak takes teams, or none"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newFakeDraft()
+			d.commitErr = tt.commitErr
+			var out strings.Builder
+			ps, err := edit(d, strings.NewReader(tt.in), &out)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("expected error %t, got %v", tt.wantErr, err)
+			}
+			if wantPicks := tt.wantCommitted && !tt.wantErr; wantPicks != (ps != nil) {
+				t.Errorf("expected picks %t, got %v", wantPicks, ps)
+			}
+			if !reflect.DeepEqual(d.calls, tt.wantCalls) {
+				t.Errorf("expected calls %q, got %q", tt.wantCalls, d.calls)
+			}
+			if d.committed != tt.wantCommitted || !d.discarded {
+				t.Errorf("expected committed %t and the draft discarded, got %t and %t", tt.wantCommitted, d.committed, d.discarded)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("expected output containing %q, got:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/reallyasi9/pickem4me"
+)
+
+// filterList is a flag that can be given more than once.
+type filterList []string
+
+func (f *filterList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *filterList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// modelsOptions are the flags of the models command.
+type modelsOptions struct {
+	tracker string
+	sort    string
+	desc    bool
+	where   filterList
+}
+
+func modelsCommand() *command {
+	o := &modelsOptions{}
+	c := newCommand("models", "", "List and rank the models in a prediction tracker.", `The path of a model is what the -straightmodel, -noisyspreadmodel, -superdogmodel, and -fallbackmodel flags take.
+The Selected column marks the models picked for each game type when those flags are not given.
+
+Models can be sorted and filtered by any of these metrics:
+	`+strings.Join(pickem4me.ModelMetrics(), ", ")+`
+
+For example, to list models with a mean absolute error under 12 that predicted at least 100 games, best first:
+	pickem4me models -where 'mae<12' -where 'games>=100' -sort mae`, 0, o.models)
+	c.flags.StringVar(&o.tracker, "tracker", "", "Path or ID of the prediction tracker (default: the latest tracker.)")
+	c.flags.StringVar(&o.sort, "sort", "", "Sort the models by this metric (default: by name.)")
+	c.flags.BoolVar(&o.desc, "desc", false, "Sort in descending order.")
+	c.flags.Var(&o.where, "where", "List only models that satisfy a comparison of a metric with a number, such as 'mae<12' (may be given more than once.)")
+	return c
+}
+
+func (o *modelsOptions) models(ctx context.Context, args []string) error {
+	list, err := pickem4me.ListModels(ctx, o.tracker)
+	if err != nil {
+		return err
+	}
+	for _, f := range o.where {
+		if list.Models, err = pickem4me.FilterModels(list.Models, f); err != nil {
+			return err
+		}
+	}
+	if o.sort != "" {
+		if err := pickem4me.SortModels(list.Models, o.sort, o.desc); err != nil {
+			return err
+		}
+	}
+	return printResult(list, func(w io.Writer) error {
+		fmt.Fprintf(w, "Tracker %s, updated %s\n\n", list.Tracker, list.Timestamp.Local().Format("2006-01-02 15:04"))
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "System\tRank\tGames\tSU\tATS\tMAE\tBias\tStd dev\tSelected\tPath")
+		for _, m := range list.Models {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d-%d\t%.3f\t%.2f\t%.2f\t%.2f\t%s\t%s\n", m.System, m.Rank, m.Games, m.Wins, m.Losses, m.PercentATS, m.MAE, m.Bias, m.StdDev, strings.Join(m.Selected, ","), m.Path)
+		}
+		return tw.Flush()
+	})
+}
+
+// slatesOptions are the flags of the slates command.
+type slatesOptions struct {
+	week  int
+	limit int
+}
+
+func slatesCommand() *command {
+	o := &slatesOptions{}
+	c := newCommand("slates", "", "List parsed slates, most recent first.", `The path of a slate is what the <slate> argument of other commands takes.`, 0, o.slates)
+	c.flags.IntVar(&o.week, "week", 0, "List only slates of this week (default: every week.)")
+	c.flags.IntVar(&o.limit, "n", 10, "List at most this many slates (0 lists every slate.)")
+	return c
+}
+
+func (o *slatesOptions) slates(ctx context.Context, args []string) error {
+	slates, err := pickem4me.ListSlates(ctx, o.week, o.limit)
+	if err != nil {
+		return err
+	}
+	return printResult(slates, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "Week\tCreated\tPath\tFile")
+		for _, s := range slates {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Week, s.Created.Local().Format("2006-01-02 15:04"), s.Path, s.File)
+		}
+		return tw.Flush()
+	})
+}
+
+func pickersCommand() *command {
+	return newCommand("pickers", "", "List every picker.", `The Luke name of a picker is what the <picker> argument of other commands takes.`, 0, pickers)
+}
+
+func pickers(ctx context.Context, args []string) error {
+	pickers, err := pickem4me.ListPickers(ctx)
+	if err != nil {
+		return err
+	}
+	return printResult(pickers, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "Luke name\tName\tPath")
+		for _, p := range pickers {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", p.LukeName, p.Name, p.Path)
+		}
+		return tw.Flush()
+	})
+}
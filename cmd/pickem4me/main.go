@@ -3,76 +3,328 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"time"
 
 	"github.com/reallyasi9/pickem4me"
 )
 
+// Exit codes.
+const (
+	// exitOK means the command succeeded.
+	exitOK = 0
+
+	// exitFindings means the command ran but found problems (validate) or differences (diff).
+	exitFindings = 1
+
+	// exitUsage means the command was used incorrectly.
+	exitUsage = 2
+
+	// exitFailure means the command failed for a reason not covered by another exit code.
+	exitFailure = 3
+
+	// exitInvalidInput means a slate, model, or other argument was invalid.
+	exitInvalidInput = 4
+
+	// exitNotFound means a slate, picker, model, or picks document was not found.
+	exitNotFound = 5
+
+	// exitInconsistent means the data in Firestore could not be picked as it is.
+	exitInconsistent = 6
+
+	// exitDeadlinePassed means the pick deadline of the slate has passed.
+	exitDeadlinePassed = 7
+
+	// exitTransient means a backend failed in a way that might succeed if the command is run again.
+	exitTransient = 8
+)
+
+// errFindings is returned by commands that ran but found problems or differences.
+var errFindings = errors.New("findings")
+
+// usageError is an error in the arguments of a command.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// command is a subcommand of pickem4me.
+type command struct {
+	// name is the name of the command.
+	name string
+
+	// args describes the positional arguments of the command.
+	args string
+
+	// summary is a one-line description of the command.
+	summary string
+
+	// help describes the command in detail.
+	help string
+
+	// nargs is the number of positional arguments the command takes (negative means any number).
+	nargs int
+
+	// flags are the flags of the command.
+	flags *flag.FlagSet
+
+	// run runs the command with its positional arguments.
+	run func(ctx context.Context, args []string) error
+}
+
+// usage prints the help of the command.
+func (c *command) usage() {
+	w := c.flags.Output()
+	fmt.Fprintf(w, "pickem4me [global flags] %s [flags] %s\n\n%s\n", c.name, c.args, c.summary)
+	if c.help != "" {
+		fmt.Fprintf(w, "\n%s\n", c.help)
+	}
+	fmt.Fprintln(w, "\nFlags:")
+	c.flags.PrintDefaults()
+	fmt.Fprintln(w, "\nRun 'pickem4me help' for global flags and exit codes.")
+}
+
+// commands are the subcommands of pickem4me, in the order they are listed in the usage.
+var commands []*command
+
+// newCommand makes a subcommand with its own flag set.
+func newCommand(name, args, summary, help string, nargs int, run func(ctx context.Context, args []string) error) *command {
+	c := &command{
+		name:    name,
+		args:    args,
+		summary: summary,
+		help:    help,
+		nargs:   nargs,
+		flags:   flag.NewFlagSet(name, flag.ContinueOnError),
+		run:     run,
+	}
+	c.flags.Usage = c.usage
+	return c
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
 func usage() {
 	w := flag.CommandLine.Output()
-	fmt.Fprint(w, `pickem4me [flags] <picker> <slateID>
+	fmt.Fprint(w, `pickem4me [global flags] <command> [flags] [arguments]
 
 Make all your picks for you!
 
-Arguments:
-	<picker>
-		(Luke-given) name of picker.
-	<slateID>
-		The full Firebase path to the parsed slate.
-Flags:
+Commands:
+`)
+	for _, c := range commands {
+		fmt.Fprintf(w, "\t%-10s%s\n", c.name, c.summary)
+	}
+	fmt.Fprint(w, `
+Run 'pickem4me help <command>' for the flags and arguments of a command.
+
+Global flags:
 `)
 	flag.PrintDefaults()
+	fmt.Fprintf(w, `
+Exit codes:
+	%d	success
+	%d	validate found errors, or diff found differences
+	%d	bad usage
+	%d	failure of another kind
+	%d	invalid input
+	%d	slate, picker, model, or picks not found
+	%d	inconsistent data in Firestore
+	%d	pick deadline passed
+	%d	transient failure: try again
+
+`+configHelp, exitOK, exitFindings, exitUsage, exitFailure, exitInvalidInput, exitNotFound, exitInconsistent, exitDeadlinePassed, exitTransient)
 }
 
-var _DRY_RUN bool
-var _SU_MODEL string
-var _NS_MODEL string
-var _SD_MODEL string
+var _PROJECT string
+var _CREDENTIALS string
+var _OUTPUT string
+var _CACHE_DIR string
+var _CACHE_TTL time.Duration
+var _VERBOSE bool
+var _QUIET bool
+var _LOG_FORMAT string
+var _CONFIG string
+var _PROFILE string
 
 func init() {
-	flag.BoolVar(&_DRY_RUN, "dryrun", false, "Do not write output to Firestore, just print the documents that would have been written.")
+	flag.StringVar(&_CONFIG, "config", "", "Path to the configuration file (default: pickem4me.yaml in the user configuration directory, if it exists.)")
+	flag.StringVar(&_PROFILE, "profile", "", "Name of the profile in the configuration file to use (default: the profile named in the file.)")
+	flag.StringVar(&_PROJECT, "project", "", "Google Cloud project that holds the Firestore database (default: from the profile, or the GCP_PROJECT environment variable.)")
+	flag.StringVar(&_CREDENTIALS, "credentials", "", "Path to a service account key file (default: application default credentials.)")
+	flag.StringVar(&_OUTPUT, "output", "text", "How to print results: text, or json for scripts.")
+
+	flag.StringVar(&_CACHE_DIR, "cachedir", "", "Directory in which to cache model predictions between runs (default: do not cache predictions on disk.)")
+	flag.DurationVar(&_CACHE_TTL, "cachettl", 15*time.Minute, "How long cached model predictions are used before they are read again (0 disables the cache.)")
 
-	flag.StringVar(&_SU_MODEL, "straightmodel", "", "The full Firebase path to a model to use for straight picks (default: use the model with the best win record this season.)")
-	flag.StringVar(&_NS_MODEL, "noisyspreadmodel", "", "The full Firebase path to a model to use for noisy spread picks (default: use the model with the lowest mean absolute error this season.)")
-	flag.StringVar(&_SD_MODEL, "superdogmodel", "", "The full Firebase path to a model to use for superdog picks (default: use model specified by `noisyspread`.)")
+	flag.BoolVar(&_VERBOSE, "v", false, "Verbose: log debugging details, such as every game and prediction read.")
+	flag.BoolVar(&_QUIET, "q", false, "Quiet: log only warnings and errors.")
+	flag.StringVar(&_LOG_FORMAT, "logformat", "text", "Log format: text, or json as understood by Cloud Logging.")
+
+	commands = []*command{
+		pickCommand(),
+		validateCommand(),
+		explainCommand(),
+		modelsCommand(),
+		slatesCommand(),
+		pickersCommand(),
+		diffCommand(),
+		scoreCommand(),
+		exportCommand(),
+		newCommand("help", "[command]", "Print help for pickem4me or one of its commands.", "", -1, help),
+	}
 }
 
 func main() {
+	os.Exit(run())
+}
 
+// run runs the command given on the command line and returns the exit code.
+func run() int {
 	flag.Usage = usage
-	flag.Parse()
-
-	if flag.NArg() != 2 {
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flag.NArg() == 0 {
 		usage()
-		os.Exit(0)
+		return exitUsage
+	}
+	c := findCommand(flag.Arg(0))
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "pickem4me: unknown command '%s'\n\n", flag.Arg(0))
+		usage()
+		return exitUsage
+	}
+	if err := c.flags.Parse(flag.Args()[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if c.nargs >= 0 && c.flags.NArg() != c.nargs {
+		fmt.Fprintf(os.Stderr, "pickem4me %s: expected %d arguments, got %d\n\n", c.name, c.nargs, c.flags.NArg())
+		c.usage()
+		return exitUsage
 	}
 
-	picker := flag.Arg(0)
-	slateID := flag.Arg(1)
-
+	if c.name != "help" {
+		if err := configure(c); err != nil {
+			pickem4me.Log().Errorf("%v", err)
+			return exitUsage
+		}
+	}
+	if err := setup(); err != nil {
+		pickem4me.Log().Errorf("%v", err)
+		return exitUsage
+	}
 	ctx := context.Background()
-	pem := pickem4me.PickEmMessage{
-		Picker:           picker,
-		StraightModel:    _SU_MODEL,
-		NoisySpreadModel: _NS_MODEL,
-		SuperdogModel:    _SD_MODEL,
-		Slate:            slateID,
-		DryRun:           _DRY_RUN,
+	if c.name != "help" {
+		if err := pickem4me.Connect(ctx, _PROJECT, _CREDENTIALS); err != nil {
+			pickem4me.Log().Errorf("%v", err)
+			return exitFailure
+		}
+	}
+
+	err := c.run(ctx, c.flags.Args())
+	var ue usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case err == errFindings:
+		return exitFindings
+	case errors.As(err, &ue):
+		fmt.Fprintf(os.Stderr, "pickem4me %s: %v\n\n", c.name, err)
+		c.usage()
+		return exitUsage
+	default:
+		pickem4me.Log().With("kind", pickem4me.KindOf(err).String()).Errorf("%v", err)
+		return exitCode(err)
+	}
+}
+
+// setup configures logging and the prediction cache from the global flags.
+func setup() error {
+	switch _OUTPUT {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown output '%s': expected text or json", _OUTPUT)
+	}
+
+	level := pickem4me.LevelInfo
+	switch {
+	case _VERBOSE && _QUIET:
+		return errors.New("-v and -q cannot be used together")
+	case _VERBOSE:
+		level = pickem4me.LevelDebug
+	case _QUIET:
+		level = pickem4me.LevelWarning
+	}
+	if err := pickem4me.ConfigureLogging(os.Stderr, level, _LOG_FORMAT); err != nil {
+		return err
 	}
+	return pickem4me.SetPredictionCache(_CACHE_TTL, _CACHE_DIR)
+}
 
-	data, err := json.Marshal(pem)
-	if err != nil {
-		log.Fatal(err)
+// exitCode returns the exit code for a failed command.
+func exitCode(err error) int {
+	switch pickem4me.KindOf(err) {
+	case pickem4me.KindInvalidInput:
+		return exitInvalidInput
+	case pickem4me.KindNotFound:
+		return exitNotFound
+	case pickem4me.KindInconsistent:
+		return exitInconsistent
+	case pickem4me.KindDeadlinePassed:
+		return exitDeadlinePassed
+	case pickem4me.KindTransient:
+		return exitTransient
+	default:
+		return exitFailure
 	}
+}
 
-	m := pickem4me.PubSubMessage{
-		Data: data,
+func help(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		flag.CommandLine.SetOutput(os.Stdout)
+		usage()
+		return nil
+	}
+	if len(args) > 1 {
+		return usageError{"expected at most one command"}
 	}
+	c := findCommand(args[0])
+	if c == nil {
+		return usageError{fmt.Sprintf("unknown command '%s'", args[0])}
+	}
+	c.flags.SetOutput(os.Stdout)
+	c.usage()
+	return nil
+}
 
-	if err := pickem4me.PickEm(ctx, m); err != nil {
-		log.Fatal(err)
+// printResult prints the result of a command: as indented JSON if -output is json, otherwise with the text function.
+func printResult(v interface{}, text func(w io.Writer) error) error {
+	if _OUTPUT == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
 	}
+	return text(os.Stdout)
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/reallyasi9/pickem4me"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"unknown", errors.New("boom"), exitFailure},
+		{"invalid input", &pickem4me.Error{Kind: pickem4me.KindInvalidInput, Err: errors.New("no slate given")}, exitInvalidInput},
+		{"deadline passed", fmt.Errorf("failed: %w", &pickem4me.Error{Kind: pickem4me.KindDeadlinePassed, Err: errors.New("too late")}), exitDeadlinePassed},
+		{"not found", status.Error(codes.NotFound, "no slate"), exitNotFound},
+		{"inconsistent", status.Error(codes.FailedPrecondition, "bad"), exitInconsistent},
+		{"transient", fmt.Errorf("failed: %w", context.DeadlineExceeded), exitTransient},
+		{"unavailable", status.Error(codes.Unavailable, "down"), exitTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("expected exit code %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
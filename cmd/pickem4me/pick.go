@@ -0,0 +1,565 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/reallyasi9/pickem4me"
+)
+
+// modelOptions are the flags that choose models.
+type modelOptions struct {
+	straightUp  string
+	noisySpread string
+	superdog    string
+	fallback    string
+}
+
+// addFlags adds the flags that choose models to a command.
+func (o *modelOptions) addFlags(fs *flag.FlagSet, fallback bool) {
+	fs.StringVar(&o.straightUp, "straightmodel", "", "The full Firebase path to a model to use for straight picks (default: use the model with the best win record this season.)")
+	fs.StringVar(&o.noisySpread, "noisyspreadmodel", "", "The full Firebase path to a model to use for noisy spread picks (default: use the model with the lowest mean absolute error this season.)")
+	fs.StringVar(&o.superdog, "superdogmodel", "", "The full Firebase path to a model to use for superdog picks (default: use model specified by `noisyspread`.)")
+	if fallback {
+		fs.StringVar(&o.fallback, "fallbackmodel", "", "The full Firebase path to a model to use for games the other models do not predict (default: use the next-best model, then a home field and ranking heuristic.)")
+	}
+}
+
+// pickingOptions are the flags that control how a slate is picked.
+type pickingOptions struct {
+	models        modelOptions
+	deadline      string
+	late          string
+	swapPolicy    string
+	neutralPolicy string
+	repick        bool
+	overrides     string
+
+	// dryRun and format are flags of the pick command only.
+	dryRun bool
+	format string
+}
+
+// addFlags adds the flags that control how a slate is picked to a command.
+func (o *pickingOptions) addFlags(fs *flag.FlagSet) {
+	o.models.addFlags(fs, true)
+	fs.StringVar(&o.deadline, "deadline", "", "Pick deadline in RFC 3339 format, overriding the deadline of the slate (default: use the deadline of the slate, or the earliest kickoff.)")
+	fs.StringVar(&o.late, "late", "", "What to do after the deadline: refuse to pick, or pick only unstarted games (default: refuse, or unstarted with -repick.)")
+	fs.StringVar(&o.swapPolicy, "swappolicy", "trust_model", "How to resolve games with home and road teams reversed in the slate: trust_model, trust_slate, or fail.")
+	fs.StringVar(&o.neutralPolicy, "neutralpolicy", "trust_model", "How to resolve games the slate and model disagree are at a neutral site: trust_model, trust_slate, or fail.")
+	fs.BoolVar(&o.repick, "repick", false, "Keep the picks already made for games that have started and repick only the rest.")
+	fs.StringVar(&o.overrides, "overrides", "", "YAML or JSON file of picks to force after the models pick: teams to pick, superdogs to exclude, the superdog, and the streak (default: no overrides.)")
+}
+
+// message makes the message that picks a slate for a picker from the flags.
+func (o *pickingOptions) message(picker, slateID string) (pickem4me.PickEmMessage, error) {
+	formats, err := pickem4me.ParseFormats(o.format)
+	if err != nil {
+		return pickem4me.PickEmMessage{}, usageError{err.Error()}
+	}
+
+	var deadline *time.Time
+	if o.deadline != "" {
+		t, err := time.Parse(time.RFC3339, o.deadline)
+		if err != nil {
+			return pickem4me.PickEmMessage{}, usageError{fmt.Sprintf("bad deadline: %v", err)}
+		}
+		deadline = &t
+	}
+
+	var overrides *pickem4me.Overrides
+	if o.overrides != "" {
+		if overrides, err = pickem4me.LoadOverrides(o.overrides); err != nil {
+			return pickem4me.PickEmMessage{}, err
+		}
+	}
+
+	return pickem4me.PickEmMessage{
+		Picker:           picker,
+		StraightModel:    o.models.straightUp,
+		NoisySpreadModel: o.models.noisySpread,
+		SuperdogModel:    o.models.superdog,
+		FallbackModel:    o.models.fallback,
+		Slate:            slateID,
+		DryRun:           o.dryRun,
+		Formats:          formats,
+		Deadline:         deadline,
+		LatePolicy:       o.late,
+		Repick:           o.repick,
+		SwapPolicy:       o.swapPolicy,
+		NeutralPolicy:    o.neutralPolicy,
+		Overrides:        overrides,
+	}, nil
+}
+
+// pickResult is the result of the pick command.
+type pickResult struct {
+	// Picks is the path to the stored picks document (empty for dry runs).
+	Picks string `json:"picks,omitempty"`
+
+	// Score is the expected score of the picks.
+	Score pickem4me.Score `json:"score"`
+
+	// Export are the picks.
+	Export *pickem4me.PicksExport `json:"export"`
+}
+
+// pickOptions are the flags of the pick command.
+type pickOptions struct {
+	pickingOptions
+	events      string
+	telemetry   string
+	interactive bool
+}
+
+func pickCommand() *command {
+	o := &pickOptions{}
+	c := newCommand("pick", "<picker> <slate>", "Pick a slate for a picker, store the picks, and write and deliver them.", `Arguments:
+	<picker>
+		(Luke-given) name of picker.
+	<slate>
+		The full Firebase path to the parsed slate.`, 2, o.pick)
+	o.addFlags(c.flags)
+	c.flags.BoolVar(&o.dryRun, "dryrun", false, "Do not write output to Firestore, just print the documents that would have been written.")
+	c.flags.StringVar(&o.format, "format", "xlsx,md,html", "Comma-separated list of output formats to write (any of xlsx, json, csv, md, html). Reports in md and html are written next to the Excel output.")
+	c.flags.StringVar(&o.events, "events", "", "Where to publish picks completed and picks failed events: an http(s) URL, a file to append to, or - for standard error (default: do not publish events.)")
+	c.flags.StringVar(&o.telemetry, "telemetry", "", "Where to write the spans and metrics of the run as lines of JSON: a file to append to, or - for standard error (default: do not export telemetry.)")
+	c.flags.BoolVar(&o.interactive, "i", false, "Interactive: review the picks and change them by hand before they are stored, written, and delivered.")
+	return c
+}
+
+func (o *pickOptions) pick(ctx context.Context, args []string) error {
+	pem, err := o.message(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if err := setPublisher(o.events); err != nil {
+		return err
+	}
+	if err := setTelemetryExporter(o.telemetry); err != nil {
+		return err
+	}
+
+	var ps *pickem4me.PickSet
+	if o.interactive {
+		ps, err = interactive(ctx, pem, os.Stdin, os.Stderr)
+		if ps == nil {
+			return err
+		}
+	} else {
+		ps, err = pickem4me.Run(ctx, pem)
+	}
+	if err != nil {
+		return err
+	}
+	result := pickResult{Score: pickem4me.ExpectedScore(ps), Export: ps.Export()}
+	if ps.Ref != nil {
+		result.Picks = "picks/" + ps.Ref.ID
+	}
+	return printResult(result, func(w io.Writer) error {
+		stored := result.Picks
+		if stored == "" {
+			stored = "not stored (dry run)"
+		}
+		fmt.Fprintf(w, "Picked week %d for %s: %s\n", ps.Week, pem.Picker, stored)
+		_, err := fmt.Fprintf(w, "Expected score %.1f ± %.1f out of %d\n", result.Score.Expected, result.Score.StdDev, result.Score.Max)
+		return err
+	})
+}
+
+func validateCommand() *command {
+	o := &modelOptions{}
+	c := newCommand("validate", "<slate>", "Check a slate against the models that would be used to pick it.", `The report lists every problem found. The exit code is 1 if any of them are errors.
+
+Arguments:
+	<slate>
+		The full Firebase path to the parsed slate.`, 1, o.validate)
+	o.addFlags(c.flags, false)
+	return c
+}
+
+func (o *modelOptions) validate(ctx context.Context, args []string) error {
+	report, err := pickem4me.ValidateSlate(ctx, args[0], o.straightUp, o.noisySpread, o.superdog)
+	if err != nil {
+		return err
+	}
+	if err := printResult(report, report.Write); err != nil {
+		return err
+	}
+	if report.Errors() > 0 {
+		return errFindings
+	}
+	return nil
+}
+
+func explainCommand() *command {
+	o := &pickingOptions{}
+	c := newCommand("explain", "<picker> <slate> <row|team>", "Explain how one game of a slate would be picked.", `Shows the game from the slate, the prediction matched to it, how disagreements between them are resolved,
+how the probability of the pick is computed from the bias and standard deviation of the model, and the pick.
+For superdog games, the expected value of every superdog is compared. Nothing is stored or written.
+
+Arguments:
+	<picker>
+		(Luke-given) name of picker.
+	<slate>
+		The full Firebase path to the parsed slate.
+	<row|team>
+		The slate row of the game, or the name of either team playing in it if the team plays in only one game.`, 3, o.explain)
+	o.addFlags(c.flags)
+	return c
+}
+
+func (o *pickingOptions) explain(ctx context.Context, args []string) error {
+	pem, err := o.message(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	ex, err := pickem4me.Explain(ctx, pem, args[2])
+	if err != nil {
+		return err
+	}
+	teams, err := pickem4me.LoadTeamResolver(ctx)
+	if err != nil {
+		return err
+	}
+	return printResult(ex, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "Row %d (%s)\n", ex.Row, ex.Type)
+
+		fmt.Fprintln(tw, "\nSlate")
+		if ex.Type == pickem4me.ExportSuperdog {
+			fmt.Fprintf(tw, "  Underdog\t%s\n", rankedName(teams, ex.Slate.Underdog, ex.Slate.RoadRank))
+			fmt.Fprintf(tw, "  Overdog\t%s\n", rankedName(teams, ex.Slate.Overdog, ex.Slate.HomeRank))
+			fmt.Fprintf(tw, "  Value\t%d\n", ex.Slate.Value)
+		} else {
+			fmt.Fprintf(tw, "  Home\t%s\n", rankedName(teams, ex.Slate.Home, ex.Slate.HomeRank))
+			fmt.Fprintf(tw, "  Road\t%s\n", rankedName(teams, ex.Slate.Road, ex.Slate.RoadRank))
+		}
+		fmt.Fprintf(tw, "  Neutral site\t%t\n", ex.Slate.NeutralSite)
+		if ex.Slate.NoisySpread != 0 {
+			fmt.Fprintf(tw, "  Noisy spread\t%+d\n", ex.Slate.NoisySpread)
+		}
+
+		fmt.Fprintln(tw, "\nPrediction")
+		model := ex.Prediction.System
+		if ex.Prediction.Fallback != "" {
+			model = ex.Prediction.Fallback
+		}
+		fmt.Fprintf(tw, "  Model\t%s\n", model)
+		if ex.Prediction.Path != "" {
+			fmt.Fprintf(tw, "  Path\t%s\n", ex.Prediction.Path)
+		}
+		fmt.Fprintf(tw, "  Home\t%s\n", teamName(teams, ex.Prediction.Home))
+		fmt.Fprintf(tw, "  Road\t%s\n", teamName(teams, ex.Prediction.Road))
+		fmt.Fprintf(tw, "  Neutral site\t%t\n", ex.Prediction.NeutralSite)
+		fmt.Fprintf(tw, "  Spread\t%+.1f\n", ex.Prediction.Spread)
+
+		fmt.Fprintln(tw, "\nReconciliation")
+		if len(ex.Reconciliations) == 0 {
+			fmt.Fprintln(tw, "  The slate and the model agree about the home team and the neutral site.")
+		}
+		for _, r := range ex.Reconciliations {
+			fmt.Fprintf(tw, "  %s\n", r)
+		}
+		if ex.HomeAdjustment != 0 {
+			fmt.Fprintf(tw, "  Home field adjustment\t%+.1f\n", ex.HomeAdjustment)
+		}
+
+		home := teamName(teams, ex.Prediction.Home)
+		fmt.Fprintln(tw, "\nProbability")
+		fmt.Fprintf(tw, "  Model bias\t%.3f\n", ex.Bias)
+		fmt.Fprintf(tw, "  Model sigma\t%.3f\n", ex.Sigma)
+		fmt.Fprintf(tw, "  Spread\t%+.1f (%s)\n", ex.ModelSpread, home)
+		fmt.Fprintf(tw, "  Target\t%+.1f (%s)\n", ex.Target, home)
+		fmt.Fprintf(tw, "  P(%s beats target)\tPhi((%.1f - %.1f - %.3f) / %.3f) = Phi(%.3f) = %.3f\n", home, ex.ModelSpread, ex.Target, ex.Bias, ex.Sigma, ex.Z, ex.HomeProbability)
+
+		fmt.Fprintln(tw, "\nPick")
+		pick := teamName(teams, ex.Pick.Pick)
+		if pick == "" {
+			pick = "(not picked)"
+		}
+		fmt.Fprintf(tw, "  Pick\t%s\n", pick)
+		what, prob := "Probability correct", ex.Pick.Confidence()
+		if ex.Type == pickem4me.ExportSuperdog {
+			what, prob = "Probability underdog wins", ex.Pick.PredictedProbability
+		}
+		fmt.Fprintf(tw, "  %s\t%.3f\n", what, prob)
+		for _, note := range ex.Pick.Notes {
+			fmt.Fprintf(tw, "  Note\t%s\n", note)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		if len(ex.Superdogs) == 0 {
+			return nil
+		}
+		fmt.Fprintln(w, "\nSuperdogs")
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  Row\tUnderdog\tOverdog\tValue\tProbability\tEV\t")
+		for _, sd := range ex.Superdogs {
+			mark := ""
+			switch {
+			case sd.Picked:
+				mark = "picked"
+			case sd.Locked:
+				mark = "locked"
+			}
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%d\t%.3f\t%.3f\t%s\n", sd.Row, teamName(teams, sd.Underdog), teamName(teams, sd.Overdog), sd.Value, sd.Probability, sd.ExpectedValue, mark)
+		}
+		return tw.Flush()
+	})
+}
+
+// rankedName returns a human-readable name for the team at a path, with its rank if it is ranked.
+func rankedName(teams *pickem4me.TeamResolver, p string, rank int) string {
+	if rank > 0 {
+		return fmt.Sprintf("#%d %s", rank, teamName(teams, p))
+	}
+	return teamName(teams, p)
+}
+
+// teamName returns a human-readable name for the team at a path.
+func teamName(teams *pickem4me.TeamResolver, p string) string {
+	if p == "" {
+		return ""
+	}
+	if ref, ok := teams.ResolveName(path.Base(p)); ok {
+		return teams.Name(ref)
+	}
+	return path.Base(p)
+}
+
+func diffCommand() *command {
+	o := &pickingOptions{}
+	c := newCommand("diff", "(<picker> <slate> | <picks> <picks>)", "Show how picks would change if a slate were picked again, or how two stored picks differ.", `Given a picker and a slate, the slate is picked without storing anything and compared with the picks most
+recently stored for the picker that week. Given two picks documents, they are compared with each other.
+The exit code is 1 if the picks differ.
+
+Arguments:
+	<picker>
+		(Luke-given) name of picker.
+	<slate>
+		The full Firebase path to the parsed slate.
+	<picks>
+		The full Firebase path to a picks document, such as picks/abc123.`, 2, o.diff)
+	o.addFlags(c.flags)
+	return c
+}
+
+func (o *pickingOptions) diff(ctx context.Context, args []string) error {
+	var from, to *pickem4me.PickSet
+	var err error
+	if strings.Contains(args[0], "/") {
+		if from, err = pickem4me.LoadPicks(ctx, args[0]); err != nil {
+			return err
+		}
+		if to, err = pickem4me.LoadPicks(ctx, args[1]); err != nil {
+			return err
+		}
+	} else {
+		pem, err := o.message(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		if from, err = pickem4me.LatestPicks(ctx, args[0], args[1]); err != nil {
+			return err
+		}
+		if to, err = pickem4me.Preview(ctx, pem); err != nil {
+			return err
+		}
+	}
+	teams, err := pickem4me.LoadTeamResolver(ctx)
+	if err != nil {
+		return err
+	}
+
+	changes := pickem4me.DiffPicks(from, to)
+	if changes == nil {
+		changes = []pickem4me.PickChange{}
+	}
+	err = printResult(changes, func(w io.Writer) error {
+		if len(changes) == 0 {
+			_, err := fmt.Fprintln(w, "No differences")
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "Row\tType\tFrom\tTo")
+		for _, c := range changes {
+			row := strconv.Itoa(c.Row)
+			if c.Type == pickem4me.ExportStreak {
+				row = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", row, c.Type, teamNames(teams, c.From), teamNames(teams, c.To))
+		}
+		return tw.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		return errFindings
+	}
+	return nil
+}
+
+// teamNames names the teams in a comma-separated list of paths, or "-" if there are none.
+func teamNames(teams *pickem4me.TeamResolver, paths string) string {
+	if paths == "" {
+		return "-"
+	}
+	var names []string
+	for _, p := range strings.Split(paths, ",") {
+		names = append(names, teamName(teams, p))
+	}
+	return strings.Join(names, ", ")
+}
+
+// storedPicks loads the picks named by the arguments of a command: either a picks document, or a picker and a slate
+// for the picks most recently stored for the picker that week.
+func storedPicks(ctx context.Context, args []string) (*pickem4me.PickSet, error) {
+	switch len(args) {
+	case 1:
+		return pickem4me.LoadPicks(ctx, args[0])
+	case 2:
+		return pickem4me.LatestPicks(ctx, args[0], args[1])
+	default:
+		return nil, usageError{fmt.Sprintf("expected 1 or 2 arguments, got %d", len(args))}
+	}
+}
+
+const storedPicksHelp = `Arguments:
+	<picks>
+		The full Firebase path to a picks document, such as picks/abc123.
+	<picker> <slate>
+		(Luke-given) name of picker and the full Firebase path to the parsed slate, for the picks most recently
+		stored for the picker in the week of the slate.`
+
+// scoreOptions are the flags of the score command.
+type scoreOptions struct {
+	pickingOptions
+	preview bool
+}
+
+func scoreCommand() *command {
+	o := &scoreOptions{}
+	c := newCommand("score", "(<picks> | <picker> <slate>)", "Compute the expected score of stored picks.", `Every straight-up and noisy spread game picked correctly scores one point, and the picked superdog scores its
+value. With -preview, the slate is picked again without storing anything and those picks are scored instead.
+
+`+storedPicksHelp, -1, o.score)
+	o.addFlags(c.flags)
+	c.flags.BoolVar(&o.preview, "preview", false, "Score picks made now rather than stored picks (requires <picker> <slate>).")
+	return c
+}
+
+func (o *scoreOptions) score(ctx context.Context, args []string) error {
+	var ps *pickem4me.PickSet
+	var err error
+	if o.preview {
+		if len(args) != 2 {
+			return usageError{"-preview requires <picker> <slate>"}
+		}
+		pem, err := o.message(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		ps, err = pickem4me.Preview(ctx, pem)
+		if err != nil {
+			return err
+		}
+	} else if ps, err = storedPicks(ctx, args); err != nil {
+		return err
+	}
+	s := pickem4me.ExpectedScore(ps)
+	return printResult(s, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "Week %d: expected score %.1f ± %.1f out of %d\n", ps.Week, s.Expected, s.StdDev, s.Max)
+		return err
+	})
+}
+
+// exportOptions are the flags of the export command.
+type exportOptions struct {
+	format string
+	stem   string
+}
+
+func exportCommand() *command {
+	o := &exportOptions{}
+	c := newCommand("export", "(<picks> | <picker> <slate>)", "Write stored picks to local files.", storedPicksHelp, -1, o.export)
+	c.flags.StringVar(&o.format, "format", "xlsx,md,html", "Comma-separated list of output formats to write (any of xlsx, json, csv, md, html).")
+	c.flags.StringVar(&o.stem, "o", "", "Name of the files to write, without extension (default: picks-week<week>.)")
+	return c
+}
+
+func (o *exportOptions) export(ctx context.Context, args []string) error {
+	formats, err := pickem4me.ParseFormats(o.format)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	ps, err := storedPicks(ctx, args)
+	if err != nil {
+		return err
+	}
+	stem := o.stem
+	if stem == "" {
+		stem = fmt.Sprintf("picks-week%d", ps.Week)
+	}
+	files, err := pickem4me.WriteFiles(ctx, ps, formats, stem)
+	if err != nil {
+		return err
+	}
+	return printResult(files, func(w io.Writer) error {
+		for _, f := range files {
+			if _, err := fmt.Fprintln(w, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// setPublisher publishes events to a URL or a file, or to standard error so that they do not mix with the result.
+func setPublisher(events string) error {
+	switch {
+	case events == "":
+		return nil
+	case events == "-":
+		pickem4me.SetPublisher(pickem4me.NewWriterPublisher(os.Stderr))
+	case strings.HasPrefix(events, "http://") || strings.HasPrefix(events, "https://"):
+		pickem4me.SetPublisher(&pickem4me.HTTPPublisher{URL: events})
+	default:
+		f, err := os.OpenFile(events, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed opening event file: %v", err)
+		}
+		pickem4me.SetPublisher(pickem4me.NewWriterPublisher(f))
+	}
+	return nil
+}
+
+// setTelemetryExporter exports telemetry to a file, or to standard error so that it does not mix with the result.
+func setTelemetryExporter(telemetry string) error {
+	switch telemetry {
+	case "":
+		return nil
+	case "-":
+		pickem4me.SetTelemetryExporter(pickem4me.NewWriterExporter(os.Stderr))
+	default:
+		// Fail before picking rather than when the run is exported.
+		f, err := os.OpenFile(telemetry, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed opening telemetry file: %v", err)
+		}
+		f.Close()
+		pickem4me.SetTelemetryExporter(pickem4me.NewFileExporter(telemetry))
+	}
+	return nil
+}
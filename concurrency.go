@@ -0,0 +1,63 @@
+package pickem4me
+
+import (
+	"context"
+	"sync"
+)
+
+// maxConcurrentReads is the largest number of Firestore reads made at once.
+const maxConcurrentReads = 8
+
+// group runs functions concurrently with bounded parallelism.
+// The first function to fail cancels the context shared by all of the functions in the group.
+type group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+// newGroup makes a group that runs at most limit functions at once.
+func newGroup(ctx context.Context, limit int) *group {
+	ctx, cancel := context.WithCancel(ctx)
+	return &group{
+		ctx:    ctx,
+		cancel: cancel,
+		sem:    make(chan struct{}, limit),
+	}
+}
+
+// Go runs f in a new goroutine once a slot is free.
+// If the group has already been cancelled, f is not run.
+func (g *group) Go(f func(ctx context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		select {
+		case g.sem <- struct{}{}:
+		case <-g.ctx.Done():
+			g.fail(g.ctx.Err())
+			return
+		}
+		defer func() { <-g.sem }()
+		if err := f(g.ctx); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Wait waits for every function in the group to return, then returns the first error.
+func (g *group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
+
+func (g *group) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
@@ -0,0 +1,76 @@
+package pickem4me
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	errFirst := errors.New("first")
+	tests := []struct {
+		name    string
+		limit   int
+		n       int
+		failAt  int // index of the function that fails, or -1
+		wantErr error
+	}{
+		{"all succeed", 2, 10, -1, nil},
+		{"one at a time", 1, 5, -1, nil},
+		{"first error returned", 3, 10, 4, errFirst},
+		{"no functions", 2, 0, -1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGroup(context.Background(), tt.limit)
+			var running, maxRunning, ran int32
+			for i := 0; i < tt.n; i++ {
+				i := i
+				g.Go(func(ctx context.Context) error {
+					n := atomic.AddInt32(&running, 1)
+					defer atomic.AddInt32(&running, -1)
+					for {
+						m := atomic.LoadInt32(&maxRunning)
+						if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+							break
+						}
+					}
+					atomic.AddInt32(&ran, 1)
+					if i == tt.failAt {
+						return errFirst
+					}
+					return nil
+				})
+			}
+			if err := g.Wait(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if maxRunning > int32(tt.limit) {
+				t.Errorf("expected at most %d functions at once, got %d", tt.limit, maxRunning)
+			}
+			if tt.wantErr == nil && ran != int32(tt.n) {
+				t.Errorf("expected %d functions to run, got %d", tt.n, ran)
+			}
+		})
+	}
+}
+
+func TestGroupFailureCancels(t *testing.T) {
+	errFirst := errors.New("first")
+	g := newGroup(context.Background(), 2)
+	started := make(chan struct{})
+	g.Go(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-started
+	g.Go(func(ctx context.Context) error { return errFirst })
+	if err := g.Wait(); err != errFirst {
+		t.Errorf("expected the first error, got %v", err)
+	}
+	if g.ctx.Err() == nil {
+		t.Errorf("expected the group context to be cancelled")
+	}
+}
@@ -0,0 +1,117 @@
+package pickem4me
+
+import (
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Late policies tell PickEm what to do when it runs after the pick deadline.
+const (
+	// LateRefuse refuses to make any picks after the deadline.
+	LateRefuse = "refuse"
+
+	// LateUnstarted makes picks after the deadline, but locks games that have already started.
+	// The picks already stored for locked games are kept: only games that have not started are picked anew.
+	LateUnstarted = "unstarted"
+)
+
+// now returns the current time. It is a variable so that it can be replaced when testing.
+var now = time.Now
+
+// slateSchedule is the optional pick deadline stored in a slate document.
+type slateSchedule struct {
+	// Deadline is the time after which picks for the slate can no longer be submitted (zero if unknown).
+	Deadline time.Time `firestore:"deadline"`
+}
+
+// gameSchedule is the optional kickoff time stored in a slate's game document.
+type gameSchedule struct {
+	// Kickoff is when the game starts (zero if unknown).
+	Kickoff time.Time `firestore:"kickoff"`
+}
+
+// schedule holds what is known about the timing of a slate.
+type schedule struct {
+	// deadline is the pick deadline for the slate (zero if there is none).
+	deadline time.Time
+
+	// kickoffs are the kickoff times of the games in the slate, keyed by slate row (zero if unknown).
+	kickoffs map[int]time.Time
+}
+
+// readSchedule reads the pick deadline of a slate and the kickoff times of its games from their documents.
+// The cutoff, if not nil, overrides the deadline of the slate.
+// If neither a cutoff nor a slate deadline is given, the earliest known kickoff is the deadline.
+func readSchedule(slateDoc *firestore.DocumentSnapshot, gameDocs []*firestore.DocumentSnapshot, rows []int, cutoff *time.Time) (*schedule, error) {
+	var ss slateSchedule
+	if err := slateDoc.DataTo(&ss); err != nil {
+		return nil, newError(KindInconsistent, "failed parsing deadline of slate '%s': %v", slateDoc.Ref.ID, err)
+	}
+	s := &schedule{
+		deadline: ss.Deadline,
+		kickoffs: make(map[int]time.Time),
+	}
+	var earliest time.Time
+	for i, doc := range gameDocs {
+		var gs gameSchedule
+		if err := doc.DataTo(&gs); err != nil {
+			return nil, newError(KindInconsistent, "failed parsing kickoff of game '%s': %v", doc.Ref.ID, err)
+		}
+		s.kickoffs[rows[i]] = gs.Kickoff
+		if !gs.Kickoff.IsZero() && (earliest.IsZero() || gs.Kickoff.Before(earliest)) {
+			earliest = gs.Kickoff
+		}
+	}
+	if cutoff != nil {
+		s.deadline = *cutoff
+	}
+	if s.deadline.IsZero() {
+		s.deadline = earliest
+	}
+	return s, nil
+}
+
+// passed reports whether the deadline has passed at time t.
+func (s *schedule) passed(t time.Time) bool {
+	return !s.deadline.IsZero() && !t.Before(s.deadline)
+}
+
+// locked returns the slate rows of games that are locked at time t.
+// Games with a known kickoff are locked once they have started.
+// Games without a known kickoff are locked once the deadline has passed.
+func (s *schedule) locked(t time.Time) map[int]bool {
+	locked := make(map[int]bool)
+	for row, kickoff := range s.kickoffs {
+		if kickoff.IsZero() {
+			if s.passed(t) {
+				locked[row] = true
+			}
+			continue
+		}
+		if !t.Before(kickoff) {
+			locked[row] = true
+		}
+	}
+	return locked
+}
+
+// enforceDeadline applies the late policy to the schedule at time t and returns the rows of games that are locked.
+// It returns an error if the picks should not be made at all.
+func enforceDeadline(s *schedule, policy string, t time.Time) (map[int]bool, error) {
+	if !s.passed(t) {
+		return s.locked(t), nil
+	}
+	switch policy {
+	case "", LateRefuse:
+		return nil, newError(KindDeadlinePassed, "pick deadline %s has passed", s.deadline.Format(time.RFC3339))
+	case LateUnstarted:
+		locked := s.locked(t)
+		if len(locked) == len(s.kickoffs) {
+			return nil, newError(KindDeadlinePassed, "pick deadline %s has passed and every game has started", s.deadline.Format(time.RFC3339))
+		}
+		return locked, nil
+	default:
+		return nil, newError(KindInvalidInput, "unknown late policy '%s'", policy)
+	}
+}
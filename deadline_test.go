@@ -0,0 +1,60 @@
+package pickem4me
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnforceDeadline(t *testing.T) {
+	t0 := time.Date(2021, 10, 2, 12, 0, 0, 0, time.UTC)
+	s := &schedule{
+		deadline: t0,
+		kickoffs: map[int]time.Time{
+			1: t0.Add(-time.Hour), // Friday night
+			2: t0.Add(time.Hour),
+			3: {}, // unknown kickoff
+		},
+	}
+	none := &schedule{kickoffs: map[int]time.Time{1: {}}}
+	allStarted := &schedule{
+		deadline: t0,
+		kickoffs: map[int]time.Time{1: t0, 2: t0.Add(time.Hour)},
+	}
+
+	tests := []struct {
+		name    string
+		s       *schedule
+		policy  string
+		t       time.Time
+		want    map[int]bool
+		wantErr ErrorKind
+	}{
+		{"before deadline", s, "", t0.Add(-2 * time.Hour), map[int]bool{}, KindUnknown},
+		{"before deadline after a kickoff", s, LateRefuse, t0.Add(-time.Minute), map[int]bool{1: true}, KindUnknown},
+		{"at deadline refused", s, "", t0, nil, KindDeadlinePassed},
+		{"after deadline refused", s, LateRefuse, t0.Add(time.Minute), nil, KindDeadlinePassed},
+		{"after deadline unstarted", s, LateUnstarted, t0.Add(time.Minute), map[int]bool{1: true, 3: true}, KindUnknown},
+		{"after every kickoff unstarted", s, LateUnstarted, t0.Add(2 * time.Hour), nil, KindDeadlinePassed},
+		{"every game started", allStarted, LateUnstarted, t0.Add(time.Hour), nil, KindDeadlinePassed},
+		{"no deadline", none, "", t0, map[int]bool{}, KindUnknown},
+		{"unknown policy", s, "whenever", t0.Add(time.Minute), nil, KindInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := enforceDeadline(tt.s, tt.policy, tt.t)
+			if tt.wantErr != KindUnknown {
+				if err == nil || KindOf(err) != tt.wantErr {
+					t.Fatalf("expected %s error, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("enforceDeadline: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected locked rows %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package pickem4me
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// Mail is an email message with attachments.
+type Mail struct {
+	From        string
+	To          []string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a Mail.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Sender delivers mail.
+type Sender interface {
+	Send(ctx context.Context, m *Mail) error
+}
+
+// SMTPSender delivers mail through an SMTP server.
+// STARTTLS is used if the server supports it, so a plain local SMTP server works for testing.
+type SMTPSender struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+
+	// Auth is used to authenticate with the server, which must support authentication (nil means no authentication).
+	Auth smtp.Auth
+}
+
+// NewSMTPSenderFromEnv makes an SMTPSender from the SMTP_ADDR, SMTP_USERNAME, and SMTP_PASSWORD environment variables.
+// It returns nil if SMTP_ADDR is not set, and an error if SMTP_FROM, the address picks are sent from, is not.
+func NewSMTPSenderFromEnv() (*SMTPSender, error) {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	if strings.TrimSpace(os.Getenv("SMTP_FROM")) == "" {
+		return nil, newError(KindInvalidInput, "SMTP_ADDR is set but SMTP_FROM is not")
+	}
+	s := &SMTPSender{Addr: addr}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		s.Auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return s, nil
+}
+
+// Send sends the mail.
+func (s *SMTPSender) Send(ctx context.Context, m *Mail) error {
+	msg, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("bad SMTP address '%s': %v", s.Addr, err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed connecting to SMTP server '%s': %v", s.Addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed starting SMTP session: %v", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("failed starting TLS: %v", err)
+		}
+	}
+	if s.Auth != nil {
+		// Sending without the credentials that were configured would only fail later, or relay unauthenticated.
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("SMTP server '%s' does not support authentication", s.Addr)
+		}
+		if err := c.Auth(s.Auth); err != nil {
+			return fmt.Errorf("failed authenticating: %v", err)
+		}
+	}
+	if err := c.Mail(m.From); err != nil {
+		return fmt.Errorf("failed setting sender '%s': %v", m.From, err)
+	}
+	for _, to := range m.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("failed adding recipient '%s': %v", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("failed starting message: %v", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed writing message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed sending message: %v", err)
+	}
+	return c.Quit()
+}
+
+// Bytes renders the mail as a MIME multipart message.
+func (m *Mail) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write([]byte(m.Body)); err != nil {
+		return nil, err
+	}
+
+	for _, a := range m.Attachments {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		enc := base64.StdEncoding.EncodeToString(a.Data)
+		for len(enc) > 76 {
+			if _, err := fmt.Fprintf(part, "%s\r\n", enc[:76]); err != nil {
+				return nil, err
+			}
+			enc = enc[76:]
+		}
+		if _, err := fmt.Fprintf(part, "%s\r\n", enc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pickerProfile holds the delivery settings stored in a picker document alongside the picker itself.
+type pickerProfile struct {
+	// Recipients are the email addresses that receive the picker's filled slate.
+	Recipients []string `firestore:"recipients"`
+}
+
+// Delivery statuses recorded in the picks document.
+const (
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+	DeliverySkipped = "skipped"
+)
+
+// deliveryStatus records the outcome of delivering picks.
+type deliveryStatus struct {
+	Status     string    `firestore:"status"`
+	Recipients []string  `firestore:"recipients"`
+	Time       time.Time `firestore:"time"`
+	Error      string    `firestore:"error,omitempty"`
+}
+
+// deliver emails the filled slate to the recipients and records the outcome in the picks document.
+// A failed send is logged and recorded but not returned: only failing to record the outcome is an error.
+// If dryRun is true, the mail is logged but not sent, and nothing is recorded.
+func deliver(ctx context.Context, ps *PickSet, picker bpefs.Picker, fileName string, recipients []string, picksRef *firestore.DocumentRef, dryRun bool) error {
+	if len(recipients) == 0 {
+		logFrom(ctx).Infof("Picker '%s' has no recipients: not delivering picks", picker.LukeName)
+		return nil
+	}
+
+	status := deliveryStatus{
+		Recipients: recipients,
+		Time:       time.Now(),
+	}
+
+	if mailer == nil && !dryRun {
+		logFrom(ctx).Warnf("No mail sender configured: not delivering picks to %v", recipients)
+		status.Status = DeliverySkipped
+		if _, err := picksRef.Update(ctx, []firestore.Update{{Path: "delivery", Value: status}}); err != nil {
+			return backendError(err, "failed recording delivery status")
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	xlsx := outputFormats["xlsx"]
+	if err := xlsx.write(ctx, &buf, ps); err != nil {
+		return fmt.Errorf("failed making slate attachment: %w", err)
+	}
+	m := &Mail{
+		From:    mailFrom,
+		To:      recipients,
+		Subject: fmt.Sprintf("Week %d picks for %s", ps.Week, picker.Name),
+		Body:    fmt.Sprintf("Attached are %s's picks for week %d.\r\n", picker.Name, ps.Week),
+		Attachments: []Attachment{{
+			Name:        fileName,
+			ContentType: xlsx.contentType,
+			Data:        buf.Bytes(),
+		}},
+	}
+
+	if dryRun {
+		logFrom(ctx).Infof("DRYRUN: would send '%s' from '%s' to %v with attachment '%s'", m.Subject, m.From, m.To, fileName)
+		return nil
+	}
+
+	sendErr := mailer.Send(ctx, m)
+	if sendErr != nil {
+		logFrom(ctx).Errorf("Failed delivering picks to %v: %v", recipients, sendErr)
+		status.Status = DeliveryFailed
+		status.Error = sendErr.Error()
+	} else {
+		logFrom(ctx).Infof("Delivered picks to %v", recipients)
+		status.Status = DeliverySent
+	}
+	if _, err := picksRef.Update(ctx, []firestore.Update{{Path: "delivery", Value: status}}); err != nil {
+		return backendError(err, "failed recording delivery status")
+	}
+	// The picks are already stored and written, so a failed send is recorded rather than failing the run.
+	return nil
+}
@@ -0,0 +1,269 @@
+package pickem4me
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+func TestMailBytes(t *testing.T) {
+	data := bytes.Repeat([]byte{0, 1, 2, 250, 251, 252}, 40) // longer than one line of base64
+	m := &Mail{
+		From:    "picks@example.com",
+		To:      []string{"luke@example.com", "leia@example.com"},
+		Subject: "Week 5 picks für Luke",
+		Body:    "Attached are Luke's picks for week 5.\r\n",
+		Attachments: []Attachment{
+			{Name: "LUKE week 5.xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Data: data},
+			{Name: "picks.json", ContentType: "application/json", Data: []byte(`{"week":5}`)},
+		},
+	}
+	b, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("expected a mail message, got %v", err)
+	}
+	if got := msg.Header.Get("To"); got != "luke@example.com, leia@example.com" {
+		t.Errorf("expected both recipients, got '%s'", got)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != m.Subject {
+		t.Errorf("expected subject '%s', got '%s' (%v)", m.Subject, subject, err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" || params["boundary"] == "" {
+		t.Fatalf("expected multipart/mixed with a boundary, got %s %v (%v)", mediaType, params, err)
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	body, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("expected a body part, got %v", err)
+	}
+	if b, _ := io.ReadAll(body); string(b) != m.Body {
+		t.Errorf("expected body %q, got %q", m.Body, b)
+	}
+	for _, want := range m.Attachments {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("expected attachment '%s', got %v", want.Name, err)
+		}
+		if part.FileName() != want.Name || part.Header.Get("Content-Type") != want.ContentType {
+			t.Errorf("expected '%s' as %s, got '%s' as %s", want.Name, want.ContentType, part.FileName(), part.Header.Get("Content-Type"))
+		}
+		if enc := part.Header.Get("Content-Transfer-Encoding"); enc != "base64" {
+			t.Errorf("expected base64 encoding, got '%s'", enc)
+		}
+		raw, _ := io.ReadAll(part)
+		for _, line := range strings.Split(strings.TrimRight(string(raw), "\r\n"), "\r\n") {
+			if len(line) > 76 {
+				t.Errorf("expected base64 lines of at most 76 characters, got %d", len(line))
+			}
+		}
+		got, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+		if err != nil || !bytes.Equal(got, want.Data) {
+			t.Errorf("expected attachment '%s' to decode to its data, got %v (%v)", want.Name, got, err)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected the closing boundary after the attachments, got %v", err)
+	}
+}
+
+// fakeSender records the mail it is asked to send.
+type fakeSender struct {
+	sent []*Mail
+	err  error
+}
+
+func (s *fakeSender) Send(ctx context.Context, m *Mail) error {
+	s.sent = append(s.sent, m)
+	return s.err
+}
+
+func TestDeliver(t *testing.T) {
+	oldMailer, oldFrom := mailer, mailFrom
+	mailFrom = "picks@example.com"
+	t.Cleanup(func() { mailer, mailFrom = oldMailer, oldFrom })
+
+	picker := bpefs.Picker{Name: "Luke", LukeName: "LUKE"}
+	tests := []struct {
+		name       string
+		recipients []string
+		dryRun     bool
+		sendErr    error
+		wantSent   bool
+		wantErr    bool
+	}{
+		{"no recipients", nil, false, nil, false, false},
+		{"dry run", []string{"luke@example.com"}, true, nil, false, false},
+		// Without a database, recording the outcome fails after the mail is sent.
+		{"sent", []string{"luke@example.com"}, false, nil, true, true},
+		{"send fails", []string{"luke@example.com"}, false, errors.New("mailbox full"), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeSender{err: tt.sendErr}
+			SetSender(s)
+			ctx, cancel := context.WithCancel(context.Background())
+			if !tt.dryRun {
+				cancel()
+			}
+			defer cancel()
+
+			err := deliver(ctx, &PickSet{Week: 5}, picker, "LUKE week 5.xlsx", tt.recipients, testClient.Doc("picks/1"), tt.dryRun)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %t, got %v", tt.wantErr, err)
+			}
+			if !tt.wantSent {
+				if len(s.sent) != 0 {
+					t.Errorf("expected nothing sent, got %+v", s.sent)
+				}
+				return
+			}
+			if len(s.sent) != 1 {
+				t.Fatalf("expected one mail, got %d", len(s.sent))
+			}
+			m := s.sent[0]
+			if m.From != "picks@example.com" || m.Subject != "Week 5 picks for Luke" || len(m.To) != 1 || m.To[0] != "luke@example.com" {
+				t.Errorf("expected week 5 picks from picks@example.com to luke@example.com, got %+v", m)
+			}
+			if len(m.Attachments) != 1 || m.Attachments[0].Name != "LUKE week 5.xlsx" || len(m.Attachments[0].Data) == 0 {
+				t.Errorf("expected the filled slate attached, got %+v", m.Attachments)
+			}
+		})
+	}
+}
+
+func TestNewSMTPSenderFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		addr     string
+		from     string
+		username string
+		wantNil  bool
+		wantAuth bool
+		wantErr  bool
+	}{
+		{"not configured", "", "", "", true, false, false},
+		{"no from", "localhost:25", "", "", true, false, true},
+		{"blank from", "localhost:25", " ", "", true, false, true},
+		{"no username", "localhost:25", "picks@example.com", "", false, false, false},
+		{"username", "localhost:25", "picks@example.com", "luke", false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMTP_ADDR", tt.addr)
+			t.Setenv("SMTP_FROM", tt.from)
+			t.Setenv("SMTP_USERNAME", tt.username)
+			s, err := NewSMTPSenderFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %t, got %v", tt.wantErr, err)
+			}
+			if (s == nil) != tt.wantNil {
+				t.Fatalf("expected nil sender %t, got %+v", tt.wantNil, s)
+			}
+			if s != nil && (s.Auth != nil) != tt.wantAuth {
+				t.Errorf("expected authentication %t, got %v", tt.wantAuth, s.Auth)
+			}
+		})
+	}
+}
+
+// serveSMTP answers one SMTP session that advertises the given extensions and accepts every command.
+func serveSMTP(t *testing.T, extensions ...string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		io.WriteString(conn, "220 localhost ready\r\n")
+		data := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case data:
+				if cmd == "." {
+					data = false
+					io.WriteString(conn, "250 queued\r\n")
+				}
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply := "250-localhost\r\n"
+				for _, ext := range extensions {
+					reply += "250-" + ext + "\r\n"
+				}
+				io.WriteString(conn, reply+"250 HELP\r\n")
+			case cmd == "DATA":
+				data = true
+				io.WriteString(conn, "354 go ahead\r\n")
+			case cmd == "QUIT":
+				io.WriteString(conn, "221 bye\r\n")
+				return
+			case strings.HasPrefix(cmd, "AUTH"):
+				io.WriteString(conn, "235 authenticated\r\n")
+			default:
+				io.WriteString(conn, "250 ok\r\n")
+			}
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestSMTPSenderSend(t *testing.T) {
+	m := &Mail{From: "picks@example.com", To: []string{"luke@example.com"}, Subject: "Week 5 picks", Body: "Picks."}
+	tests := []struct {
+		name       string
+		extensions []string
+		auth       bool
+		wantErr    string
+	}{
+		{"no authentication", nil, false, ""},
+		{"authentication", []string{"AUTH PLAIN"}, true, ""},
+		{"authentication not supported", nil, true, "does not support authentication"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SMTPSender{Addr: serveSMTP(t, tt.extensions...)}
+			if tt.auth {
+				// Plain authentication is allowed without TLS only on the loopback address.
+				s.Auth = smtp.PlainAuth("", "luke", "secret", "127.0.0.1")
+			}
+			err := s.Send(context.Background(), m)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Send: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
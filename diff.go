@@ -0,0 +1,66 @@
+package pickem4me
+
+import (
+	"sort"
+	"strings"
+)
+
+// PickChange is a game whose pick differs between two pick sets.
+type PickChange struct {
+	// Row is the slate row of the game (zero for the streak pick).
+	Row int `json:"row"`
+
+	// Type is the type of pick, as in exports: "straight_up", "noisy_spread", "superdog", or "streak".
+	Type string `json:"type"`
+
+	// From is the path to the team picked in the first pick set (empty if the game was not picked).
+	// Streak picks of more than one team are comma-separated.
+	From string `json:"from"`
+
+	// To is the path to the team picked in the second pick set (empty if the game was not picked).
+	To string `json:"to"`
+}
+
+// DiffPicks returns the games whose picks differ between two pick sets, ordered by slate row.
+// Games in only one of the pick sets are compared with an unpicked game.
+func DiffPicks(from, to *PickSet) []PickChange {
+	type pick struct {
+		kind string
+		team string
+	}
+	picksByRow := func(ps *PickSet) map[int]pick {
+		m := make(map[int]pick)
+		for _, g := range ps.Export().Games {
+			m[g.Row] = pick{g.Type, g.Pick}
+		}
+		return m
+	}
+	a, b := picksByRow(from), picksByRow(to)
+
+	var changes []PickChange
+	for row, pa := range a {
+		pb := b[row]
+		if pa.team != pb.team {
+			changes = append(changes, PickChange{Row: row, Type: pa.kind, From: pa.team, To: pb.team})
+		}
+	}
+	for row, pb := range b {
+		if _, ok := a[row]; !ok && pb.team != "" {
+			changes = append(changes, PickChange{Row: row, Type: pb.kind, To: pb.team})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Row < changes[j].Row })
+
+	if sa, sb := streakTeams(from), streakTeams(to); sa != sb {
+		changes = append(changes, PickChange{Type: ExportStreak, From: sa, To: sb})
+	}
+	return changes
+}
+
+// streakTeams returns the paths of the teams in the streak pick of a pick set, comma-separated.
+func streakTeams(ps *PickSet) string {
+	if ps.Streak == nil {
+		return ""
+	}
+	return strings.Join(refPaths(ps.Streak.Picks), ",")
+}
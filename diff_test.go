@@ -0,0 +1,75 @@
+package pickem4me
+
+import (
+	"reflect"
+	"testing"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+func TestDiffPicks(t *testing.T) {
+	picks := func(su1, ns3, dog string, streak ...string) *PickSet {
+		ps := &PickSet{
+			StraightUp:  []*bpefs.StraightUpPick{{Row: 1, HomeTeam: teamRef("iowa"), AwayTeam: teamRef("michigan")}},
+			NoisySpread: []*bpefs.NoisySpreadPick{{Row: 3, HomeTeam: teamRef("wisconsin"), AwayTeam: teamRef("minnesota")}},
+			Superdog:    []*bpefs.SuperDogPick{{Row: 6, Underdog: teamRef("purdue"), Overdog: teamRef("indiana")}},
+		}
+		if su1 != "" {
+			ps.StraightUp[0].Pick = teamRef(su1)
+		}
+		if ns3 != "" {
+			ps.NoisySpread[0].Pick = teamRef(ns3)
+		}
+		if dog != "" {
+			ps.Superdog[0].Pick = teamRef(dog)
+		}
+		if len(streak) > 0 {
+			ps.Streak = &bpefs.StreakPick{}
+			for _, team := range streak {
+				ps.Streak.Picks = append(ps.Streak.Picks, teamRef(team))
+			}
+		}
+		return ps
+	}
+	base := picks("iowa", "minnesota", "purdue", "wisconsin")
+	extra := picks("iowa", "minnesota", "purdue", "wisconsin")
+	extra.StraightUp = append(extra.StraightUp, &bpefs.StraightUpPick{Row: 2, HomeTeam: teamRef("ohio-state"), AwayTeam: teamRef("penn-state"), Pick: teamRef("penn-state")})
+	unpickedExtra := picks("iowa", "minnesota", "purdue", "wisconsin")
+	unpickedExtra.Superdog = append(unpickedExtra.Superdog, &bpefs.SuperDogPick{Row: 7, Underdog: teamRef("illinois"), Overdog: teamRef("maryland")})
+
+	tests := []struct {
+		name     string
+		from, to *PickSet
+		want     []PickChange
+	}{
+		{"same picks", base, picks("iowa", "minnesota", "purdue", "wisconsin"), nil},
+		{"changed picks in row order", base, picks("michigan", "wisconsin", "purdue", "wisconsin"), []PickChange{
+			{Row: 1, Type: ExportStraightUp, From: "teams/iowa", To: "teams/michigan"},
+			{Row: 3, Type: ExportNoisySpread, From: "teams/minnesota", To: "teams/wisconsin"},
+		}},
+		{"superdog unpicked", base, picks("iowa", "minnesota", "", "wisconsin"), []PickChange{
+			{Row: 6, Type: ExportSuperdog, From: "teams/purdue"},
+		}},
+		{"streak changed", base, picks("iowa", "minnesota", "purdue", "iowa", "ohio-state"), []PickChange{
+			{Type: ExportStreak, From: "teams/wisconsin", To: "teams/iowa,teams/ohio-state"},
+		}},
+		{"streak removed", base, picks("iowa", "minnesota", "purdue"), []PickChange{
+			{Type: ExportStreak, From: "teams/wisconsin"},
+		}},
+		{"game only in the first", extra, base, []PickChange{
+			{Row: 2, Type: ExportStraightUp, From: "teams/penn-state"},
+		}},
+		{"game only in the second", base, extra, []PickChange{
+			{Row: 2, Type: ExportStraightUp, To: "teams/penn-state"},
+		}},
+		{"unpicked game only in the second", base, unpickedExtra, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffPicks(tt.from, tt.to)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
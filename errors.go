@@ -0,0 +1,262 @@
+package pickem4me
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorKind classifies a failure so that callers can tell retryable failures from permanent ones.
+type ErrorKind int
+
+// Kinds of failure.
+const (
+	// KindUnknown is a failure that could not be classified. It is not retried.
+	KindUnknown ErrorKind = iota
+
+	// KindInvalidInput is a malformed or invalid request.
+	KindInvalidInput
+
+	// KindNotFound is a request for a slate, picker, model, or other document that does not exist.
+	KindNotFound
+
+	// KindInconsistent is data in Firestore that cannot be picked as it is, such as an unparsable document or a slate
+	// that disagrees with the model when the policy is to fail.
+	KindInconsistent
+
+	// KindTransient is a failure of a backend that might succeed if retried.
+	KindTransient
+
+	// KindDeadlinePassed is a request to pick a slate after its pick deadline.
+	KindDeadlinePassed
+)
+
+// String names the kind of failure.
+func (k ErrorKind) String() string {
+	switch k {
+	case KindInvalidInput:
+		return "invalid_input"
+	case KindNotFound:
+		return "not_found"
+	case KindInconsistent:
+		return "data_inconsistency"
+	case KindTransient:
+		return "transient"
+	case KindDeadlinePassed:
+		return "deadline_passed"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is a failure of a known kind.
+type Error struct {
+	// Kind is the kind of failure.
+	Kind ErrorKind
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the message of the underlying error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the failure might not happen again if the request is retried.
+func (e *Error) Retryable() bool {
+	return e.Kind == KindTransient
+}
+
+// GRPCStatus converts the failure to a gRPC status, so that status.Code works with it.
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(grpcCodes[e.Kind], e.Error())
+}
+
+// grpcCodes are the gRPC codes of each kind of failure.
+var grpcCodes = map[ErrorKind]codes.Code{
+	KindUnknown:        codes.Unknown,
+	KindInvalidInput:   codes.InvalidArgument,
+	KindNotFound:       codes.NotFound,
+	KindInconsistent:   codes.FailedPrecondition,
+	KindTransient:      codes.Unavailable,
+	KindDeadlinePassed: codes.FailedPrecondition,
+}
+
+// KindOf returns the kind of a failure.
+// Errors that are not of type Error are classified by their gRPC code or, for Cloud Storage, their HTTP status.
+func KindOf(err error) ErrorKind {
+	if err == nil {
+		return KindUnknown
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return KindTransient
+	}
+	if errors.Is(err, iterator.Done) {
+		return KindNotFound
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return kindOfHTTPStatus(gerr.Code)
+	}
+	return kindOfCode(status.Code(err))
+}
+
+// IsRetryable reports whether a failure might not happen again if the request is retried.
+func IsRetryable(err error) bool {
+	return KindOf(err) == KindTransient
+}
+
+// kindOfCode classifies a gRPC code returned by Firestore.
+func kindOfCode(code codes.Code) ErrorKind {
+	switch code {
+	case codes.InvalidArgument, codes.OutOfRange:
+		return KindInvalidInput
+	case codes.NotFound:
+		return KindNotFound
+	case codes.FailedPrecondition:
+		return KindInconsistent
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.ResourceExhausted, codes.Internal:
+		return KindTransient
+	default:
+		return KindUnknown
+	}
+}
+
+// kindOfHTTPStatus classifies an HTTP status returned by Cloud Storage.
+func kindOfHTTPStatus(code int) ErrorKind {
+	switch {
+	case code == http.StatusBadRequest:
+		return KindInvalidInput
+	case code == http.StatusNotFound:
+		return KindNotFound
+	case code == http.StatusPreconditionFailed:
+		return KindInconsistent
+	case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests, code >= http.StatusInternalServerError:
+		return KindTransient
+	default:
+		return KindUnknown
+	}
+}
+
+// newError makes a failure of the given kind.
+func newError(kind ErrorKind, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// backendError describes a failed call to Firestore or Cloud Storage, classifying it by its gRPC code or HTTP status.
+// Queries that find nothing (iterator.Done) are classified as not found.
+func backendError(err error, format string, args ...interface{}) error {
+	return &Error{Kind: KindOf(err), Err: fmt.Errorf(format+": %v", append(args, err)...)}
+}
+
+// httpStatus returns the HTTP status code that best describes a failure.
+func httpStatus(err error) int {
+	switch KindOf(err) {
+	case KindInvalidInput:
+		return http.StatusBadRequest
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindInconsistent:
+		return http.StatusUnprocessableEntity
+	case KindDeadlinePassed:
+		return http.StatusConflict
+	case KindTransient:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// validDocPath reports whether a path names a Firestore document, such as "collection/doc/subcollection/doc".
+func validDocPath(p string) bool {
+	parts := strings.Split(p, "/")
+	if len(parts)%2 != 0 {
+		return false
+	}
+	for _, part := range parts {
+		if part == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMessage validates a message before anything is read from Firestore.
+// Every problem with the message is reported in one invalid input error.
+func checkMessage(pem PickEmMessage) error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if pem.Slate == "" {
+		add("no slate given")
+	} else if !validDocPath(pem.Slate) {
+		add("slate '%s' is not a document path", pem.Slate)
+	}
+	if strings.TrimSpace(pem.Picker) == "" {
+		add("no picker given")
+	}
+	models := []struct{ name, path string }{
+		{"straight-up model", pem.StraightModel},
+		{"noisy spread model", pem.NoisySpreadModel},
+		{"superdog model", pem.SuperdogModel},
+		{"fallback model", pem.FallbackModel},
+	}
+	for _, m := range models {
+		if m.path != "" && !validDocPath(m.path) {
+			add("%s '%s' is not a document path", m.name, m.path)
+		}
+	}
+	for _, format := range pem.Formats {
+		if _, ok := outputFormats[format]; !ok {
+			add("unknown output format '%s'", format)
+		}
+	}
+	switch pem.LatePolicy {
+	case "", LateRefuse, LateUnstarted:
+	default:
+		add("unknown late policy '%s'", pem.LatePolicy)
+	}
+	if _, err := newReconcilePolicies(pem.SwapPolicy, pem.NeutralPolicy); err != nil {
+		add("%v", err)
+	}
+	aliases := make([]string, 0, len(pem.TeamAliases))
+	for alias := range pem.TeamAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		if id := pem.TeamAliases[alias]; strings.TrimSpace(alias) == "" || id == "" || strings.Contains(id, "/") {
+			add("team alias '%s' for '%s' is not an alias and a team document ID", alias, id)
+		}
+	}
+	if pem.Overrides != nil {
+		for _, problem := range pem.Overrides.problems() {
+			add("%s", problem)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return newError(KindInvalidInput, "invalid message: %s", strings.Join(problems, "; "))
+}
@@ -0,0 +1,178 @@
+package pickem4me
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCheckMessage(t *testing.T) {
+	valid := PickEmMessage{Slate: "seasons/2021/weeks/5/slates/1", Picker: "LUKE"}
+	with := func(f func(*PickEmMessage)) PickEmMessage {
+		pem := valid
+		f(&pem)
+		return pem
+	}
+
+	tests := []struct {
+		name         string
+		pem          PickEmMessage
+		wantProblems []string
+	}{
+		{"valid", valid, nil},
+		{"valid with everything", with(func(pem *PickEmMessage) {
+			pem.StraightModel = "prediction_tracker/1/model_performance/line"
+			pem.Formats = []string{"json", "csv"}
+			pem.LatePolicy = LateUnstarted
+			pem.SwapPolicy = TrustSlate
+			pem.TeamAliases = map[string]string{"Hawks": "iowa"}
+		}), nil},
+		{"empty", PickEmMessage{}, []string{"no slate given", "no picker given"}},
+		{"blank picker", with(func(pem *PickEmMessage) { pem.Picker = "  " }), []string{"no picker given"}},
+		{"slate collection", with(func(pem *PickEmMessage) { pem.Slate = "seasons/2021/weeks" }), []string{"slate 'seasons/2021/weeks' is not a document path"}},
+		{"slate with empty part", with(func(pem *PickEmMessage) { pem.Slate = "seasons//weeks/5" }), []string{"is not a document path"}},
+		{"bad models", with(func(pem *PickEmMessage) {
+			pem.SuperdogModel = "line"
+			pem.FallbackModel = "a/b/c"
+		}), []string{"superdog model 'line'", "fallback model 'a/b/c'"}},
+		{"unknown format", with(func(pem *PickEmMessage) { pem.Formats = []string{"xlsx", "pdf"} }), []string{"unknown output format 'pdf'"}},
+		{"unknown late policy", with(func(pem *PickEmMessage) { pem.LatePolicy = "whenever" }), []string{"unknown late policy 'whenever'"}},
+		{"unknown neutral policy", with(func(pem *PickEmMessage) { pem.NeutralPolicy = "maybe" }), []string{"maybe"}},
+		{"bad aliases", with(func(pem *PickEmMessage) {
+			pem.TeamAliases = map[string]string{"Hawks": "teams/iowa", " ": "iowa", "Bucks": ""}
+		}), []string{"team alias ' ' for 'iowa'", "team alias 'Bucks' for ''", "team alias 'Hawks' for 'teams/iowa'"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkMessage(tt.pem)
+			if len(tt.wantProblems) == 0 {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if KindOf(err) != KindInvalidInput {
+				t.Fatalf("expected invalid input, got %v", err)
+			}
+			// Every problem is reported in one error, in order.
+			msg := err.Error()
+			at := 0
+			for _, want := range tt.wantProblems {
+				i := strings.Index(msg[at:], want)
+				if i < 0 {
+					t.Errorf("expected '%s' after position %d in %q", want, at, msg)
+					break
+				}
+				at += i + len(want)
+			}
+		})
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"nil", nil, KindUnknown},
+		{"plain", errors.New("boom"), KindUnknown},
+		{"error", newError(KindDeadlinePassed, "too late"), KindDeadlinePassed},
+		{"wrapped error", fmt.Errorf("failed: %w", newError(KindNotFound, "no slate")), KindNotFound},
+		{"deadline", fmt.Errorf("failed: %w", context.DeadlineExceeded), KindTransient},
+		{"iterator done", iterator.Done, KindNotFound},
+		{"gRPC unavailable", status.Error(codes.Unavailable, "down"), KindTransient},
+		{"gRPC failed precondition", status.Error(codes.FailedPrecondition, "bad"), KindInconsistent},
+		{"backend", backendError(status.Error(codes.NotFound, "gone"), "failed getting '%s'", "x"), KindNotFound},
+		{"storage unavailable", &googleapi.Error{Code: http.StatusServiceUnavailable}, KindTransient},
+		{"storage rate limited", fmt.Errorf("failed: %w", &googleapi.Error{Code: http.StatusTooManyRequests}), KindTransient},
+		{"storage not found", &googleapi.Error{Code: http.StatusNotFound}, KindNotFound},
+		{"storage forbidden", &googleapi.Error{Code: http.StatusForbidden}, KindUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// failingWriter fails to close with an error.
+type failingWriter struct {
+	nopCloser
+	err error
+}
+
+func (w *failingWriter) Close() error { return w.err }
+
+// brokenOutput fails every write and records whether it was closed or aborted.
+type brokenOutput struct {
+	closed, aborted bool
+}
+
+func (o *brokenOutput) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+func (o *brokenOutput) Close() error              { o.closed = true; return nil }
+func (o *brokenOutput) Abort()                    { o.aborted = true }
+
+func TestWriteOutputsAbortsFailedWrites(t *testing.T) {
+	for _, format := range []string{"json", "csv", "md"} {
+		t.Run(format, func(t *testing.T) {
+			o := &brokenOutput{}
+			err := writeOutputs(context.Background(), &PickSet{Week: 3}, []string{format}, func(string, string) (output, error) { return o, nil })
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !o.aborted || o.closed {
+				t.Errorf("expected the output aborted and not closed, got aborted %t and closed %t", o.aborted, o.closed)
+			}
+		})
+	}
+}
+
+func TestFileOutputAbort(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "picks.json")
+	o, err := createFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Write([]byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	o.Abort()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("expected the aborted file removed, got %v", err)
+	}
+}
+
+func TestWriteOutputsKeepsErrorKinds(t *testing.T) {
+	unavailable := &googleapi.Error{Code: http.StatusServiceUnavailable, Message: "backend unavailable"}
+	tests := []struct {
+		name    string
+		formats []string
+		create  func(ext, contentType string) (output, error)
+		want    ErrorKind
+	}{
+		{"unknown format", []string{"pdf"}, func(string, string) (output, error) { return &nopCloser{}, nil }, KindInvalidInput},
+		{"create fails", []string{"json"}, func(string, string) (output, error) { return nil, unavailable }, KindTransient},
+		{"close fails", []string{"json"}, func(string, string) (output, error) { return &failingWriter{err: unavailable}, nil }, KindTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := writeOutputs(context.Background(), &PickSet{Week: 3}, tt.formats, tt.create)
+			if got := KindOf(err); got != tt.want {
+				t.Errorf("expected %s, got %s: %v", tt.want, got, err)
+			}
+		})
+	}
+}
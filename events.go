@@ -0,0 +1,434 @@
+package pickem4me
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CloudEvents types consumed and produced by the function.
+const (
+	// PubSubPublishedType is the type of event delivered for a Pub/Sub message.
+	PubSubPublishedType = "google.cloud.pubsub.topic.v1.messagePublished"
+
+	// PicksRequestedType is the type of event whose data is a PickEmMessage.
+	PicksRequestedType = "com.github.reallyasi9.pickem4me.picks.requested"
+
+	// PicksCompletedType is the type of event emitted when picks have been made.
+	PicksCompletedType = "com.github.reallyasi9.pickem4me.picks.completed"
+
+	// PicksFailedType is the type of event emitted when picks could not be made.
+	PicksFailedType = "com.github.reallyasi9.pickem4me.picks.failed"
+)
+
+// cloudEventsSpecVersion is the version of the CloudEvents specification implemented here.
+const cloudEventsSpecVersion = "1.0"
+
+// cloudEventsJSON is the content type of a CloudEvent in structured mode.
+const cloudEventsJSON = "application/cloudevents+json"
+
+// CloudEvent is the CloudEvents envelope of an event, as it appears in structured mode.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            *time.Time      `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+
+	// DataBase64 is data that is not JSON, such as data sent base64-encoded in structured mode.
+	DataBase64 []byte `json:"data_base64,omitempty"`
+}
+
+// data returns the data of an event, whether it was sent as JSON or base64-encoded.
+func (ev *CloudEvent) data() []byte {
+	if len(ev.Data) > 0 {
+		return ev.Data
+	}
+	return ev.DataBase64
+}
+
+// messagePublishedData is the data of a Pub/Sub message published event.
+type messagePublishedData struct {
+	Message      PubSubMessage `json:"message"`
+	Subscription string        `json:"subscription"`
+}
+
+// PicksSummary summarizes the picks made for a picker on a slate.
+type PicksSummary struct {
+	// Games is the number of games in the slate.
+	Games int `json:"games"`
+
+	// Locked is the number of games that had started when the picks were made.
+	Locked int `json:"locked"`
+
+	// Fallbacks is the number of games picked without the chosen models.
+	Fallbacks int `json:"fallbacks"`
+
+	// Reconciliations is the number of disagreements between the slate and the models.
+	Reconciliations int `json:"reconciliations"`
+
+	// Superdog is the path to the superdog that was picked (empty if none was picked).
+	Superdog string `json:"superdog,omitempty"`
+
+	// Streak are the paths to the teams picked to beat the streak.
+	Streak []string `json:"streak,omitempty"`
+}
+
+// PicksEventData is the data of a picks completed or picks failed event.
+type PicksEventData struct {
+	// Picks is the path to the picks document (empty if the picks were not stored).
+	Picks string `json:"picks,omitempty"`
+
+	// Run is the path to the record of the run in the runs collection.
+	Run string `json:"run,omitempty"`
+
+	// Slate is the path to the slate.
+	Slate string `json:"slate"`
+
+	// Picker is the (Luke-given) name of the picker.
+	Picker string `json:"picker"`
+
+	// Week is the week of the slate (zero if the slate could not be read).
+	Week int `json:"week,omitempty"`
+
+	// DryRun is set if the picks were made in a dry run.
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Summary summarizes the picks (nil if the picks failed).
+	Summary *PicksSummary `json:"summary,omitempty"`
+
+	// Error describes why the picks failed.
+	Error string `json:"error,omitempty"`
+
+	// ErrorKind is the kind of failure, such as "not_found" or "transient".
+	ErrorKind string `json:"errorKind,omitempty"`
+
+	// Retryable is set if the picks failed but might succeed if retried.
+	Retryable bool `json:"retryable,omitempty"`
+}
+
+// Publisher publishes events.
+type Publisher interface {
+	Publish(ctx context.Context, ev *CloudEvent) error
+}
+
+// HTTPPublisher publishes events in structured mode to an HTTP endpoint, such as the sink of an Eventarc trigger.
+type HTTPPublisher struct {
+	// URL is the endpoint to which events are posted.
+	URL string
+
+	// Client is the HTTP client used to post events (nil means http.DefaultClient).
+	Client *http.Client
+}
+
+// Publish posts an event.
+func (p *HTTPPublisher) Publish(ctx context.Context, ev *CloudEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed encoding event: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("failed making event request: %v", err)
+	}
+	req.Header.Set("Content-Type", cloudEventsJSON)
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed posting event to '%s': %v", p.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed posting event to '%s': %s", p.URL, resp.Status)
+	}
+	return nil
+}
+
+// WriterPublisher is a local stand-in publisher that writes each event as a line of JSON.
+type WriterPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterPublisher makes a publisher that writes events to w.
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{w: w}
+}
+
+// Publish writes an event.
+func (p *WriterPublisher) Publish(ctx context.Context, ev *CloudEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return json.NewEncoder(p.w).Encode(ev)
+}
+
+// publisher publishes picks completed and picks failed events (nil means events are not published).
+var publisher = publisherFromEnv()
+
+// publisherFromEnv publishes events to the sink given by K_SINK, if any.
+func publisherFromEnv() Publisher {
+	if sink := os.Getenv("K_SINK"); sink != "" {
+		return &HTTPPublisher{URL: sink}
+	}
+	return nil
+}
+
+// SetPublisher replaces the publisher of picks completed and picks failed events.
+func SetPublisher(p Publisher) {
+	publisher = p
+}
+
+// newEventID makes a random event ID.
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// eventSource is the source of the events emitted by the function.
+func eventSource() string {
+	if projectID == "" {
+		return "//pickem4me"
+	}
+	return "//pickem4me/projects/" + projectID
+}
+
+// newPicksEvent makes a picks completed event, or a picks failed event if err is not nil.
+func newPicksEvent(pem PickEmMessage, ps *PickSet, err error, run string) (*CloudEvent, error) {
+	data := PicksEventData{
+		Run:    run,
+		Slate:  pem.Slate,
+		Picker: pem.Picker,
+		DryRun: pem.DryRun,
+	}
+	typ := PicksCompletedType
+	if err != nil {
+		typ = PicksFailedType
+		data.Error = err.Error()
+		data.ErrorKind = KindOf(err).String()
+		data.Retryable = IsRetryable(err)
+	}
+	if ps != nil {
+		data.Picks = refPath(ps.Ref)
+		data.Week = ps.Week
+		if err == nil {
+			data.Summary = ps.summary()
+		}
+	}
+	b, merr := json.Marshal(data)
+	if merr != nil {
+		return nil, fmt.Errorf("failed encoding event data: %v", merr)
+	}
+	t := now().UTC()
+	return &CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              newEventID(),
+		Source:          eventSource(),
+		Type:            typ,
+		Subject:         pem.Slate,
+		Time:            &t,
+		DataContentType: "application/json",
+		Data:            b,
+	}, nil
+}
+
+// summary summarizes the pick set.
+func (ps *PickSet) summary() *PicksSummary {
+	s := &PicksSummary{
+		Games:           len(ps.StraightUp) + len(ps.NoisySpread) + len(ps.Superdog),
+		Locked:          len(ps.Locked),
+		Fallbacks:       len(ps.Fallbacks),
+		Reconciliations: len(ps.Reconciliations),
+	}
+	for _, dog := range ps.Superdog {
+		if dog.Pick != nil {
+			s.Superdog = refPath(dog.Pick)
+		}
+	}
+	if ps.Streak != nil {
+		s.Streak = refPaths(ps.Streak.Picks)
+	}
+	return s
+}
+
+// publishResult publishes a picks completed or picks failed event, logging (but otherwise ignoring) failures to publish.
+func publishResult(ctx context.Context, pem PickEmMessage, ps *PickSet, err error) {
+	if publisher == nil {
+		return
+	}
+	ev, perr := newPicksEvent(pem, ps, err, refPath(runRef(runFrom(ctx))))
+	if perr == nil {
+		perr = publisher.Publish(ctx, ev)
+	}
+	if perr != nil {
+		logFrom(ctx).Warnf("Failed publishing result event: %v", perr)
+		return
+	}
+	logFrom(ctx).Infof("Published %s event '%s'", ev.Type, ev.ID)
+}
+
+// pickAndPublish makes picks for a message, records the run and exports its telemetry, then publishes the result.
+// Every log entry made during the run is tagged with a new run ID.
+func pickAndPublish(ctx context.Context, pem PickEmMessage) (*PickSet, error) {
+	ctx, root := startRun(ctx, pem)
+	ps, err := pickEm(ctx, pem)
+	endRun(ctx, root, pem, ps, err)
+	return ps, err
+}
+
+// startRun starts the record and the span of a run for a message.
+func startRun(ctx context.Context, pem PickEmMessage) (context.Context, *span) {
+	ctx = withRun(ctx, pem)
+	ctx, root := startSpan(ctx, "pickem")
+	root.set("slate", pem.Slate)
+	root.set("picker", pem.Picker)
+	root.set("dry_run", pem.DryRun)
+	return ctx, root
+}
+
+// endRun exports the telemetry of a run, stores its record, and publishes its result.
+func endRun(ctx context.Context, root *span, pem PickEmMessage, ps *PickSet, err error) {
+	exportTelemetry(ctx, root, ps, err)
+	runFrom(ctx).finish(ctx, ps, err)
+	publishResult(ctx, pem, ps, err)
+}
+
+// ReadCloudEvent reads a CloudEvent from an HTTP request in either binary or structured mode.
+func ReadCloudEvent(r *http.Request) (*CloudEvent, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading event: %v", err)
+	}
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	var ev CloudEvent
+	if mediaType == cloudEventsJSON {
+		if err := json.Unmarshal(body, &ev); err != nil {
+			return nil, fmt.Errorf("malformed event: %v", err)
+		}
+	} else {
+		ev = CloudEvent{
+			SpecVersion:     r.Header.Get("Ce-Specversion"),
+			ID:              r.Header.Get("Ce-Id"),
+			Source:          r.Header.Get("Ce-Source"),
+			Type:            r.Header.Get("Ce-Type"),
+			Subject:         r.Header.Get("Ce-Subject"),
+			DataContentType: contentType,
+		}
+		// The body is the data itself, which can only be kept as JSON if it is JSON.
+		if json.Valid(body) {
+			ev.Data = body
+		} else {
+			ev.DataBase64 = body
+		}
+		if s := r.Header.Get("Ce-Time"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, fmt.Errorf("malformed event time '%s': %v", s, err)
+			}
+			ev.Time = &t
+		}
+	}
+
+	if ev.SpecVersion != cloudEventsSpecVersion {
+		return nil, fmt.Errorf("unsupported CloudEvents spec version '%s'", ev.SpecVersion)
+	}
+	if ev.ID == "" || ev.Source == "" || ev.Type == "" {
+		return nil, fmt.Errorf("event is missing an id, source, or type")
+	}
+	return &ev, nil
+}
+
+// messageOf extracts the PickEmMessage carried by an event.
+func messageOf(ev *CloudEvent) (PickEmMessage, error) {
+	var pem PickEmMessage
+	data := ev.data()
+	switch ev.Type {
+	case PubSubPublishedType:
+		var mpd messagePublishedData
+		if err := json.Unmarshal(data, &mpd); err != nil {
+			return pem, fmt.Errorf("malformed Pub/Sub event data: %v", err)
+		}
+		data = mpd.Message.Data
+	case PicksRequestedType:
+	default:
+		return pem, fmt.Errorf("unsupported event type '%s'", ev.Type)
+	}
+	if ct := ev.DataContentType; ct != "" && !strings.Contains(ct, "json") {
+		return pem, fmt.Errorf("unsupported event data content type '%s'", ct)
+	}
+	if err := json.Unmarshal(data, &pem); err != nil {
+		return pem, fmt.Errorf("malformed message: %v", err)
+	}
+	return pem, nil
+}
+
+// PickEmEvent picks a slate for a picker as requested by a CloudEvent.
+// The event is either a Pub/Sub message published event carrying a PickEmMessage, or a picks requested event whose data is a PickEmMessage.
+// A picks completed or picks failed event is published when done.
+// Like PickEm, only retryable failures are returned, so that the event is not redelivered for requests that will never succeed.
+func PickEmEvent(ctx context.Context, ev *CloudEvent) error {
+	err := pickEmEvent(ctx, ev)
+	if err != nil && !IsRetryable(err) {
+		logFrom(ctx).Errorf("Permanent failure (%s): not retrying: %v", KindOf(err), err)
+		return nil
+	}
+	return err
+}
+
+// pickEmEvent picks a slate for a picker as requested by a CloudEvent, returning every failure.
+func pickEmEvent(ctx context.Context, ev *CloudEvent) error {
+	pem, err := messageOf(ev)
+	if err != nil {
+		logFrom(ctx).Warnf("Bad event '%s': %v", ev.ID, err)
+		return newError(KindInvalidInput, "%v", err)
+	}
+	logFrom(ctx).Infof("Got %s event '%s' from '%s'", ev.Type, ev.ID, ev.Source)
+	_, err = pickFunc(ctx, pem)
+	return err
+}
+
+// PickEmCloudEvent is an HTTP handler for CloudEvents delivered in binary or structured mode, such as by Eventarc.
+// Malformed or unsupported events get a 400 response.
+// Retryable failures to pick get 503 so that the event is redelivered, and permanent failures are acknowledged with 200
+// and an error body.
+func PickEmCloudEvent(w http.ResponseWriter, r *http.Request) {
+	ev, err := ReadCloudEvent(r)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, err := messageOf(ev); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, newError(KindInvalidInput, "%v", err))
+		return
+	}
+	if err := pickEmEvent(r.Context(), ev); err != nil {
+		if IsRetryable(err) {
+			writeHTTPError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		// Acknowledge permanent failures so that the event is not redelivered.
+		writeHTTPError(w, http.StatusOK, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
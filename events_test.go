@@ -0,0 +1,159 @@
+package pickem4me
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadCloudEvent(t *testing.T) {
+	msg := `{"slate":"seasons/2021/weeks/5/slates/1","picker":"LUKE"}`
+	b64 := base64.StdEncoding.EncodeToString([]byte(msg))
+	pubsub := `{"message":{"data":"` + b64 + `"},"subscription":"projects/p/subscriptions/s"}`
+	binary := map[string]string{
+		"Ce-Specversion": "1.0",
+		"Ce-Id":          "1",
+		"Ce-Source":      "//pubsub.googleapis.com/projects/p/topics/pickem",
+		"Ce-Type":        PubSubPublishedType,
+	}
+	structured := func(typ, data string) string {
+		return `{"specversion":"1.0","id":"1","source":"test","type":"` + typ + `",` + data + `}`
+	}
+	requested := map[string]string{
+		"Ce-Specversion": "1.0",
+		"Ce-Id":          "2",
+		"Ce-Source":      "test",
+		"Ce-Type":        PicksRequestedType,
+	}
+
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		contentType string
+		body        string
+		wantPicker  string
+		wantErr     bool
+	}{
+		{"binary Pub/Sub", binary, "application/json", pubsub, "LUKE", false},
+		{"binary picks requested", requested, "application/json; charset=utf-8", msg, "LUKE", false},
+		{"structured picks requested", nil, cloudEventsJSON, structured(PicksRequestedType, `"data":`+msg), "LUKE", false},
+		{"structured base64 picks requested", nil, cloudEventsJSON, structured(PicksRequestedType, `"datacontenttype":"application/json","data_base64":"`+b64+`"`), "LUKE", false},
+		{"structured base64 Pub/Sub", nil, cloudEventsJSON, structured(PubSubPublishedType, `"data_base64":"`+base64.StdEncoding.EncodeToString([]byte(pubsub))+`"`), "LUKE", false},
+		{"binary not JSON", requested, "text/plain", "slate=1", "", true},
+		{"structured malformed", nil, cloudEventsJSON, `{"specversion":`, "", true},
+		{"missing id", map[string]string{"Ce-Specversion": "1.0", "Ce-Source": "test", "Ce-Type": PicksRequestedType}, "application/json", msg, "", true},
+		{"bad spec version", map[string]string{"Ce-Specversion": "0.3", "Ce-Id": "1", "Ce-Source": "test", "Ce-Type": PicksRequestedType}, "application/json", msg, "", true},
+		{"unsupported type", nil, cloudEventsJSON, structured("com.example.other", `"data":`+msg), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			ev, err := ReadCloudEvent(r)
+			var pem PickEmMessage
+			if err == nil {
+				pem, err = messageOf(ev)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", pem)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if pem.Picker != tt.wantPicker || pem.Slate != "seasons/2021/weeks/5/slates/1" {
+				t.Errorf("expected picker '%s', got %+v", tt.wantPicker, pem)
+			}
+		})
+	}
+}
+
+func TestCloudEventDataBase64RoundTrip(t *testing.T) {
+	ev := CloudEvent{SpecVersion: "1.0", ID: "1", Source: "test", Type: PicksRequestedType, DataBase64: []byte("not json")}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"data_base64":"`+base64.StdEncoding.EncodeToString(ev.DataBase64)+`"`) {
+		t.Errorf("expected data_base64 in %s", b)
+	}
+	var got CloudEvent
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got.data()) != "not json" {
+		t.Errorf("expected data 'not json', got '%s'", got.data())
+	}
+}
+
+func TestPickEmEventReturnsOnlyRetryable(t *testing.T) {
+	ev := &CloudEvent{SpecVersion: "1.0", ID: "1", Source: "test", Type: PicksRequestedType, Data: json.RawMessage(`{"slate":"seasons/2021/weeks/5/slates/1","picker":"LUKE"}`)}
+	tests := []struct {
+		name    string
+		ev      *CloudEvent
+		err     error
+		wantErr bool
+	}{
+		{"success", ev, nil, false},
+		{"transient", ev, newError(KindTransient, "unavailable"), true},
+		{"not found", ev, newError(KindNotFound, "no slate"), false},
+		{"deadline passed", ev, newError(KindDeadlinePassed, "too late"), false},
+		{"unknown", ev, errors.New("boom"), false},
+		{"bad event", &CloudEvent{ID: "2", Type: "com.example.other"}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPicks(t, func(context.Context, PickEmMessage) (*PickSet, error) {
+				return &PickSet{}, tt.err
+			})
+			err := PickEmEvent(context.Background(), tt.ev)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %t, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPickEmCloudEventStatus(t *testing.T) {
+	body := `{"slate":"seasons/2021/weeks/5/slates/1","picker":"LUKE"}`
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusNoContent},
+		{"transient", newError(KindTransient, "unavailable"), http.StatusServiceUnavailable},
+		{"permanent", newError(KindNotFound, "no slate"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPicks(t, func(context.Context, PickEmMessage) (*PickSet, error) {
+				return &PickSet{}, tt.err
+			})
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Ce-Specversion", "1.0")
+			r.Header.Set("Ce-Id", "1")
+			r.Header.Set("Ce-Source", "test")
+			r.Header.Set("Ce-Type", PicksRequestedType)
+			w := httptest.NewRecorder()
+			PickEmCloudEvent(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if tt.err != nil && !strings.Contains(w.Body.String(), tt.err.Error()) {
+				t.Errorf("expected the error in the body, got %s", w.Body)
+			}
+		})
+	}
+}
@@ -4,17 +4,26 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"strings"
 
+	"cloud.google.com/go/firestore"
 	"github.com/360EntSecGroup-Skylar/excelize"
 
 	bpefs "github.com/reallyasi9/b1gpickem/firestore"
 )
 
-func addRow(ctx context.Context, outExcel *excelize.File, sheetName string, pick bpefs.SlateRowBuilder, row int) error {
+// addRow writes a pick to a row of the sheet. If ev is not empty, it replaces the expected value of the pick.
+func addRow(ctx context.Context, outExcel *excelize.File, sheetName string, pick bpefs.SlateRowBuilder, row int, notes []string, ev string) error {
 	out, err := pick.BuildSlateRow(ctx)
 	if err != nil {
 		return fmt.Errorf("failed making game output: %v", err)
 	}
+	if ev != "" {
+		out[5] = ev
+	}
+	if len(notes) > 0 {
+		out[4] = strings.Trim(out[4]+"\n"+strings.Join(notes, "\n"), "\n")
+	}
 	for col, str := range out {
 		colLetter := rune('A' + col)
 		switch pick.(type) {
@@ -31,7 +40,13 @@ func addRow(ctx context.Context, outExcel *excelize.File, sheetName string, pick
 	return nil
 }
 
-func newExcelFile(ctx context.Context, suPicks []*bpefs.StraightUpPick, nsPicks []*bpefs.NoisySpreadPick, sdPicks []*bpefs.SuperDogPick, streakPick *bpefs.StreakPick) (*excelize.File, error) {
+// pickExpectedValue formats the expected value of a straight-up or noisy spread pick worth the given points.
+// The rows built by b1gpickem assume the more likely team is picked, which is not so for picks overridden by hand.
+func pickExpectedValue(points float64, pick, home *firestore.DocumentRef, homeProbability float64) string {
+	return fmt.Sprintf("%0.3f", points*pickProbability(pick, home, homeProbability))
+}
+
+func newExcelFile(ctx context.Context, ps *PickSet) (*excelize.File, error) {
 	// Make an excel file in memory.
 	outExcel := excelize.NewFile()
 	sheetName := outExcel.GetSheetName(outExcel.GetActiveSheetIndex())
@@ -46,37 +61,43 @@ func newExcelFile(ctx context.Context, suPicks []*bpefs.StraightUpPick, nsPicks
 	lastPickRow := -1 // need to calculate where the BTS row is
 	firstSDRow := -1
 
-	for _, game := range suPicks {
+	for _, game := range ps.StraightUp {
 		if game.Row > lastPickRow {
 			lastPickRow = game.Row
 		}
-		if err := addRow(ctx, outExcel, sheetName, game, game.Row); err != nil {
+		points := 1.
+		if game.GOTW {
+			points = 2
+		}
+		ev := pickExpectedValue(points, game.Pick, game.HomeTeam, game.PredictedProbability)
+		if err := addRow(ctx, outExcel, sheetName, game, game.Row, ps.Notes[game.Row], ev); err != nil {
 			return nil, err
 		}
 	}
 
-	for _, game := range nsPicks {
+	for _, game := range ps.NoisySpread {
 		if game.Row > lastPickRow {
 			lastPickRow = game.Row
 		}
-		if err := addRow(ctx, outExcel, sheetName, game, game.Row); err != nil {
+		ev := pickExpectedValue(1, game.Pick, game.HomeTeam, game.PredictedProbability)
+		if err := addRow(ctx, outExcel, sheetName, game, game.Row, ps.Notes[game.Row], ev); err != nil {
 			return nil, err
 		}
 	}
 
-	for _, game := range sdPicks {
+	for _, game := range ps.Superdog {
 		if game.Row < firstSDRow || firstSDRow < 0 {
 			firstSDRow = game.Row
 		}
-		if err := addRow(ctx, outExcel, sheetName, game, game.Row); err != nil {
+		if err := addRow(ctx, outExcel, sheetName, game, game.Row, ps.Notes[game.Row], ""); err != nil {
 			return nil, err
 		}
 	}
 
-	if streakPick != nil {
+	if ps.Streak != nil {
 		// Between the picks and dogs, closer to the picks.
 		row := int(math.Ceil(float64(lastPickRow) + float64(firstSDRow-lastPickRow)/2.))
-		if err := addRow(ctx, outExcel, sheetName, streakPick, row); err != nil {
+		if err := addRow(ctx, outExcel, sheetName, ps.Streak, row, ps.StreakNotes, ""); err != nil {
 			return nil, err
 		}
 	}
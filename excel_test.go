@@ -0,0 +1,21 @@
+package pickem4me
+
+import "testing"
+
+func TestPickExpectedValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		points float64
+		pick   string
+		want   string
+	}{
+		{"favorite", 1, "iowa", "0.700"},
+		{"underdog picked by hand", 1, "michigan", "0.300"},
+		{"game of the week", 2, "michigan", "0.600"},
+	}
+	for _, tt := range tests {
+		if got := pickExpectedValue(tt.points, teamRef(tt.pick), teamRef("iowa"), 0.7); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package pickem4me
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// Explanation explains how one game of a slate is picked: what the slate says, what the model predicts,
+// how disagreements between them are resolved, and how the probability of the pick is computed.
+type Explanation struct {
+	// Row is the slate row of the game.
+	Row int `json:"row"`
+
+	// Type is one of "straight_up", "noisy_spread", or "superdog".
+	Type string `json:"type"`
+
+	// Slate is the game as the slate has it.
+	Slate ExplainedGame `json:"slate"`
+
+	// Prediction is the prediction matched to the game.
+	Prediction ExplainedPrediction `json:"prediction"`
+
+	// Swap is true if the slate and the model disagree about which team is at home.
+	Swap bool `json:"swap"`
+
+	// Reconciliations are the disagreements between the slate and the model about the game, and how they were resolved.
+	Reconciliations []Reconciliation `json:"reconciliations,omitempty"`
+
+	// HomeAdjustment is the number of points added to the predicted spread to move home field advantage to where the
+	// reconciled game has it: away from a neutral site, or to the slate's home team if the slate is trusted.
+	HomeAdjustment float64 `json:"homeAdjustment"`
+
+	// Bias and Sigma are the mean and standard deviation of the errors of the model that made the prediction.
+	Bias  float64 `json:"bias"`
+	Sigma float64 `json:"sigma"`
+
+	// ModelSpread is the adjusted predicted spread, and Target is the spread the game is picked against
+	// (zero unless the game has a noisy spread). Both are relative to the model's home team.
+	ModelSpread float64 `json:"modelSpread"`
+	Target      float64 `json:"target"`
+
+	// Z is the standardized margin of the model's home team over the target, (ModelSpread - Target - Bias) / Sigma.
+	Z float64 `json:"z"`
+
+	// HomeProbability is the probability that the model's home team beats the target:
+	// the normal CDF of ModelSpread - Target with mean Bias and standard deviation Sigma.
+	HomeProbability float64 `json:"homeProbability"`
+
+	// Pick is the resulting pick.
+	Pick ExportedPick `json:"pick"`
+
+	// Superdogs compares the expected values of every superdog game of the slate (superdog games only).
+	Superdogs []SuperdogValue `json:"superdogs,omitempty"`
+}
+
+// ExplainedGame is a game as the slate has it.
+type ExplainedGame struct {
+	// Home and Road are the paths to the home and road teams of the slate.
+	Home string `json:"home"`
+	Road string `json:"road"`
+
+	// HomeRank and RoadRank are the ranks of the home and road teams. Zero means unranked.
+	HomeRank int `json:"homeRank"`
+	RoadRank int `json:"roadRank"`
+
+	// NeutralSite is true if the slate says the game is played at a neutral site.
+	NeutralSite bool `json:"neutralSite"`
+
+	// GOTW is true for the game of the week.
+	GOTW bool `json:"gotw"`
+
+	// NoisySpread is the spread the game is picked against, positive favoring the home team (zero otherwise).
+	NoisySpread int `json:"noisySpread"`
+
+	// Underdog and Overdog are the paths to the underdog and overdog of a superdog game.
+	Underdog string `json:"underdog,omitempty"`
+	Overdog  string `json:"overdog,omitempty"`
+
+	// Value is the point value of a superdog game (zero otherwise).
+	Value int `json:"value"`
+}
+
+// ExplainedPrediction is a model prediction matched to a slate game.
+type ExplainedPrediction struct {
+	// Path is the path to the prediction (empty for heuristic predictions).
+	Path string `json:"path,omitempty"`
+
+	// System is the name of the model that made the prediction (empty for heuristic predictions).
+	System string `json:"system,omitempty"`
+
+	// Fallback describes how the game was predicted if the chosen model could not predict it (empty otherwise).
+	Fallback string `json:"fallback,omitempty"`
+
+	// Home and Road are the paths to the home and road teams of the model.
+	Home string `json:"home"`
+	Road string `json:"road"`
+
+	// NeutralSite is true if the model says the game is played at a neutral site.
+	NeutralSite bool `json:"neutralSite"`
+
+	// Spread is the predicted spread, positive favoring the model's home team.
+	Spread float64 `json:"spread"`
+}
+
+// SuperdogValue is the expected value of picking the underdog of a superdog game.
+type SuperdogValue struct {
+	// Row is the slate row of the game.
+	Row int `json:"row"`
+
+	// Underdog and Overdog are the paths to the underdog and overdog.
+	Underdog string `json:"underdog"`
+	Overdog  string `json:"overdog"`
+
+	// Value is the point value of the game.
+	Value int `json:"value"`
+
+	// Probability is the probability that the underdog wins.
+	Probability float64 `json:"probability"`
+
+	// ExpectedValue is Probability times Value.
+	ExpectedValue float64 `json:"expectedValue"`
+
+	// Picked is true if the underdog is picked.
+	Picked bool `json:"picked"`
+
+	// Locked is true if the game had already started when the picks were made.
+	Locked bool `json:"locked"`
+}
+
+// Explain makes the picks requested by a message without storing, writing, or delivering them, and explains how
+// one game is picked. The game is given by its slate row or by the name of either team playing in it.
+func Explain(ctx context.Context, pem PickEmMessage, rowOrTeam string) (*Explanation, error) {
+	plan, err := makePicks(ctx, pem)
+	if err != nil {
+		return nil, err
+	}
+	game, err := plan.findGame(rowOrTeam)
+	if err != nil {
+		return nil, err
+	}
+	cp := plan.computed[game.Row]
+	gp := cp.prediction
+
+	ex := &Explanation{
+		Row: game.Row,
+		Slate: ExplainedGame{
+			Home:        refPath(game.HomeTeam),
+			Road:        refPath(game.AwayTeam),
+			HomeRank:    game.HomeRank,
+			RoadRank:    game.AwayRank,
+			NeutralSite: game.NeutralSite,
+			GOTW:        game.GOTW,
+			NoisySpread: game.NoisySpread,
+			Underdog:    refPath(game.Underdog),
+			Overdog:     refPath(game.Overdog),
+			Value:       game.Value,
+		},
+		Prediction: ExplainedPrediction{
+			Path:        refPath(gp.ref),
+			System:      gp.system,
+			Fallback:    gp.fallback,
+			Home:        refPath(gp.prediction.HomeTeam),
+			Road:        refPath(gp.prediction.AwayTeam),
+			NeutralSite: gp.prediction.NeutralSite,
+			Spread:      gp.prediction.Spread,
+		},
+		Swap:            gp.swap,
+		Reconciliations: cp.reconciliations,
+		HomeAdjustment:  cp.homeAdjustment,
+		Bias:            gp.distribution.Mu,
+		Sigma:           gp.distribution.Sigma,
+		ModelSpread:     cp.modelSpread,
+		Target:          cp.target,
+		HomeProbability: cp.homeProbability,
+	}
+	if ex.Sigma > 0 {
+		ex.Z = (ex.ModelSpread - ex.Target - ex.Bias) / ex.Sigma
+	}
+	for _, g := range plan.picks.Export().Games {
+		if g.Row == game.Row {
+			ex.Type = g.Type
+			ex.Pick = g
+			break
+		}
+	}
+	if game.Superdog && game.NoisySpread == 0 {
+		for _, sd := range plan.picks.Superdog {
+			ex.Superdogs = append(ex.Superdogs, SuperdogValue{
+				Row:           sd.Row,
+				Underdog:      refPath(sd.Underdog),
+				Overdog:       refPath(sd.Overdog),
+				Value:         sd.Value,
+				Probability:   sd.PredictedProbability,
+				ExpectedValue: sd.PredictedProbability * float64(sd.Value),
+				Picked:        sd.Pick != nil,
+				Locked:        plan.picks.Locked[sd.Row],
+			})
+		}
+	}
+	return ex, nil
+}
+
+// findGame finds a game of the plan's slate by slate row or by the name of either team playing in it.
+// It is an error if the team plays in more than one game of the slate.
+func (p *pickPlan) findGame(rowOrTeam string) (*bpefs.Game, error) {
+	if row, err := strconv.Atoi(rowOrTeam); err == nil {
+		for i := range p.games {
+			if p.games[i].Row == row {
+				return &p.games[i], nil
+			}
+		}
+		return nil, newError(KindNotFound, "no game in row %d of slate '%s'", row, p.pem.Slate)
+	}
+	ref, ok := p.teams.ResolveName(rowOrTeam)
+	if !ok {
+		return nil, newError(KindNotFound, "no team named '%s'", rowOrTeam)
+	}
+	id := p.teams.ID(ref)
+	var found []*bpefs.Game
+	for i := range p.games {
+		g := &p.games[i]
+		for _, team := range []*firestore.DocumentRef{g.HomeTeam, g.AwayTeam, g.Underdog, g.Overdog} {
+			if team != nil && p.teams.ID(team) == id {
+				found = append(found, g)
+				break
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, newError(KindNotFound, "%s does not play in slate '%s'", p.teams.Name(ref), p.pem.Slate)
+	case 1:
+		return found[0], nil
+	default:
+		rows := make([]string, len(found))
+		for i, g := range found {
+			rows[i] = strconv.Itoa(g.Row)
+		}
+		return nil, newError(KindInvalidInput, "%s plays in rows %s of slate '%s': give the row instead", p.teams.Name(ref), strings.Join(rows, ", "), p.pem.Slate)
+	}
+}
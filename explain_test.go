@@ -0,0 +1,64 @@
+package pickem4me
+
+import (
+	"strings"
+	"testing"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+func TestFindGame(t *testing.T) {
+	teams := NewTeamResolver()
+	for _, t := range []struct{ id, school string }{
+		{"iowa", "Iowa"}, {"michigan", "Michigan"}, {"ohio-state", "Ohio State"}, {"penn-state", "Penn State"},
+		{"purdue", "Purdue"}, {"indiana", "Indiana"}, {"rutgers", "Rutgers"}, {"1", "One"},
+	} {
+		teams.AddTeam(teamRef(t.id), bpefs.Team{School: t.school})
+	}
+	plan := &pickPlan{
+		pem:   PickEmMessage{Slate: "seasons/2021/weeks/5/slates/1"},
+		teams: teams,
+		games: []bpefs.Game{
+			{Row: 1, HomeTeam: teamRef("iowa"), AwayTeam: teamRef("michigan")},
+			{Row: 2, HomeTeam: teamRef("ohio-state"), AwayTeam: teamRef("penn-state")},
+			{Row: 6, HomeTeam: teamRef("indiana"), AwayTeam: teamRef("iowa"), Superdog: true, Underdog: teamRef("iowa"), Overdog: teamRef("indiana")},
+			{Row: 7, HomeTeam: teamRef("purdue"), AwayTeam: teamRef("1"), Superdog: true, Underdog: teamRef("1"), Overdog: teamRef("purdue")},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		in       string
+		wantRow  int
+		wantKind ErrorKind
+		wantErr  string
+	}{
+		{"row", "2", 2, KindUnknown, ""},
+		{"superdog row", "6", 6, KindUnknown, ""},
+		{"row not in the slate", "3", 0, KindNotFound, "no game in row 3"},
+		{"home team", "Ohio State", 2, KindUnknown, ""},
+		{"road team by ID", "penn-state", 2, KindUnknown, ""},
+		{"superdog team", "Purdue", 7, KindUnknown, ""},
+		{"number is a row, not a team", "1", 1, KindUnknown, ""},
+		{"team in two games", "Iowa", 0, KindInvalidInput, "Iowa plays in rows 1, 6"},
+		{"team not in the slate", "Rutgers", 0, KindNotFound, "Rutgers does not play in slate"},
+		{"unknown team", "Hawaii", 0, KindNotFound, "no team named 'Hawaii'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := plan.findGame(tt.in)
+			if tt.wantErr != "" {
+				if KindOf(err) != tt.wantKind || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected %s error containing %q, got %v", tt.wantKind, tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findGame: %v", err)
+			}
+			if g.Row != tt.wantRow {
+				t.Errorf("expected the game in row %d, got row %d", tt.wantRow, g.Row)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package pickem4me
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+)
+
+// ExportSchemaVersion is the version of the JSON and CSV export schema.
+// It is incremented whenever a field is removed or changes meaning.
+const ExportSchemaVersion = 1
+
+// Pick types as they appear in exports.
+const (
+	ExportStraightUp  = "straight_up"
+	ExportNoisySpread = "noisy_spread"
+	ExportSuperdog    = "superdog"
+	ExportStreak      = "streak"
+)
+
+// PicksExport is the machine-readable form of a PickSet.
+//
+// All document references are written as paths relative to the Firestore database root,
+// e.g. "teams/abc123". References that are not set are written as empty strings.
+type PicksExport struct {
+	// SchemaVersion is the value of ExportSchemaVersion when the export was written.
+	SchemaVersion int `json:"schemaVersion"`
+
+	// Slate is the path to the slate that was picked.
+	Slate string `json:"slate"`
+
+	// Season is the path to the season of the slate.
+	Season string `json:"season"`
+
+	// Week is the week of the slate.
+	Week int `json:"week"`
+
+	// Picker is the path to the picker.
+	Picker string `json:"picker"`
+
+	// Games are the picks for every game in the slate, ordered by slate row.
+	Games []ExportedPick `json:"games"`
+
+	// Streak is the beat the streak pick, or null if there is none.
+	Streak *ExportedStreak `json:"streak"`
+
+	// Reconciliations are the disagreements between the slate and the models, and how they were resolved.
+	Reconciliations []Reconciliation `json:"reconciliations"`
+
+	// Overrides are the picks changed by hand from what the models picked.
+	Overrides []Override `json:"overrides,omitempty"`
+}
+
+// ExportedPick is a single game pick in a PicksExport.
+type ExportedPick struct {
+	// Type is one of "straight_up", "noisy_spread", or "superdog".
+	Type string `json:"type"`
+
+	// Row is the row of the game in the slate.
+	Row int `json:"row"`
+
+	// Home is the path to the true home team (empty for superdog games).
+	Home string `json:"home,omitempty"`
+
+	// Road is the path to the true road team (empty for superdog games).
+	Road string `json:"road,omitempty"`
+
+	// HomeRank is the rank of the home team (the overdog for superdog games). Zero means unranked.
+	HomeRank int `json:"homeRank"`
+
+	// RoadRank is the rank of the road team (the underdog for superdog games). Zero means unranked.
+	RoadRank int `json:"roadRank"`
+
+	// Underdog is the path to the slate's underdog (superdog games only).
+	Underdog string `json:"underdog,omitempty"`
+
+	// Overdog is the path to the slate's overdog (superdog games only).
+	Overdog string `json:"overdog,omitempty"`
+
+	// GOTW is true for the game of the week.
+	GOTW bool `json:"gotw"`
+
+	// Value is the point value of a superdog game (zero otherwise).
+	Value int `json:"value"`
+
+	// NoisySpread is the spread the game is picked against, positive favoring the home team (zero otherwise).
+	NoisySpread int `json:"noisySpread"`
+
+	// NeutralSite is true if the game is played at a neutral site.
+	NeutralSite bool `json:"neutralSite"`
+
+	// NeutralDisagreement is true if the slate and the model disagree about the neutral site.
+	NeutralDisagreement bool `json:"neutralDisagreement"`
+
+	// HomeAwaySwap is true if the slate had the home and road teams reversed.
+	HomeAwaySwap bool `json:"homeAwaySwap"`
+
+	// Pick is the path to the picked team. It is empty for superdog games that were not picked.
+	Pick string `json:"pick"`
+
+	// PredictedSpread is the spread predicted by the model.
+	PredictedSpread float64 `json:"predictedSpread"`
+
+	// PredictedProbability is the probability that the home team wins, or beats the noisy spread
+	// (for superdog games, the probability that the underdog wins).
+	PredictedProbability float64 `json:"predictedProbability"`
+
+	// ModeledGame is the path to the model prediction used to make the pick.
+	ModeledGame string `json:"modeledGame"`
+
+	// Locked is true if the game had already started when the picks were made.
+	Locked bool `json:"locked"`
+
+	// Fallback describes how the game was picked if the chosen model could not be used (empty otherwise).
+	Fallback string `json:"fallback,omitempty"`
+
+	// Notes are additional notes about the pick.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// Confidence returns the probability that the pick is correct. A superdog game that is not picked has no chance of
+// being correct.
+func (p ExportedPick) Confidence() float64 {
+	switch {
+	case p.Pick == "":
+		return 0
+	case p.Type == ExportSuperdog:
+		return p.PredictedProbability
+	case p.Pick == p.Home:
+		return p.PredictedProbability
+	default:
+		return 1 - p.PredictedProbability
+	}
+}
+
+// ExportedStreak is the beat the streak pick in a PicksExport.
+type ExportedStreak struct {
+	// Picks are the paths to the picked teams.
+	Picks []string `json:"picks"`
+
+	// PredictedSpread is the sum of the spreads of the remaining games in the optimal streak.
+	PredictedSpread float64 `json:"predictedSpread"`
+
+	// PredictedProbability is the probability of beating the streak.
+	PredictedProbability float64 `json:"predictedProbability"`
+
+	// Notes are additional notes about the streak pick.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// Export converts a PickSet into its machine-readable form.
+func (ps *PickSet) Export() *PicksExport {
+	ex := &PicksExport{
+		SchemaVersion:   ExportSchemaVersion,
+		Slate:           refPath(ps.Slate),
+		Season:          refPath(ps.Season),
+		Week:            ps.Week,
+		Picker:          refPath(ps.Picker),
+		Reconciliations: ps.Reconciliations,
+		Overrides:       ps.Overrides,
+		Games:           make([]ExportedPick, 0, len(ps.StraightUp)+len(ps.NoisySpread)+len(ps.Superdog)),
+	}
+	for _, p := range ps.StraightUp {
+		ex.Games = append(ex.Games, ExportedPick{
+			Type:                 ExportStraightUp,
+			Row:                  p.Row,
+			Home:                 refPath(p.HomeTeam),
+			Road:                 refPath(p.AwayTeam),
+			HomeRank:             p.HomeRank,
+			RoadRank:             p.AwayRank,
+			GOTW:                 p.GOTW,
+			NeutralSite:          p.NeutralSite,
+			NeutralDisagreement:  p.NeutralDisagreement,
+			HomeAwaySwap:         p.HomeAwaySwap,
+			Pick:                 refPath(p.Pick),
+			PredictedSpread:      p.PredictedSpread,
+			PredictedProbability: p.PredictedProbability,
+			ModeledGame:          refPath(p.ModeledGame),
+		})
+	}
+	for _, p := range ps.NoisySpread {
+		ex.Games = append(ex.Games, ExportedPick{
+			Type:                 ExportNoisySpread,
+			Row:                  p.Row,
+			Home:                 refPath(p.HomeTeam),
+			Road:                 refPath(p.AwayTeam),
+			HomeRank:             p.HomeRank,
+			RoadRank:             p.AwayRank,
+			NoisySpread:          p.NoisySpread,
+			NeutralSite:          p.NeutralSite,
+			NeutralDisagreement:  p.NeutralDisagreement,
+			HomeAwaySwap:         p.HomeAwaySwap,
+			Pick:                 refPath(p.Pick),
+			PredictedSpread:      p.PredictedSpread,
+			PredictedProbability: p.PredictedProbability,
+			ModeledGame:          refPath(p.ModeledGame),
+		})
+	}
+	for _, p := range ps.Superdog {
+		ex.Games = append(ex.Games, ExportedPick{
+			Type:                 ExportSuperdog,
+			Row:                  p.Row,
+			HomeRank:             p.OverdogRank,
+			RoadRank:             p.UnderdogRank,
+			Underdog:             refPath(p.Underdog),
+			Overdog:              refPath(p.Overdog),
+			Value:                p.Value,
+			NeutralSite:          p.NeutralSite,
+			NeutralDisagreement:  p.NeutralDisagreement,
+			HomeAwaySwap:         p.HomeAwaySwap,
+			Pick:                 refPath(p.Pick),
+			PredictedSpread:      p.PredictedSpread,
+			PredictedProbability: p.PredictedProbability,
+			ModeledGame:          refPath(p.ModeledGame),
+		})
+	}
+	for i := range ex.Games {
+		ex.Games[i].Locked = ps.Locked[ex.Games[i].Row]
+		ex.Games[i].Fallback = ps.Fallbacks[ex.Games[i].Row]
+		ex.Games[i].Notes = ps.Notes[ex.Games[i].Row]
+	}
+	sort.SliceStable(ex.Games, func(i, j int) bool { return ex.Games[i].Row < ex.Games[j].Row })
+
+	if ps.Streak != nil {
+		ex.Streak = &ExportedStreak{
+			Picks:                refPaths(ps.Streak.Picks),
+			PredictedSpread:      ps.Streak.PredictedSpread,
+			PredictedProbability: ps.Streak.PredictedProbability,
+			Notes:                ps.StreakNotes,
+		}
+	}
+	return ex
+}
+
+// writeJSON writes the pick set as an indented PicksExport JSON document.
+func writeJSON(w io.Writer, ps *PickSet) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ps.Export())
+}
+
+// csvHeader are the columns of the flat CSV export.
+// Every row of the CSV is one ExportedPick, with notes separated by semicolons, with the streak pick (if any) as a final row of type "streak".
+// Streak rows list the picked teams separated by semicolons in the "pick" column.
+var csvHeader = []string{
+	"type", "row", "home", "road", "home_rank", "road_rank", "underdog", "overdog",
+	"gotw", "value", "noisy_spread", "neutral_site", "neutral_disagreement", "home_away_swap",
+	"pick", "predicted_spread", "predicted_probability", "modeled_game", "locked", "fallback", "notes",
+}
+
+// csvColumns are the indices of the columns in csvHeader, keyed by name.
+var csvColumns = func() map[string]int {
+	columns := make(map[string]int, len(csvHeader))
+	for i, name := range csvHeader {
+		columns[name] = i
+	}
+	return columns
+}()
+
+// writeCSV writes the pick set as a flat CSV file with the columns in csvHeader.
+func writeCSV(w io.Writer, ps *PickSet) error {
+	ex := ps.Export()
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, g := range ex.Games {
+		record := []string{
+			g.Type,
+			strconv.Itoa(g.Row),
+			g.Home,
+			g.Road,
+			strconv.Itoa(g.HomeRank),
+			strconv.Itoa(g.RoadRank),
+			g.Underdog,
+			g.Overdog,
+			strconv.FormatBool(g.GOTW),
+			strconv.Itoa(g.Value),
+			strconv.Itoa(g.NoisySpread),
+			strconv.FormatBool(g.NeutralSite),
+			strconv.FormatBool(g.NeutralDisagreement),
+			strconv.FormatBool(g.HomeAwaySwap),
+			g.Pick,
+			formatFloat(g.PredictedSpread),
+			formatFloat(g.PredictedProbability),
+			g.ModeledGame,
+			strconv.FormatBool(g.Locked),
+			g.Fallback,
+			strings.Join(g.Notes, "; "),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	if ex.Streak != nil {
+		record := make([]string, len(csvHeader))
+		record[csvColumns["type"]] = ExportStreak
+		record[csvColumns["pick"]] = strings.Join(ex.Streak.Picks, ";")
+		record[csvColumns["predicted_spread"]] = formatFloat(ex.Streak.PredictedSpread)
+		record[csvColumns["predicted_probability"]] = formatFloat(ex.Streak.PredictedProbability)
+		record[csvColumns["notes"]] = strings.Join(ex.Streak.Notes, "; ")
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func refPaths(refs []*firestore.DocumentRef) []string {
+	paths := make([]string, len(refs))
+	for i, ref := range refs {
+		paths[i] = refPath(ref)
+	}
+	return paths
+}
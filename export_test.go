@@ -0,0 +1,140 @@
+package pickem4me
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// testExportPicks returns a pick set with one game of every type and a streak.
+func testExportPicks() *PickSet {
+	return &PickSet{
+		Slate:  testClient.Doc("seasons/2021/weeks/5/slates/1"),
+		Picker: testClient.Doc("pickers/LUKE"),
+		Week:   5,
+		StraightUp: []*bpefs.StraightUpPick{
+			{Row: 2, HomeTeam: teamRef("iowa"), AwayTeam: teamRef("michigan"), GOTW: true, Pick: teamRef("michigan"), PredictedSpread: -3.5, PredictedProbability: 0.4},
+		},
+		NoisySpread: []*bpefs.NoisySpreadPick{
+			{Row: 1, HomeTeam: teamRef("wisconsin"), AwayTeam: teamRef("minnesota"), NoisySpread: 7, Pick: teamRef("wisconsin"), PredictedSpread: 10, PredictedProbability: 0.6},
+		},
+		Superdog: []*bpefs.SuperDogPick{
+			{Row: 3, Underdog: teamRef("purdue"), Overdog: teamRef("indiana"), Value: 10, Pick: teamRef("purdue"), PredictedProbability: 0.3},
+		},
+		Streak: &bpefs.StreakPick{Picks: []*firestore.DocumentRef{teamRef("iowa"), teamRef("ohio-state")}, PredictedProbability: 0.25},
+		Locked: map[int]bool{1: true},
+		Notes:  map[int][]string{2: {"flipped", "by hand"}},
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeJSON(&b, testExportPicks()); err != nil {
+		t.Fatalf("writeJSON: %v", err)
+	}
+	var ex PicksExport
+	if err := json.Unmarshal(b.Bytes(), &ex); err != nil {
+		t.Fatalf("expected a JSON document, got %v: %s", err, b.String())
+	}
+	if ex.SchemaVersion != ExportSchemaVersion || ex.Slate != "seasons/2021/weeks/5/slates/1" || ex.Picker != "pickers/LUKE" || ex.Week != 5 {
+		t.Errorf("expected the slate, picker and week, got %+v", ex)
+	}
+
+	tests := []struct {
+		typ        string
+		row        int
+		pick       string
+		confidence float64
+	}{
+		{ExportNoisySpread, 1, "teams/wisconsin", 0.6},
+		{ExportStraightUp, 2, "teams/michigan", 0.6},
+		{ExportSuperdog, 3, "teams/purdue", 0.3},
+	}
+	if len(ex.Games) != len(tests) {
+		t.Fatalf("expected %d games, got %+v", len(tests), ex.Games)
+	}
+	for i, tt := range tests {
+		g := ex.Games[i]
+		if g.Type != tt.typ || g.Row != tt.row || g.Pick != tt.pick {
+			t.Errorf("game %d: expected %s pick of '%s' in row %d, got %+v", i, tt.typ, tt.pick, tt.row, g)
+		}
+		if diff := g.Confidence() - tt.confidence; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("game %d: expected confidence %g, got %g", i, tt.confidence, g.Confidence())
+		}
+	}
+	if !ex.Games[0].Locked || ex.Games[1].Locked {
+		t.Errorf("expected only row 1 locked, got %+v", ex.Games)
+	}
+	if !ex.Games[1].GOTW || !reflect.DeepEqual(ex.Games[1].Notes, []string{"flipped", "by hand"}) {
+		t.Errorf("expected the game of the week with notes in row 2, got %+v", ex.Games[1])
+	}
+	if ex.Games[2].Underdog != "teams/purdue" || ex.Games[2].Home != "" {
+		t.Errorf("expected the superdog by underdog and overdog, got %+v", ex.Games[2])
+	}
+	if ex.Streak == nil || !reflect.DeepEqual(ex.Streak.Picks, []string{"teams/iowa", "teams/ohio-state"}) {
+		t.Errorf("expected a streak of iowa and ohio-state, got %+v", ex.Streak)
+	}
+}
+
+func TestWriteJSONWithoutStreak(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeJSON(&b, &PickSet{Week: 3}); err != nil {
+		t.Fatalf("writeJSON: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if streak, ok := doc["streak"]; !ok || streak != nil {
+		t.Errorf("expected a null streak, got %v", doc)
+	}
+	if slate := doc["slate"]; slate != "" {
+		t.Errorf("expected an empty slate path, got %v", slate)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeCSV(&b, testExportPicks()); err != nil {
+		t.Fatalf("writeCSV: %v", err)
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("expected a CSV file, got %v", err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("expected a header, three games and a streak, got %d records", len(records))
+	}
+	if !reflect.DeepEqual(records[0], csvHeader) {
+		t.Errorf("expected header %v, got %v", csvHeader, records[0])
+	}
+
+	tests := []struct {
+		name   string
+		record int
+		want   map[string]string
+	}{
+		{"noisy spread", 1, map[string]string{"type": ExportNoisySpread, "row": "1", "noisy_spread": "7", "pick": "teams/wisconsin", "locked": "true"}},
+		{"straight up", 2, map[string]string{"type": ExportStraightUp, "row": "2", "home": "teams/iowa", "road": "teams/michigan", "gotw": "true", "predicted_spread": "-3.5", "notes": "flipped; by hand"}},
+		{"superdog", 3, map[string]string{"type": ExportSuperdog, "row": "3", "underdog": "teams/purdue", "overdog": "teams/indiana", "value": "10", "predicted_probability": "0.3"}},
+		{"streak", 4, map[string]string{"type": ExportStreak, "row": "", "pick": "teams/iowa;teams/ohio-state", "predicted_probability": "0.25", "locked": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := records[tt.record]
+			if len(record) != len(csvHeader) {
+				t.Fatalf("expected %d columns, got %d", len(csvHeader), len(record))
+			}
+			for column, want := range tt.want {
+				if got := record[csvColumns[column]]; got != want {
+					t.Errorf("%s: expected '%s', got '%s'", column, want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package pickem4me
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+	"gonum.org/v1/gonum/stat/distuv"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// heuristicHomeAdvantage is the number of points the fallback heuristic gives the home team at a non-neutral site.
+const heuristicHomeAdvantage = 2.5
+
+// heuristicRankPoints is the number of points the fallback heuristic gives per place in the rankings.
+// Unranked teams are treated as if they were ranked 26th.
+const heuristicRankPoints = 0.5
+
+// heuristicStdDev is the standard deviation of the fallback heuristic's errors if the chosen model does not have one.
+const heuristicStdDev = 16.
+
+// gamePrediction is a prediction for a slate game along with the distribution of its errors.
+type gamePrediction struct {
+	// prediction is the predicted game.
+	prediction *bpefs.Prediction
+
+	// ref is a reference to the prediction document (nil for heuristic predictions).
+	ref *firestore.DocumentRef
+
+	// swap is true if the slate has the home and road teams reversed.
+	swap bool
+
+	// system is the name of the model that made the prediction (empty for heuristic predictions).
+	system string
+
+	// distribution is the distribution of the errors of the model that made the prediction.
+	distribution distuv.Normal
+
+	// fallback describes the fallback that made the prediction (empty if the chosen model made it).
+	fallback string
+}
+
+// fallbackRecord is a fallback pick as stored in the picks document.
+type fallbackRecord struct {
+	// Row is the slate row of the game.
+	Row int `firestore:"row"`
+
+	// Source describes how the game was picked.
+	Source string `firestore:"source"`
+}
+
+// fallbackChain predicts games that the chosen models do not predict.
+// It tries, in order, the next-best model from the same tracker, a configured secondary model, and a heuristic
+// based on home field advantage and rankings. Fallback models are loaded only when they are first needed, and a
+// fallback model that cannot be loaded is skipped for the rest of the run.
+type fallbackChain struct {
+	primary       map[string]*firestore.DocumentSnapshot
+	secondaryPath string
+	teams         *TeamResolver
+
+	nextBest        map[string]*Model
+	secondary       *Model
+	secondaryLoaded bool
+}
+
+// newFallbackChain makes a fallback chain for the chosen models (as returned by GetModels) and an optional secondary model path.
+func newFallbackChain(primary map[string]*firestore.DocumentSnapshot, secondaryPath string, teams *TeamResolver) *fallbackChain {
+	return &fallbackChain{
+		primary:       primary,
+		secondaryPath: secondaryPath,
+		teams:         teams,
+		nextBest:      make(map[string]*Model),
+	}
+}
+
+// predict looks up the game in the model, falling back as necessary.
+// A game can always be predicted by the heuristic at the end of the chain, so fallback models that cannot be loaded
+// are logged and skipped.
+func (fc *fallbackChain) predict(ctx context.Context, gameType string, model *Model, game bpefs.Game) *gamePrediction {
+	pred, ref, swap, err := model.Lookup(game.HomeTeam, game.AwayTeam)
+	if err == nil {
+		return &gamePrediction{prediction: pred, ref: ref, swap: swap, system: model.Performance.System, distribution: model.Distribution}
+	}
+	l := logFrom(ctx).With("row", game.Row)
+	l.Warnf("Model '%s' cannot predict game: %v", model.Performance.System, err)
+
+	next, err := fc.nextBestModel(ctx, gameType)
+	if err != nil {
+		l.Warnf("Skipping next-best model: %v", err)
+	}
+	if next != nil {
+		pred, ref, swap, err := next.Lookup(game.HomeTeam, game.AwayTeam)
+		if err == nil {
+			return &gamePrediction{prediction: pred, ref: ref, swap: swap, system: next.Performance.System, distribution: next.Distribution, fallback: fmt.Sprintf("next-best model '%s'", next.Performance.System)}
+		}
+		l.Warnf("Next-best model '%s' cannot predict game: %v", next.Performance.System, err)
+	}
+
+	secondary, err := fc.secondaryModel(ctx, gameType)
+	if err != nil {
+		l.Warnf("Skipping secondary model: %v", err)
+	}
+	if secondary != nil {
+		pred, ref, swap, err := secondary.Lookup(game.HomeTeam, game.AwayTeam)
+		if err == nil {
+			return &gamePrediction{prediction: pred, ref: ref, swap: swap, system: secondary.Performance.System, distribution: secondary.Distribution, fallback: fmt.Sprintf("secondary model '%s'", secondary.Performance.System)}
+		}
+		l.Warnf("Secondary model '%s' cannot predict game: %v", secondary.Performance.System, err)
+	}
+
+	sigma := model.Distribution.Sigma
+	if sigma <= 0 {
+		sigma = heuristicStdDev
+	}
+	l.Warnf("Falling back to home field and ranking heuristic")
+	return heuristicPrediction(game, sigma)
+}
+
+// nextBestModel loads the best model for the game type from the same tracker as the chosen model, excluding the chosen model itself.
+// It returns nil if there is no other model, or if the model could not be loaded before.
+func (fc *fallbackChain) nextBestModel(ctx context.Context, gameType string) (*Model, error) {
+	if m, ok := fc.nextBest[gameType]; ok {
+		return m, nil
+	}
+	fc.nextBest[gameType] = nil // not tried again if it fails to load
+	primary := fc.primary[gameType]
+	criterion, _ := criterionFor(gameType)
+	docs, err := primary.Ref.Parent.OrderBy(criterion.orderBy, criterion.dir).Limit(2).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, backendError(err, "failed getting next-best model for %s picks", gameType)
+	}
+	var next *Model
+	for _, doc := range docs {
+		if doc.Ref.Path == primary.Ref.Path {
+			continue
+		}
+		next, err = loadModel(ctx, doc, fc.teams)
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	fc.nextBest[gameType] = next
+	return next, nil
+}
+
+// secondaryModel loads the configured secondary model from the same tracker as the chosen model for the game type.
+// It returns nil if no secondary model is configured, or if the model could not be loaded before.
+func (fc *fallbackChain) secondaryModel(ctx context.Context, gameType string) (*Model, error) {
+	if fc.secondaryLoaded || fc.secondaryPath == "" {
+		return fc.secondary, nil
+	}
+	fc.secondaryLoaded = true // not tried again if it fails to load
+	modelPerfs := fc.primary[gameType].Ref.Parent
+	doc, err := modelPerfs.Where("model", "==", fsclient.Doc(fc.secondaryPath)).Limit(1).Documents(ctx).Next()
+	if err != nil {
+		return nil, backendError(err, "failed to get secondary model at path '%s'", fc.secondaryPath)
+	}
+	fc.secondary, err = loadModel(ctx, doc, fc.teams)
+	if err != nil {
+		return nil, err
+	}
+	return fc.secondary, nil
+}
+
+// heuristicPrediction predicts a game from home field advantage and the rankings of the teams in the slate.
+func heuristicPrediction(game bpefs.Game, sigma float64) *gamePrediction {
+	spread := heuristicRankPoints * float64(rankRating(game.HomeRank)-rankRating(game.AwayRank))
+	if !game.NeutralSite {
+		spread += heuristicHomeAdvantage
+	}
+	return &gamePrediction{
+		prediction: &bpefs.Prediction{
+			HomeTeam:    game.HomeTeam,
+			AwayTeam:    game.AwayTeam,
+			NeutralSite: game.NeutralSite,
+			Spread:      spread,
+		},
+		distribution: distuv.Normal{Mu: 0, Sigma: sigma},
+		fallback:     "home field and ranking heuristic",
+	}
+}
+
+// rankRating converts a rank into a rating where higher is better.
+func rankRating(rank int) int {
+	if rank <= 0 {
+		return 0
+	}
+	return 26 - rank
+}
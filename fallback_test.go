@@ -0,0 +1,129 @@
+package pickem4me
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+func TestRankRating(t *testing.T) {
+	tests := []struct {
+		rank int
+		want int
+	}{
+		{1, 25},
+		{10, 16},
+		{25, 1},
+		{0, 0}, // unranked is 26th
+		{-1, 0},
+	}
+	for _, tt := range tests {
+		if got := rankRating(tt.rank); got != tt.want {
+			t.Errorf("rank %d: expected rating %d, got %d", tt.rank, tt.want, got)
+		}
+	}
+}
+
+func TestHeuristicPrediction(t *testing.T) {
+	tests := []struct {
+		name               string
+		homeRank, awayRank int
+		neutral            bool
+		want               float64
+	}{
+		{"unranked at home", 0, 0, false, heuristicHomeAdvantage},
+		{"unranked at a neutral site", 0, 0, true, 0},
+		{"better home team", 1, 11, false, 5 + heuristicHomeAdvantage},
+		{"better road team", 11, 1, false, -5 + heuristicHomeAdvantage},
+		{"better road team at a neutral site", 11, 1, true, -5},
+		{"ranked against unranked", 25, 0, true, 0.5},
+		{"unranked against ranked", 0, 20, true, -3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := bpefs.Game{HomeTeam: teamRef("iowa"), AwayTeam: teamRef("michigan"), HomeRank: tt.homeRank, AwayRank: tt.awayRank, NeutralSite: tt.neutral}
+			gp := heuristicPrediction(game, 12)
+			if gp.prediction.Spread != tt.want {
+				t.Errorf("expected spread %g in favor of the home team, got %g", tt.want, gp.prediction.Spread)
+			}
+			if gp.prediction.HomeTeam.ID != "iowa" || gp.prediction.NeutralSite != tt.neutral {
+				t.Errorf("expected the slate's home team and site, got %+v", gp.prediction)
+			}
+			if gp.distribution.Mu != 0 || gp.distribution.Sigma != 12 || gp.fallback == "" || gp.ref != nil {
+				t.Errorf("expected an unbiased heuristic prediction with sigma 12, got %+v", gp)
+			}
+		})
+	}
+}
+
+// testModel makes a model that predicts the given games, each as "home-road".
+func testModel(system string, games ...string) *Model {
+	var preds []bpefs.Prediction
+	var refs []*firestore.DocumentRef
+	for _, g := range games {
+		teams := strings.Split(g, "-")
+		preds = append(preds, bpefs.Prediction{HomeTeam: teamRef(teams[0]), AwayTeam: teamRef(teams[1]), Spread: 7})
+		refs = append(refs, testClient.Doc("predictions/"+system+"-"+g))
+	}
+	return NewModel(bpefs.ModelPerformance{System: system, StdDev: 10}, preds, refs, nil)
+}
+
+func TestFallbackChainOrder(t *testing.T) {
+	old := fsclient
+	fsclient = testClient
+	t.Cleanup(func() { fsclient = old })
+
+	game := bpefs.Game{Row: 1, HomeTeam: teamRef("iowa"), AwayTeam: teamRef("purdue")}
+	primary := map[string]*firestore.DocumentSnapshot{
+		"StraightUp": {Ref: testClient.Doc("prediction_tracker/1/model_performance/line")},
+	}
+	tests := []struct {
+		name         string
+		model        *Model
+		nextBest     *Model
+		secondary    *Model
+		loadFails    bool
+		wantSystem   string
+		wantFallback string
+	}{
+		{"chosen model", testModel("line", "iowa-purdue"), testModel("sagarin", "iowa-purdue"), nil, false, "line", ""},
+		{"next-best model", testModel("line"), testModel("sagarin", "iowa-purdue"), testModel("massey", "iowa-purdue"), false, "sagarin", "next-best model 'sagarin'"},
+		{"secondary model", testModel("line"), testModel("sagarin"), testModel("massey", "iowa-purdue"), false, "massey", "secondary model 'massey'"},
+		{"no next-best model", testModel("line"), nil, testModel("massey", "iowa-purdue"), false, "massey", "secondary model 'massey'"},
+		{"heuristic", testModel("line"), testModel("sagarin"), testModel("massey"), false, "", "home field and ranking heuristic"},
+		{"fallback models fail to load", testModel("line"), nil, nil, true, "", "home field and ranking heuristic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := newFallbackChain(primary, "", nil)
+			ctx := context.Background()
+			if tt.loadFails {
+				// Nothing is preloaded, and the models cannot be read from a cancelled context.
+				fc.secondaryPath = "models/massey"
+				cctx, cancel := context.WithCancel(ctx)
+				cancel()
+				ctx = cctx
+			} else {
+				fc.nextBest["StraightUp"] = tt.nextBest
+				fc.secondary, fc.secondaryLoaded = tt.secondary, true
+			}
+
+			gp := fc.predict(ctx, "StraightUp", tt.model, game)
+			if gp.system != tt.wantSystem || gp.fallback != tt.wantFallback {
+				t.Errorf("expected system '%s' with fallback '%s', got '%s' with '%s'", tt.wantSystem, tt.wantFallback, gp.system, gp.fallback)
+			}
+			if tt.loadFails {
+				if next, err := fc.nextBestModel(ctx, "StraightUp"); next != nil || err != nil {
+					t.Errorf("expected the next-best model skipped after failing to load, got %v, %v", next, err)
+				}
+				if secondary, err := fc.secondaryModel(ctx, "StraightUp"); secondary != nil || err != nil {
+					t.Errorf("expected the secondary model skipped after failing to load, got %v, %v", secondary, err)
+				}
+			}
+		})
+	}
+}
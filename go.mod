@@ -19,6 +19,11 @@ require (
 	google.golang.org/genproto v0.0.0-20210825212027-de86158e7fda // indirect
 )
 
+require (
+	google.golang.org/grpc v1.40.0
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
+)
+
 require (
 	cloud.google.com/go v0.93.3 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
@@ -27,7 +32,5 @@ require (
 	github.com/stretchr/testify v1.7.0 // indirect
 	go.opencensus.io v0.23.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
-	google.golang.org/grpc v1.40.0 // indirect
 	google.golang.org/protobuf v1.27.1 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
 )
@@ -0,0 +1,128 @@
+package pickem4me
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxRequestBytes is the largest request body accepted by PickEmHTTP.
+const maxRequestBytes = 1 << 20
+
+// httpError is the body of an error response from PickEmHTTP.
+type httpError struct {
+	// Error describes what went wrong.
+	Error string `json:"error"`
+
+	// Kind is the kind of failure, such as "not_found" or "transient".
+	Kind string `json:"kind"`
+
+	// Retryable is set if the request might succeed if it is retried.
+	Retryable bool `json:"retryable"`
+}
+
+// pickFunc makes picks for a message.
+// It is a variable so that PickEmHTTP and the event handlers can be exercised without Firestore.
+var pickFunc = pickAndPublish
+
+// PickEmHTTP picks a slate for a picker as requested by a PickEmMessage in the body of a POST request.
+// It responds synchronously with the pick set in JSON, or with the filled slate as an Excel download if the request
+// has the query parameter "download=xlsx" or accepts only the Excel content type.
+//
+// Malformed or invalid messages get a 400 response and other methods than POST get 405.
+// Failures to pick get a status that depends on the kind of failure: 404 if the slate, picker, or a model was not found,
+// 409 if the pick deadline has passed, 422 if the data in Firestore is inconsistent, 503 if a backend failed
+// transiently, 504 if the request timed out, and 500 otherwise.
+// Error responses have a JSON body with "error", "kind", and "retryable" fields.
+func PickEmHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeHTTPError(w, http.StatusMethodNotAllowed, newError(KindInvalidInput, "method %s not allowed", r.Method))
+		return
+	}
+
+	var pem PickEmMessage
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&pem); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, newError(KindInvalidInput, "malformed message: %v", err))
+		return
+	}
+	if err := checkMessage(pem); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	download := wantsXLSX(r)
+	ctx := r.Context()
+	if trace := traceOf(r.Header.Get("X-Cloud-Trace-Context")); trace != "" {
+		ctx = withLogger(ctx, logger.With(traceField, trace))
+	}
+	picks, err := pickFunc(ctx, pem)
+	if err != nil {
+		logFrom(ctx).Errorf("Failed picking slate '%s' for picker '%s': %v", pem.Slate, pem.Picker, err)
+		status := httpStatus(err)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		writeHTTPError(w, status, err)
+		return
+	}
+
+	if download {
+		f := outputFormats["xlsx"]
+		xl, err := newExcelFile(ctx, picks)
+		if err != nil {
+			writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("failed making %s output: %v", f.ext, err))
+			return
+		}
+		buf, err := xl.WriteToBuffer()
+		if err != nil {
+			writeHTTPError(w, http.StatusInternalServerError, fmt.Errorf("failed writing %s output: %v", f.ext, err))
+			return
+		}
+		w.Header().Set("Content-Type", f.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", downloadName(picks, f.ext)))
+		w.WriteHeader(http.StatusOK)
+		if _, err := buf.WriteTo(w); err != nil {
+			logFrom(ctx).Warnf("Failed sending %s output: %v", f.ext, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", outputFormats["json"].contentType)
+	w.WriteHeader(http.StatusOK)
+	if err := writeJSON(w, picks); err != nil {
+		logFrom(ctx).Warnf("Failed sending pick set: %v", err)
+	}
+}
+
+// wantsXLSX reports whether a request asks for the Excel download rather than JSON.
+func wantsXLSX(r *http.Request) bool {
+	if r.URL.Query().Get("download") == "xlsx" {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, outputFormats["xlsx"].contentType) && !strings.Contains(accept, "json")
+}
+
+// downloadName names the Excel download after the picker and week.
+func downloadName(ps *PickSet, ext string) string {
+	picker := "picks"
+	if ps.Picker != nil {
+		picker = ps.Picker.ID
+	}
+	return fmt.Sprintf("%s-week%d.%s", picker, ps.Week, ext)
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", outputFormats["json"].contentType)
+	w.WriteHeader(status)
+	body := httpError{Error: err.Error(), Kind: KindOf(err).String(), Retryable: IsRetryable(err)}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Warnf("Failed sending error response: %v", err)
+	}
+}
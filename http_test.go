@@ -0,0 +1,166 @@
+package pickem4me
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubPicks replaces pickFunc for the rest of the test.
+func stubPicks(t *testing.T, f func(context.Context, PickEmMessage) (*PickSet, error)) {
+	old := pickFunc
+	pickFunc = f
+	t.Cleanup(func() { pickFunc = old })
+}
+
+const testMessage = `{"slate": "seasons/2021/weeks/5/slates/1", "picker": "LUKE"}`
+
+func TestPickEmHTTPNegotiation(t *testing.T) {
+	stubPicks(t, func(ctx context.Context, pem PickEmMessage) (*PickSet, error) {
+		return &PickSet{Week: 5, Picker: testClient.Collection("pickers").Doc(pem.Picker)}, nil
+	})
+
+	tests := []struct {
+		name            string
+		target          string
+		accept          string
+		wantContentType string
+		wantDownload    bool
+	}{
+		{"default", "/", "", outputFormats["json"].contentType, false},
+		{"query", "/?download=xlsx", "", outputFormats["xlsx"].contentType, true},
+		{"accept xlsx", "/", outputFormats["xlsx"].contentType, outputFormats["xlsx"].contentType, true},
+		{"accept xlsx or json", "/", outputFormats["xlsx"].contentType + ", application/json", outputFormats["json"].contentType, false},
+		{"other query", "/?download=csv", "", outputFormats["json"].contentType, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(testMessage))
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			PickEmHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("expected content type %q, got %q", tt.wantContentType, got)
+			}
+			disposition := w.Header().Get("Content-Disposition")
+			if tt.wantDownload {
+				if !strings.Contains(disposition, `filename="LUKE-week5.xlsx"`) {
+					t.Errorf("expected an Excel attachment, got %q", disposition)
+				}
+				if !strings.HasPrefix(w.Body.String(), "PK") {
+					t.Errorf("expected a zipped workbook in the body")
+				}
+				return
+			}
+			if disposition != "" {
+				t.Errorf("expected no attachment, got %q", disposition)
+			}
+			var ps map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &ps); err != nil {
+				t.Errorf("expected a JSON pick set, got %v: %s", err, w.Body)
+			}
+		})
+	}
+}
+
+func TestPickEmHTTPBadRequests(t *testing.T) {
+	var called bool
+	stubPicks(t, func(context.Context, PickEmMessage) (*PickSet, error) {
+		called = true
+		return &PickSet{}, nil
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{"get", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"put", http.MethodPut, testMessage, http.StatusMethodNotAllowed},
+		{"not json", http.MethodPost, "slate=1", http.StatusBadRequest},
+		{"empty body", http.MethodPost, "", http.StatusBadRequest},
+		{"unknown field", http.MethodPost, `{"slate": "seasons/2021/weeks/5/slates/1", "picker": "LUKE", "superdog": true}`, http.StatusBadRequest},
+		{"no picker", http.MethodPost, `{"slate": "seasons/2021/weeks/5/slates/1"}`, http.StatusBadRequest},
+		{"bad slate path", http.MethodPost, `{"slate": "seasons/2021/weeks", "picker": "LUKE"}`, http.StatusBadRequest},
+		{"too large", http.MethodPost, `{"slate": "` + strings.Repeat("a", maxRequestBytes) + `"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = false
+			w := httptest.NewRecorder()
+			PickEmHTTP(w, httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if called {
+				t.Errorf("expected no picks to be made")
+			}
+			var body httpError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("expected a JSON error, got %v: %s", err, w.Body)
+			}
+			if body.Kind != KindInvalidInput.String() || body.Retryable {
+				t.Errorf("expected a permanent invalid input error, got %+v", body)
+			}
+			if tt.wantStatus == http.StatusMethodNotAllowed && w.Header().Get("Allow") != http.MethodPost {
+				t.Errorf("expected Allow: POST, got %q", w.Header().Get("Allow"))
+			}
+		})
+	}
+}
+
+func TestPickEmHTTPErrorStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantStatus    int
+		wantRetryable bool
+	}{
+		{"invalid input", newError(KindInvalidInput, "bad model"), http.StatusBadRequest, false},
+		{"not found", newError(KindNotFound, "no slate"), http.StatusNotFound, false},
+		{"inconsistent", newError(KindInconsistent, "bad slate"), http.StatusUnprocessableEntity, false},
+		{"deadline passed", newError(KindDeadlinePassed, "too late"), http.StatusConflict, false},
+		{"transient", newError(KindTransient, "unavailable"), http.StatusServiceUnavailable, true},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError, false},
+		{"request timed out", context.DeadlineExceeded, http.StatusGatewayTimeout, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPicks(t, func(ctx context.Context, _ PickEmMessage) (*PickSet, error) {
+				return nil, tt.err
+			})
+			ctx := context.Background()
+			if errors.Is(tt.err, context.DeadlineExceeded) {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, 0)
+				defer cancel()
+			}
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testMessage)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			PickEmHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			var body httpError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("expected a JSON error, got %v: %s", err, w.Body)
+			}
+			if body.Kind != KindOf(tt.err).String() || body.Retryable != tt.wantRetryable {
+				t.Errorf("expected kind %s retryable %t, got %+v", KindOf(tt.err), tt.wantRetryable, body)
+			}
+		})
+	}
+}
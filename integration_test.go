@@ -0,0 +1,421 @@
+//go:build integration
+// +build integration
+
+// Integration tests run PickEm end to end against the Firestore emulator and a fake Cloud Storage server.
+// They are built only with the integration tag and are skipped unless both emulators are configured:
+//
+//	gcloud beta emulators firestore start --host-port=localhost:8080
+//	docker run -p 4443:4443 fsouza/fake-gcs-server -scheme http
+//	FIRESTORE_EMULATOR_HOST=localhost:8080 STORAGE_EMULATOR_HOST=http://localhost:4443/storage/v1/ \
+//		go test -tags integration -run Integration .
+//
+// Every test works in a project and bucket of its own, so the emulators need not be reset between runs.
+package pickem4me
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/360EntSecGroup-Skylar/excelize"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// mailbox is a Sender that keeps the mail it is given.
+type mailbox struct {
+	mu   sync.Mutex
+	sent []*Mail
+}
+
+func (m *mailbox) Send(ctx context.Context, mail *Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, mail)
+	return nil
+}
+
+// fixture is a seeded season in the emulators.
+type fixture struct {
+	ctx    context.Context
+	bucket string
+	mail   *mailbox
+
+	season *firestore.DocumentRef
+	slate  *firestore.DocumentRef
+	picker *firestore.DocumentRef
+
+	// suModel and nsModel are the model performance documents that should be chosen for straight-up picks
+	// (greatest suw) and for noisy spread and superdog picks (least mae).
+	suModel *firestore.DocumentRef
+	nsModel *firestore.DocumentRef
+}
+
+// newFixture connects to the emulators and seeds a week of a season, or skips the test if there are no emulators.
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" || os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST and STORAGE_EMULATOR_HOST are not both set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+
+	id := fmt.Sprintf("pickem4me-it-%d", time.Now().UnixNano())
+	if err := Connect(ctx, id, ""); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := csclient.Bucket(id).Create(ctx, id, nil); err != nil {
+		t.Fatalf("failed creating bucket '%s': %v", id, err)
+	}
+	mail := &mailbox{}
+	previous := mailer
+	SetSender(mail)
+	t.Cleanup(func() { SetSender(previous) })
+
+	f := &fixture{ctx: ctx, bucket: id, mail: mail}
+	f.seed(t)
+	return f
+}
+
+// team returns a reference to a team document.
+func team(id string) *firestore.DocumentRef {
+	return fsclient.Collection("teams").Doc(id)
+}
+
+// set writes a document, failing the test if it cannot.
+func (f *fixture) set(t *testing.T, ref *firestore.DocumentRef, data interface{}) {
+	t.Helper()
+	if _, err := ref.Set(f.ctx, data); err != nil {
+		t.Fatalf("failed seeding '%s': %v", refPath(ref), err)
+	}
+}
+
+// seed writes the teams, slate, picker, prediction trackers, and streak prediction of week 5 of the 2021 season.
+//
+// The slate has two straight-up games (rows 1 and 2), a noisy spread game (row 3), and two superdog games (rows 6 and 7).
+// The two models of the latest tracker disagree about every game, so the picks show which model made them.
+func (f *fixture) seed(t *testing.T) {
+	t.Helper()
+	teams := []struct {
+		id                  string
+		name4, school, nick string
+	}{
+		{"iowa", "IOWA", "Iowa", "Hawkeyes"},
+		{"michigan", "MICH", "Michigan", "Wolverines"},
+		{"ohio-state", "OSU", "Ohio State", "Buckeyes"},
+		{"penn-state", "PSU", "Penn State", "Nittany Lions"},
+		{"wisconsin", "WISC", "Wisconsin", "Badgers"},
+		{"minnesota", "MINN", "Minnesota", "Golden Gophers"},
+		{"indiana", "IND", "Indiana", "Hoosiers"},
+		{"purdue", "PUR", "Purdue", "Boilermakers"},
+		{"illinois", "ILL", "Illinois", "Fighting Illini"},
+		{"rutgers", "RUT", "Rutgers", "Scarlet Knights"},
+	}
+	for _, tm := range teams {
+		f.set(t, team(tm.id), bpefs.Team{Name4: tm.name4, LukeNames: []string{tm.school}, School: tm.school, Name: tm.nick})
+	}
+
+	f.season = fsclient.Collection("seasons").Doc("2021")
+	f.set(t, f.season, map[string]interface{}{"year": 2021})
+
+	kickoff := time.Now().Add(72 * time.Hour).UTC().Truncate(time.Second)
+	f.slate = f.season.Collection("weeks").Doc("5").Collection("slates").Doc("week5")
+	f.set(t, f.slate, map[string]interface{}{
+		"bucket_name": f.bucket,
+		"file":        "week5.xlsx",
+		"created":     time.Now(),
+		"season":      f.season,
+		"week":        5,
+		"deadline":    kickoff.Add(-time.Hour),
+	})
+	games := []map[string]interface{}{
+		{"row": 1, "home": team("iowa"), "road": team("michigan"), "gotw": true},
+		{"row": 2, "home": team("ohio-state"), "road": team("penn-state"), "rank1": 3, "rank2": 7},
+		{"row": 3, "home": team("wisconsin"), "road": team("minnesota"), "noisy_spread": 7},
+		{"row": 6, "home": team("indiana"), "road": team("purdue"), "superdog": true, "overdog": team("indiana"), "underdog": team("purdue"), "value": 10},
+		{"row": 7, "home": team("illinois"), "road": team("rutgers"), "superdog": true, "overdog": team("illinois"), "underdog": team("rutgers"), "value": 5},
+	}
+	for _, g := range games {
+		g["kickoff"] = kickoff
+		f.set(t, f.slate.Collection("games").Doc(fmt.Sprintf("row%d", g["row"])), g)
+	}
+
+	f.picker = fsclient.Collection("pickers").Doc("luke")
+	f.set(t, f.picker, map[string]interface{}{
+		"name":       "Luke Tester",
+		"name_luke":  "LUKE",
+		"joined":     time.Date(2019, 8, 1, 0, 0, 0, 0, time.UTC),
+		"recipients": []string{"luke@example.com"},
+	})
+
+	// An older tracker has a model that would be chosen for everything if the latest tracker were ignored.
+	stale := fsclient.Collection("prediction_tracker").Doc("stale")
+	f.set(t, stale, map[string]interface{}{"timestamp": time.Now().Add(-7 * 24 * time.Hour)})
+	f.set(t, stale.Collection("model_performance").Doc("stale"), bpefs.ModelPerformance{
+		Rank: 1, System: "Stale", MAE: 1, StdDev: 10, Wins: 999, Model: fsclient.Collection("models").Doc("stale"),
+	})
+
+	tracker := fsclient.Collection("prediction_tracker").Doc("latest")
+	f.set(t, tracker, map[string]interface{}{"timestamp": time.Now().Add(-time.Hour)})
+	perfs := tracker.Collection("model_performance")
+	f.suModel = perfs.Doc("winner")
+	f.set(t, f.suModel, bpefs.ModelPerformance{
+		Rank: 1, System: "Winner", GamesPredicted: 100, Wins: 80, Losses: 20, PercentCorrect: 0.8,
+		MAE: 12.5, StdDev: 15, Model: fsclient.Collection("models").Doc("winner"),
+	})
+	f.nsModel = perfs.Doc("accurate")
+	f.set(t, f.nsModel, bpefs.ModelPerformance{
+		Rank: 2, System: "Accurate", GamesPredicted: 100, Wins: 75, Losses: 25, PercentCorrect: 0.75,
+		MAE: 11, StdDev: 14, Model: fsclient.Collection("models").Doc("accurate"),
+	})
+	spreads := []struct {
+		home, road       string
+		winner, accurate float64
+	}{
+		{"iowa", "michigan", -3.5, 1},
+		{"ohio-state", "penn-state", 10, 6},
+		{"wisconsin", "minnesota", 10, 3},
+		{"indiana", "purdue", 20, 14},
+		{"illinois", "rutgers", 1, 3},
+	}
+	for _, p := range spreads {
+		id := p.home + "-" + p.road
+		f.set(t, f.suModel.Collection("predictions").Doc(id), bpefs.Prediction{HomeTeam: team(p.home), AwayTeam: team(p.road), Spread: p.winner})
+		f.set(t, f.nsModel.Collection("predictions").Doc(id), bpefs.Prediction{HomeTeam: team(p.home), AwayTeam: team(p.road), Spread: p.accurate})
+	}
+
+	f.set(t, fsclient.Collection("streak_predictions").Doc("luke-2021-5"), bpefs.StreakPredictions{
+		Picker:         f.picker,
+		Season:         f.season,
+		Week:           5,
+		TeamsRemaining: []*firestore.DocumentRef{team("ohio-state"), team("iowa")},
+		BestPick:       []*firestore.DocumentRef{team("ohio-state")},
+		Probability:    0.83,
+		Spread:         10,
+	})
+}
+
+// pickEm sends a message to PickEm as Pub/Sub would.
+func (f *fixture) pickEm(t *testing.T, pem PickEmMessage) {
+	t.Helper()
+	data, err := json.Marshal(pem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := PickEm(f.ctx, PubSubMessage{Data: data}); err != nil {
+		t.Fatalf("PickEm: %v", err)
+	}
+}
+
+// storedPicks returns the picks documents of the picker.
+func (f *fixture) storedPicks(t *testing.T) []*firestore.DocumentSnapshot {
+	t.Helper()
+	docs, err := fsclient.Collection("picks").Where("picker", "==", f.picker).Documents(f.ctx).GetAll()
+	if err != nil {
+		t.Fatalf("failed getting picks: %v", err)
+	}
+	return docs
+}
+
+// rowPicks returns the IDs of the teams picked in a subcollection of a picks document, keyed by slate row,
+// and the paths of the model performance documents whose predictions they were picked from.
+func (f *fixture) rowPicks(t *testing.T, picks *firestore.DocumentRef, collection string) (map[int]string, map[int]string) {
+	t.Helper()
+	docs, err := picks.Collection(collection).Documents(f.ctx).GetAll()
+	if err != nil {
+		t.Fatalf("failed getting %s picks: %v", collection, err)
+	}
+	teams, models := make(map[int]string), make(map[int]string)
+	for _, doc := range docs {
+		var p struct {
+			Row         int                    `firestore:"row"`
+			Pick        *firestore.DocumentRef `firestore:"pick"`
+			ModeledGame *firestore.DocumentRef `firestore:"modeled_game"`
+		}
+		if err := doc.DataTo(&p); err != nil {
+			t.Fatalf("failed parsing %s pick '%s': %v", collection, doc.Ref.ID, err)
+		}
+		if p.Pick != nil {
+			teams[p.Row] = p.Pick.ID
+		} else {
+			teams[p.Row] = ""
+		}
+		if p.ModeledGame != nil {
+			models[p.Row] = refPath(p.ModeledGame.Parent.Parent)
+		}
+	}
+	return teams, models
+}
+
+// refPathOf returns the path of a document reference read from a field, or an empty string if it is not a reference.
+func refPathOf(v interface{}) string {
+	ref, _ := v.(*firestore.DocumentRef)
+	return refPath(ref)
+}
+
+func TestIntegrationPickEm(t *testing.T) {
+	f := newFixture(t)
+	f.pickEm(t, PickEmMessage{Slate: refPath(f.slate), Picker: "LUKE"})
+
+	docs := f.storedPicks(t)
+	if len(docs) != 1 {
+		t.Fatalf("expected 1 picks document, got %d", len(docs))
+	}
+	doc := docs[0]
+	var pd picksDocument
+	if err := doc.DataTo(&pd); err != nil {
+		t.Fatalf("failed parsing picks: %v", err)
+	}
+	if refPath(pd.Season) != refPath(f.season) || pd.Week != 5 || refPath(pd.Slate) != refPath(f.slate) {
+		t.Errorf("picks are for season '%s', week %d, slate '%s'", refPath(pd.Season), pd.Week, refPath(pd.Slate))
+	}
+	if pd.Timestamp.IsZero() {
+		t.Errorf("picks have no timestamp")
+	}
+	if len(pd.LockedRows) != 0 || len(pd.Fallbacks) != 0 || len(pd.Reconciliations) != 0 || len(pd.Overrides) != 0 {
+		t.Errorf("expected no locked rows, fallbacks, reconciliations, or overrides: got %+v", pd)
+	}
+
+	// Straight-up picks come from the model with the most wins, the rest from the model with the least error.
+	tests := []struct {
+		collection string
+		picks      map[int]string
+		model      string
+	}{
+		{"straight_up", map[int]string{1: "michigan", 2: "ohio-state"}, refPath(f.suModel)},
+		{"noisy_spread", map[int]string{3: "minnesota"}, refPath(f.nsModel)},
+		{"superdog", map[int]string{6: "", 7: "rutgers"}, refPath(f.nsModel)},
+	}
+	for _, tt := range tests {
+		picks, models := f.rowPicks(t, doc.Ref, tt.collection)
+		if len(picks) != len(tt.picks) {
+			t.Errorf("expected %d %s picks, got %d: %v", len(tt.picks), tt.collection, len(picks), picks)
+		}
+		for row, want := range tt.picks {
+			if got, ok := picks[row]; !ok || got != want {
+				t.Errorf("%s row %d: expected pick '%s', got '%s'", tt.collection, row, want, got)
+			}
+			if models[row] != tt.model {
+				t.Errorf("%s row %d: expected prediction of model '%s', got '%s'", tt.collection, row, tt.model, models[row])
+			}
+		}
+	}
+
+	streaks, err := doc.Ref.Collection("streak").Documents(f.ctx).GetAll()
+	if err != nil {
+		t.Fatalf("failed getting streak: %v", err)
+	}
+	if len(streaks) != 1 {
+		t.Fatalf("expected 1 streak pick, got %d", len(streaks))
+	}
+	var streak bpefs.StreakPick
+	if err := streaks[0].DataTo(&streak); err != nil {
+		t.Fatalf("failed parsing streak: %v", err)
+	}
+	if len(streak.Picks) != 1 || streak.Picks[0].ID != "ohio-state" || streak.PredictedProbability != 0.83 {
+		t.Errorf("expected streak pick of ohio-state with probability 0.83, got %v with %v", refPaths(streak.Picks), streak.PredictedProbability)
+	}
+
+	// The run is recorded and points back to the picks.
+	run, err := pd.Run.Get(f.ctx)
+	if err != nil {
+		t.Fatalf("failed getting run: %v", err)
+	}
+	if outcome, _ := run.DataAt("outcome"); outcome != RunCompleted {
+		t.Errorf("expected run outcome '%s', got '%v'", RunCompleted, outcome)
+	}
+	if picks, _ := run.DataAt("picks"); refPathOf(picks) != refPath(doc.Ref) {
+		t.Errorf("expected run to point to picks '%s', got %v", refPath(doc.Ref), picks)
+	}
+
+	// The filled slate is uploaded next to the slate.
+	r, err := csclient.Bucket(f.bucket).Object("picks/week5.xlsx").NewReader(f.ctx)
+	if err != nil {
+		t.Fatalf("failed reading uploaded slate: %v", err)
+	}
+	defer r.Close()
+	xlsx, err := excelize.OpenReader(r)
+	if err != nil {
+		t.Fatalf("failed parsing uploaded slate: %v", err)
+	}
+	sheet := xlsx.GetSheetName(xlsx.GetActiveSheetIndex())
+	cells := []struct {
+		axis, want string
+	}{
+		{"A1", "GAME"},
+		{"C1", "Your Selection"},
+		{"A2", "** Michigan @ Iowa **"},
+		{"C2", "Wolverines"},
+		{"A3", "#7 Penn State @ #3 Ohio State"},
+		{"C3", "Buckeyes"},
+		{"A4", "Minnesota @ Wisconsin"},
+		{"B4", "Wisconsin by ≥ 7"},
+		{"C4", "Golden Gophers"},
+		{"B6", "BEAT THE STREAK!"},
+		{"C6", "Buckeyes"},
+		{"F6", "0.8300"},
+		{"B7", "Purdue over Indiana"},
+		{"C7", ""},
+		{"B8", "Rutgers over Illinois"},
+		{"C8", "Scarlet Knights"},
+	}
+	for _, c := range cells {
+		if got := xlsx.GetCellValue(sheet, c.axis); got != c.want {
+			t.Errorf("cell %s: expected '%s', got '%s'", c.axis, c.want, got)
+		}
+	}
+	if notes := xlsx.GetCellValue(sheet, "E2"); !strings.Contains(notes, "HARBAUGH!!!") {
+		t.Errorf("cell E2: expected notes on the pick of Michigan, got '%s'", notes)
+	}
+
+	// The filled slate is mailed to the picker and the delivery is recorded.
+	if len(f.mail.sent) != 1 {
+		t.Fatalf("expected 1 mail, got %d", len(f.mail.sent))
+	}
+	m := f.mail.sent[0]
+	if len(m.To) != 1 || m.To[0] != "luke@example.com" || m.Subject != "Week 5 picks for Luke Tester" {
+		t.Errorf("unexpected mail '%s' to %v", m.Subject, m.To)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Name != "week5.xlsx" || len(m.Attachments[0].Data) == 0 {
+		t.Errorf("expected the filled slate week5.xlsx attached, got %d attachments", len(m.Attachments))
+	}
+	doc, err = doc.Ref.Get(f.ctx)
+	if err != nil {
+		t.Fatalf("failed getting picks: %v", err)
+	}
+	if status, _ := doc.DataAt("delivery.status"); status != DeliverySent {
+		t.Errorf("expected delivery status '%s', got '%v'", DeliverySent, status)
+	}
+}
+
+func TestIntegrationPickEmRefusesAfterDeadline(t *testing.T) {
+	f := newFixture(t)
+	deadline := time.Now().Add(-time.Hour)
+	f.pickEm(t, PickEmMessage{Slate: refPath(f.slate), Picker: "LUKE", Deadline: &deadline})
+
+	if docs := f.storedPicks(t); len(docs) != 0 {
+		t.Errorf("expected no picks after the deadline, got %d", len(docs))
+	}
+	if len(f.mail.sent) != 0 {
+		t.Errorf("expected no mail after the deadline, got %d", len(f.mail.sent))
+	}
+	runs, err := fsclient.Collection("runs").Documents(f.ctx).GetAll()
+	if err != nil {
+		t.Fatalf("failed getting runs: %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+	if outcome, _ := runs[0].DataAt("outcome"); outcome != RunFailed {
+		t.Errorf("expected run outcome '%s', got '%v'", RunFailed, outcome)
+	}
+	if picks, _ := runs[0].DataAt("picks"); picks != nil {
+		t.Errorf("expected run without picks, got %v", picks)
+	}
+}
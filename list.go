@@ -0,0 +1,342 @@
+package pickem4me
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// SlateSummary describes a parsed slate.
+type SlateSummary struct {
+	// Path is the path to the slate, as given to pick it.
+	Path string `json:"path"`
+
+	// Season is the path to the season of the slate.
+	Season string `json:"season"`
+
+	// Week is the week of the slate.
+	Week int `json:"week"`
+
+	// Created is when the slate was parsed.
+	Created time.Time `json:"created"`
+
+	// File is the location of the original slate file in Cloud Storage.
+	File string `json:"file"`
+}
+
+// ListSlates lists parsed slates, most recent first.
+// A positive week lists only slates of that week, and a positive limit lists at most that many slates.
+func ListSlates(ctx context.Context, week, limit int) ([]SlateSummary, error) {
+	if err := connected(); err != nil {
+		return nil, err
+	}
+	docs, err := fsclient.CollectionGroup("slates").OrderBy("created", firestore.Desc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, backendError(err, "failed listing slates")
+	}
+	var slates []SlateSummary
+	for _, doc := range docs {
+		var slate bpefs.Slate
+		if err := doc.DataTo(&slate); err != nil {
+			return nil, newError(KindInconsistent, "failed parsing slate '%s': %v", refPath(doc.Ref), err)
+		}
+		if week > 0 && slate.Week != week {
+			continue
+		}
+		slates = append(slates, SlateSummary{
+			Path:    refPath(doc.Ref),
+			Season:  refPath(slate.Season),
+			Week:    slate.Week,
+			Created: slate.Created,
+			File:    "gs://" + slate.Bucket + "/" + slate.FileName,
+		})
+		if limit > 0 && len(slates) == limit {
+			break
+		}
+	}
+	return slates, nil
+}
+
+// PickerSummary describes a picker.
+type PickerSummary struct {
+	// Path is the path to the picker.
+	Path string `json:"path"`
+
+	// LukeName is the name of the picker in slates, as given to pick for them.
+	LukeName string `json:"lukeName"`
+
+	// Name is the full name of the picker.
+	Name string `json:"name"`
+
+	// Joined is when the picker joined.
+	Joined time.Time `json:"joined"`
+}
+
+// ListPickers lists every picker, ordered by Luke name.
+func ListPickers(ctx context.Context) ([]PickerSummary, error) {
+	if err := connected(); err != nil {
+		return nil, err
+	}
+	docs, err := fsclient.Collection("pickers").OrderBy("name_luke", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, backendError(err, "failed listing pickers")
+	}
+	pickers := make([]PickerSummary, 0, len(docs))
+	for _, doc := range docs {
+		var picker bpefs.Picker
+		if err := doc.DataTo(&picker); err != nil {
+			return nil, newError(KindInconsistent, "failed parsing picker '%s': %v", doc.Ref.ID, err)
+		}
+		pickers = append(pickers, PickerSummary{
+			Path:     refPath(doc.Ref),
+			LukeName: picker.LukeName,
+			Name:     picker.Name,
+			Joined:   picker.Joined,
+		})
+	}
+	return pickers, nil
+}
+
+// ModelSummary describes a model in a prediction tracker and how well it has performed.
+type ModelSummary struct {
+	// Path is the path to the model, as given to choose it for picking.
+	Path string `json:"path"`
+
+	// Performance is the path to the performance of the model in the tracker.
+	Performance string `json:"performance"`
+
+	// System is the name of the model.
+	System string `json:"system"`
+
+	// Rank is the rank of the model in the tracker.
+	Rank int `json:"rank"`
+
+	// Games is the number of games the model has predicted.
+	Games int `json:"games"`
+
+	// Wins and Losses are the games the model predicted correctly and incorrectly straight up.
+	Wins   int `json:"suw"`
+	Losses int `json:"wul"`
+
+	// PercentCorrect is the share of games the model predicted correctly straight up, as recorded by the tracker.
+	PercentCorrect float64 `json:"pct_correct"`
+
+	// WinsATS and LossesATS are the games the model predicted correctly and incorrectly against the spread.
+	WinsATS   int `json:"atsw"`
+	LossesATS int `json:"atsl"`
+
+	// PercentATS is the share of games the model predicted correctly against the spread, as recorded by the tracker.
+	PercentATS float64 `json:"pct_against_spread"`
+
+	// MAE, MSE, Bias, and StdDev are the mean absolute error, mean squared error, mean error, and standard deviation
+	// of the error of the predicted spreads.
+	MAE    float64 `json:"mae"`
+	MSE    float64 `json:"mse"`
+	Bias   float64 `json:"bias"`
+	StdDev float64 `json:"std_dev"`
+
+	// Selected are the game types ("StraightUp", "NoisySpread", "Superdog") for which GetModels selects the model
+	// when no model is requested.
+	Selected []string `json:"selected,omitempty"`
+}
+
+// modelMetrics are the metrics by which models can be sorted and filtered, by the name of their field in Firestore.
+var modelMetrics = map[string]func(m *ModelSummary) float64{
+	"rank":               func(m *ModelSummary) float64 { return float64(m.Rank) },
+	"games":              func(m *ModelSummary) float64 { return float64(m.Games) },
+	"suw":                func(m *ModelSummary) float64 { return float64(m.Wins) },
+	"wul":                func(m *ModelSummary) float64 { return float64(m.Losses) },
+	"pct_correct":        func(m *ModelSummary) float64 { return m.PercentCorrect },
+	"atsw":               func(m *ModelSummary) float64 { return float64(m.WinsATS) },
+	"atsl":               func(m *ModelSummary) float64 { return float64(m.LossesATS) },
+	"pct_against_spread": func(m *ModelSummary) float64 { return m.PercentATS },
+	"mae":                func(m *ModelSummary) float64 { return m.MAE },
+	"mse":                func(m *ModelSummary) float64 { return m.MSE },
+	"bias":               func(m *ModelSummary) float64 { return m.Bias },
+	"std_dev":            func(m *ModelSummary) float64 { return m.StdDev },
+}
+
+// ModelMetrics returns the names of the metrics by which models can be sorted and filtered, in order.
+func ModelMetrics() []string {
+	names := make([]string, 0, len(modelMetrics))
+	for name := range modelMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Metric returns the value of a metric of the model, by the name of its field in Firestore (e.g. "mae").
+func (m *ModelSummary) Metric(name string) (float64, error) {
+	f, ok := modelMetrics[name]
+	if !ok {
+		return 0, newError(KindInvalidInput, "unknown metric '%s': expected one of %s", name, strings.Join(ModelMetrics(), ", "))
+	}
+	return f(m), nil
+}
+
+// ModelList is the list of models in a prediction tracker.
+type ModelList struct {
+	// Tracker is the path to the prediction tracker.
+	Tracker string `json:"tracker"`
+
+	// Timestamp is when the tracker was updated.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Models are the models in the tracker.
+	Models []ModelSummary `json:"models"`
+}
+
+// ListModels lists the models in a prediction tracker, ordered by name, marking the models GetModels would select
+// from that tracker. The tracker is given by its path or ID; an empty tracker lists the models in the latest tracker,
+// which is the one GetModels uses.
+func ListModels(ctx context.Context, tracker string) (*ModelList, error) {
+	if err := connected(); err != nil {
+		return nil, err
+	}
+	var doc *firestore.DocumentSnapshot
+	var err error
+	switch {
+	case tracker == "":
+		doc, err = fsclient.Collection("prediction_tracker").OrderBy("timestamp", firestore.Desc).Limit(1).Documents(ctx).Next()
+		if err != nil {
+			return nil, backendError(err, "failed to get latest prediction tracker")
+		}
+	case !strings.Contains(tracker, "/"):
+		tracker = "prediction_tracker/" + tracker
+		fallthrough
+	default:
+		if !validDocPath(tracker) {
+			return nil, newError(KindInvalidInput, "'%s' is not a document path", tracker)
+		}
+		doc, err = fsclient.Doc(tracker).Get(ctx)
+		if err != nil {
+			return nil, backendError(err, "failed getting prediction tracker '%s'", tracker)
+		}
+	}
+	list := &ModelList{Tracker: refPath(doc.Ref)}
+	if t, err := doc.DataAt("timestamp"); err == nil {
+		list.Timestamp, _ = t.(time.Time)
+	}
+
+	docs, err := doc.Ref.Collection("model_performance").OrderBy("system", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, backendError(err, "failed listing models of tracker '%s'", doc.Ref.ID)
+	}
+	list.Models = make([]ModelSummary, 0, len(docs))
+	for _, doc := range docs {
+		var perf bpefs.ModelPerformance
+		if err := doc.DataTo(&perf); err != nil {
+			return nil, newError(KindInconsistent, "failed parsing model performance '%s': %v", doc.Ref.ID, err)
+		}
+		list.Models = append(list.Models, ModelSummary{
+			Path:           refPath(perf.Model),
+			Performance:    refPath(doc.Ref),
+			System:         perf.System,
+			Rank:           perf.Rank,
+			Games:          perf.GamesPredicted,
+			Wins:           perf.Wins,
+			Losses:         perf.Losses,
+			PercentCorrect: perf.PercentCorrect,
+			WinsATS:        perf.WinsATS,
+			LossesATS:      perf.LossesATS,
+			PercentATS:     perf.PercentATS,
+			MAE:            perf.MAE,
+			MSE:            perf.MSE,
+			Bias:           perf.Bias,
+			StdDev:         perf.StdDev,
+		})
+	}
+	markSelected(list.Models, docs)
+	return list, nil
+}
+
+// markSelected marks the models chosen by modelCriteria for each game type, breaking ties by document ID the way
+// Firestore orders query results.
+func markSelected(models []ModelSummary, docs []*firestore.DocumentSnapshot) {
+	for _, gameType := range []string{"StraightUp", "NoisySpread", "Superdog"} {
+		c, _ := criterionFor(gameType)
+		best := -1
+		for i := range models {
+			if best < 0 {
+				best = i
+				continue
+			}
+			v, bv := modelMetrics[c.orderBy](&models[i]), modelMetrics[c.orderBy](&models[best])
+			id, bid := docs[i].Ref.ID, docs[best].Ref.ID
+			if c.dir == firestore.Desc {
+				v, bv = -v, -bv
+				id, bid = bid, id
+			}
+			if v < bv || (v == bv && id < bid) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			models[best].Selected = append(models[best].Selected, gameType)
+		}
+	}
+}
+
+// SortModels sorts models by a metric, in ascending or descending order. Models with equal values keep their order.
+func SortModels(models []ModelSummary, metric string, desc bool) error {
+	f, ok := modelMetrics[metric]
+	if !ok {
+		return newError(KindInvalidInput, "unknown metric '%s': expected one of %s", metric, strings.Join(ModelMetrics(), ", "))
+	}
+	sort.SliceStable(models, func(i, j int) bool {
+		if desc {
+			return f(&models[i]) > f(&models[j])
+		}
+		return f(&models[i]) < f(&models[j])
+	})
+	return nil
+}
+
+// modelFilterOps are the comparisons a model filter can make, longest first so that "<=" is not read as "<".
+var modelFilterOps = []struct {
+	op      string
+	compare func(a, b float64) bool
+}{
+	{"<=", func(a, b float64) bool { return a <= b }},
+	{">=", func(a, b float64) bool { return a >= b }},
+	{"!=", func(a, b float64) bool { return a != b }},
+	{"==", func(a, b float64) bool { return a == b }},
+	{"<", func(a, b float64) bool { return a < b }},
+	{">", func(a, b float64) bool { return a > b }},
+	{"=", func(a, b float64) bool { return a == b }},
+}
+
+// FilterModels returns the models that satisfy a filter comparing a metric with a number, such as "mae<12" or
+// "games>=100". The comparisons are <, <=, >, >=, = (or ==), and !=.
+func FilterModels(models []ModelSummary, filter string) ([]ModelSummary, error) {
+	for _, o := range modelFilterOps {
+		i := strings.Index(filter, o.op)
+		if i < 0 {
+			continue
+		}
+		name := strings.TrimSpace(filter[:i])
+		f, ok := modelMetrics[name]
+		if !ok {
+			return nil, newError(KindInvalidInput, "unknown metric '%s' in filter '%s': expected one of %s", name, filter, strings.Join(ModelMetrics(), ", "))
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(filter[i+len(o.op):]), 64)
+		if err != nil {
+			return nil, newError(KindInvalidInput, "bad value in filter '%s': %v", filter, err)
+		}
+		var kept []ModelSummary
+		for j := range models {
+			if o.compare(f(&models[j]), value) {
+				kept = append(kept, models[j])
+			}
+		}
+		return kept, nil
+	}
+	return nil, newError(KindInvalidInput, "bad filter '%s': expected a metric, a comparison, and a number, such as 'mae<12'", filter)
+}
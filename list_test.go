@@ -0,0 +1,138 @@
+package pickem4me
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+)
+
+// testModels returns model summaries of three systems.
+func testModels() []ModelSummary {
+	return []ModelSummary{
+		{System: "line", Games: 100, Wins: 70, MAE: 12, Bias: 0.5},
+		{System: "massey", Games: 120, Wins: 65, MAE: 11, Bias: -1},
+		{System: "sagarin", Games: 80, Wins: 70, MAE: 13, Bias: 0.5},
+	}
+}
+
+// systems returns the systems of model summaries, in order.
+func systems(models []ModelSummary) []string {
+	var names []string
+	for _, m := range models {
+		names = append(names, m.System)
+	}
+	return names
+}
+
+func TestSortModels(t *testing.T) {
+	tests := []struct {
+		metric  string
+		desc    bool
+		want    []string
+		wantErr bool
+	}{
+		{"mae", false, []string{"massey", "line", "sagarin"}, false},
+		{"mae", true, []string{"sagarin", "line", "massey"}, false},
+		{"games", false, []string{"sagarin", "line", "massey"}, false},
+		{"games", true, []string{"massey", "line", "sagarin"}, false},
+		{"suw", true, []string{"line", "sagarin", "massey"}, false}, // ties keep their order
+		{"bias", false, []string{"massey", "line", "sagarin"}, false},
+		{"luck", false, []string{"line", "massey", "sagarin"}, true},
+	}
+	for _, tt := range tests {
+		models := testModels()
+		err := SortModels(models, tt.metric, tt.desc)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("%s desc %t: expected error %t, got %v", tt.metric, tt.desc, tt.wantErr, err)
+		}
+		if err != nil && KindOf(err) != KindInvalidInput {
+			t.Errorf("%s: expected invalid input, got %v", tt.metric, err)
+		}
+		if got := systems(models); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s desc %t: expected %v, got %v", tt.metric, tt.desc, tt.want, got)
+		}
+	}
+}
+
+func TestFilterModels(t *testing.T) {
+	tests := []struct {
+		filter  string
+		want    []string
+		wantErr string
+	}{
+		{"mae<12", []string{"massey"}, ""},
+		{"mae<=12", []string{"line", "massey"}, ""},
+		{"mae > 12", []string{"sagarin"}, ""},
+		{"games>=100", []string{"line", "massey"}, ""},
+		{"suw=70", []string{"line", "sagarin"}, ""},
+		{"suw==70", []string{"line", "sagarin"}, ""},
+		{"suw!=70", []string{"massey"}, ""},
+		{"bias<-0.5", []string{"massey"}, ""},
+		{"games>1000", nil, ""},
+		{"luck<3", nil, "unknown metric 'luck'"},
+		{"mae<twelve", nil, "bad value in filter 'mae<twelve'"},
+		{"mae<", nil, "bad value"},
+		{"mae", nil, "bad filter 'mae'"},
+		{"", nil, "bad filter ''"},
+	}
+	for _, tt := range tests {
+		got, err := FilterModels(testModels(), tt.filter)
+		if tt.wantErr != "" {
+			if KindOf(err) != KindInvalidInput || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: expected invalid input containing %q, got %v", tt.filter, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.filter, err)
+			continue
+		}
+		if !reflect.DeepEqual(systems(got), tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.filter, tt.want, systems(got))
+		}
+	}
+}
+
+func TestMarkSelected(t *testing.T) {
+	docs := func(ids ...string) []*firestore.DocumentSnapshot {
+		var snaps []*firestore.DocumentSnapshot
+		for _, id := range ids {
+			snaps = append(snaps, &firestore.DocumentSnapshot{Ref: testClient.Doc("prediction_tracker/1/model_performance/" + id)})
+		}
+		return snaps
+	}
+
+	tests := []struct {
+		name string
+		ids  []string
+		want map[string][]string
+	}{
+		// By default, straight-up picks use the most wins, and the others the least mean absolute error.
+		// line and sagarin tie on wins, so the last by document ID is chosen, as Firestore orders ties in a
+		// descending query.
+		{"defaults", []string{"a", "b", "c"}, map[string][]string{
+			"sagarin": {"StraightUp"},
+			"massey":  {"NoisySpread", "Superdog"},
+		}},
+		{"ties by document ID", []string{"b", "c", "a"}, map[string][]string{
+			"line":   {"StraightUp"},
+			"massey": {"NoisySpread", "Superdog"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			models := testModels()
+			markSelected(models, docs(tt.ids...))
+			for _, m := range models {
+				if !reflect.DeepEqual(m.Selected, tt.want[m.System]) {
+					t.Errorf("%s: expected selected for %v, got %v", m.System, tt.want[m.System], m.Selected)
+				}
+			}
+		})
+	}
+
+	// An empty tracker has nothing to select.
+	markSelected(nil, nil)
+}
@@ -0,0 +1,247 @@
+package pickem4me
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+// Log levels, named as Cloud Logging names severities.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+// String returns the Cloud Logging name of the level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarning:
+		return "WARNING"
+	default:
+		return "ERROR"
+	}
+}
+
+// Log formats.
+const (
+	// LogJSON writes one JSON object per entry, as understood by Cloud Logging.
+	LogJSON = "json"
+
+	// LogText writes one line of human-readable text per entry.
+	LogText = "text"
+)
+
+// logField is a key and value attached to log entries.
+type logField struct {
+	key   string
+	value interface{}
+}
+
+// logOutput is where log entries go, shared by every logger derived from the same root.
+type logOutput struct {
+	mu     sync.Mutex
+	w      io.Writer
+	level  Level
+	format string
+}
+
+// Logger writes leveled, structured log entries.
+// Loggers are safe for concurrent use, and derived loggers share their output with their parent.
+type Logger struct {
+	out    *logOutput
+	fields []logField
+
+	// onWarn is called with the message of every warning or error that is written.
+	onWarn func(msg string)
+}
+
+// logger is the root logger. Its format is read from LOG_FORMAT (default "json") and its level from LOG_LEVEL (default "info").
+var logger = &Logger{out: &logOutput{
+	w:      os.Stderr,
+	level:  levelFromEnv(),
+	format: formatFromEnv(),
+}}
+
+func levelFromEnv() Level {
+	level, err := ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		return LevelInfo
+	}
+	return level
+}
+
+func formatFromEnv() string {
+	if strings.ToLower(os.Getenv("LOG_FORMAT")) == LogText {
+		return LogText
+	}
+	return LogJSON
+}
+
+// ParseLevel parses a level name such as "debug" or "warning" (empty means "info").
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarning, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level '%s'", s)
+	}
+}
+
+// ConfigureLogging sets where log entries are written, the least severe level written, and the format ("json" or "text").
+func ConfigureLogging(w io.Writer, level Level, format string) error {
+	switch format {
+	case LogJSON, LogText:
+	default:
+		return fmt.Errorf("unknown log format '%s'", format)
+	}
+	logger.out.mu.Lock()
+	defer logger.out.mu.Unlock()
+	logger.out.w = w
+	logger.out.level = level
+	logger.out.format = format
+	return nil
+}
+
+// Log returns the package logger, which writes where ConfigureLogging says.
+func Log() *Logger {
+	return logger
+}
+
+// With returns a logger that adds a field to every entry.
+func (l *Logger) With(key string, value interface{}) *Logger {
+	fields := make([]logField, len(l.fields), len(l.fields)+1)
+	copy(fields, l.fields)
+	return &Logger{out: l.out, fields: append(fields, logField{key, value}), onWarn: l.onWarn}
+}
+
+// Debugf logs a debugging entry.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.log(LevelDebug, format, args...)
+}
+
+// Infof logs an informational entry.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.log(LevelInfo, format, args...)
+}
+
+// Warnf logs a warning.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.log(LevelWarning, format, args...)
+}
+
+// Errorf logs an error.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(LevelError, format, args...)
+}
+
+func (l *Logger) log(level Level, format string, args ...interface{}) {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	if level < l.out.level {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	t := now().UTC()
+	if level >= LevelWarning && l.onWarn != nil {
+		l.onWarn(msg)
+	}
+
+	if l.out.format == LogText {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %-7s %s", t.Format(time.RFC3339), level, msg)
+		for _, f := range l.fields {
+			fmt.Fprintf(&b, " %s=%v", f.key, f.value)
+		}
+		b.WriteByte('\n')
+		io.WriteString(l.out.w, b.String())
+		return
+	}
+
+	entry := make(map[string]interface{}, len(l.fields)+3)
+	for _, f := range l.fields {
+		entry[f.key] = f.value
+	}
+	entry["severity"] = level.String()
+	entry["message"] = msg
+	entry["time"] = t.Format(time.RFC3339Nano)
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"severity": level.String(), "message": msg})
+	}
+	l.out.w.Write(append(b, '\n'))
+}
+
+// loggerKey is the context key of the logger for a run.
+type loggerKey struct{}
+
+// withLogger returns a context that carries a logger.
+func withLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// logFrom returns the logger carried by a context, or the root logger if there is none.
+func logFrom(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return l
+	}
+	return logger
+}
+
+// traceField is the Cloud Logging field that correlates log entries with a trace.
+const traceField = "logging.googleapis.com/trace"
+
+// traceOf returns the Cloud Logging trace name from an X-Cloud-Trace-Context header value, or "" if there is none.
+func traceOf(header string) string {
+	if header == "" || projectID == "" {
+		return ""
+	}
+	traceID := strings.SplitN(header, "/", 2)[0]
+	if traceID == "" {
+		return ""
+	}
+	return fmt.Sprintf("projects/%s/traces/%s", projectID, traceID)
+}
+
+// runIDKey is the context key of the ID of a run.
+type runIDKey struct{}
+
+// withRun returns a context for one run of the function, with a new run ID, a record of the run, telemetry traced
+// under the run, and a logger that adds the run ID, picker, and slate to every entry and records warnings in the run
+// record.
+func withRun(ctx context.Context, pem PickEmMessage) context.Context {
+	traceID := newEventID()
+	id := traceID[:16]
+	record := newRunRecord(id, pem)
+	l := logFrom(ctx).With("run_id", id).With("picker", pem.Picker).With("slate", pem.Slate)
+	l.onWarn = record.warn
+	ctx = context.WithValue(ctx, runIDKey{}, id)
+	ctx = context.WithValue(ctx, runRecordKey{}, record)
+	ctx = withTelemetry(ctx, traceID)
+	return withLogger(ctx, l)
+}
+
+// runIDFrom returns the ID of the run carried by a context, or "" if there is none.
+func runIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
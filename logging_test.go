@@ -0,0 +1,156 @@
+package pickem4me
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLogger returns a logger that writes to a buffer at the given level and format.
+func testLogger(level Level, format string) (*Logger, *bytes.Buffer) {
+	var b bytes.Buffer
+	return &Logger{out: &logOutput{w: &b, level: level, format: format}}, &b
+}
+
+// logEntries parses the JSON log entries written to a buffer.
+func logEntries(t *testing.T, b *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("expected a JSON entry, got %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Level
+		wantErr bool
+	}{
+		{"", LevelInfo, false},
+		{"debug", LevelDebug, false},
+		{"INFO", LevelInfo, false},
+		{"warn", LevelWarning, false},
+		{"Warning", LevelWarning, false},
+		{"error", LevelError, false},
+		{"loud", LevelInfo, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%q: expected %s (error %t), got %s (%v)", tt.in, tt.want, tt.wantErr, got, err)
+		}
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	setNow(t, time.Date(2021, 10, 2, 12, 0, 0, 0, time.FixedZone("CDT", -5*60*60)))
+	tests := []struct {
+		level Level
+		want  []string
+	}{
+		{LevelDebug, []string{"DEBUG", "INFO", "WARNING", "ERROR"}},
+		{LevelInfo, []string{"INFO", "WARNING", "ERROR"}},
+		{LevelWarning, []string{"WARNING", "ERROR"}},
+		{LevelError, []string{"ERROR"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			l, b := testLogger(tt.level, LogJSON)
+			l.Debugf("debug %d", 1)
+			l.Infof("info %d", 2)
+			l.Warnf("warning %d", 3)
+			l.Errorf("error %d", 4)
+			entries := logEntries(t, b)
+			if len(entries) != len(tt.want) {
+				t.Fatalf("expected %d entries, got %v", len(tt.want), entries)
+			}
+			for i, severity := range tt.want {
+				if entries[i]["severity"] != severity || !strings.HasPrefix(entries[i]["message"].(string), strings.ToLower(severity)) {
+					t.Errorf("expected a %s entry, got %v", severity, entries[i])
+				}
+				if entries[i]["time"] != "2021-10-02T17:00:00Z" {
+					t.Errorf("expected the time in UTC, got %v", entries[i]["time"])
+				}
+			}
+		})
+	}
+}
+
+func TestLoggerWith(t *testing.T) {
+	l, b := testLogger(LevelInfo, LogJSON)
+	var warnings []string
+	l.onWarn = func(msg string) { warnings = append(warnings, msg) }
+
+	row := l.With("row", 3)
+	game := row.With("game", "iowa").With("row", 4) // a repeated key keeps the last value
+	l.Infof("root")
+	row.Infof("row")
+	game.Warnf("game")
+
+	entries := logEntries(t, b)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %v", entries)
+	}
+	if _, ok := entries[0]["row"]; ok {
+		t.Errorf("expected the root logger untagged, got %v", entries[0])
+	}
+	if entries[1]["row"] != 3.0 || entries[1]["game"] != nil {
+		t.Errorf("expected row 3 only, got %v", entries[1])
+	}
+	if entries[2]["row"] != 4.0 || entries[2]["game"] != "iowa" {
+		t.Errorf("expected row 4 and game 'iowa', got %v", entries[2])
+	}
+	if len(warnings) != 1 || warnings[0] != "game" {
+		t.Errorf("expected derived loggers to report warnings, got %v", warnings)
+	}
+}
+
+func TestLoggerText(t *testing.T) {
+	setNow(t, time.Date(2021, 10, 2, 12, 0, 0, 0, time.UTC))
+	l, b := testLogger(LevelInfo, LogText)
+	l.With("row", 3).Warnf("no prediction for %s", "iowa")
+	if want := "2021-10-02T12:00:00Z WARNING no prediction for iowa row=3\n"; b.String() != want {
+		t.Errorf("expected %q, got %q", want, b.String())
+	}
+}
+
+func TestWithRunTagsEntries(t *testing.T) {
+	l, b := testLogger(LevelInfo, LogJSON)
+	ctx := withRun(withLogger(context.Background(), l), PickEmMessage{Picker: "LUKE", Slate: "seasons/2021/weeks/5/slates/1"})
+	logFrom(ctx).With("row", 2).Warnf("model cannot predict game")
+	logFrom(ctx).Infof("picked")
+
+	entries := logEntries(t, b)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+	for _, entry := range entries {
+		if entry["run_id"] != runIDFrom(ctx) || entry["picker"] != "LUKE" || entry["slate"] != "seasons/2021/weeks/5/slates/1" {
+			t.Errorf("expected the run, picker, and slate, got %v", entry)
+		}
+	}
+	if entries[0]["row"] != 2.0 {
+		t.Errorf("expected row 2, got %v", entries[0])
+	}
+	if _, ok := entries[1]["row"]; ok {
+		t.Errorf("expected no row, got %v", entries[1])
+	}
+	if w := runFrom(ctx).Warnings; len(w) != 1 || w[0] != "model cannot predict game" {
+		t.Errorf("expected the warning recorded in the run, got %v", w)
+	}
+	if logFrom(context.Background()) != Log() {
+		t.Errorf("expected the package logger without a run")
+	}
+}
@@ -0,0 +1,173 @@
+package pickem4me
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// outputFormat describes how to write a pick set in a given format.
+type outputFormat struct {
+	// ext is the file extension (without the dot).
+	ext string
+
+	// contentType is the MIME type of the output.
+	contentType string
+
+	// write writes the pick set to w.
+	write func(ctx context.Context, w io.Writer, ps *PickSet) error
+}
+
+// outputFormats are the formats understood by PickEmMessage.Formats, keyed by name.
+var outputFormats = map[string]outputFormat{
+	"xlsx": {
+		ext:         "xlsx",
+		contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		write: func(ctx context.Context, w io.Writer, ps *PickSet) error {
+			outExcel, err := newExcelFile(ctx, ps)
+			if err != nil {
+				return err
+			}
+			return outExcel.Write(w)
+		},
+	},
+	"json": {
+		ext:         "json",
+		contentType: "application/json",
+		write: func(ctx context.Context, w io.Writer, ps *PickSet) error {
+			return writeJSON(w, ps)
+		},
+	},
+	"csv": {
+		ext:         "csv",
+		contentType: "text/csv",
+		write: func(ctx context.Context, w io.Writer, ps *PickSet) error {
+			return writeCSV(w, ps)
+		},
+	},
+	"md": {
+		ext:         "md",
+		contentType: "text/markdown; charset=utf-8",
+		write:       writeMarkdown,
+	},
+	"html": {
+		ext:         "html",
+		contentType: "text/html; charset=utf-8",
+		write:       writeHTML,
+	},
+}
+
+// defaultFormats are the formats written when none are requested: the Excel output with its summaries next to it.
+var defaultFormats = []string{"xlsx", "md", "html"}
+
+// ParseFormats splits a comma-separated list of output format names and checks that each is known.
+func ParseFormats(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var formats []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if _, ok := outputFormats[f]; !ok {
+			return nil, fmt.Errorf("unknown output format '%s'", f)
+		}
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+// output is the destination of an output.
+// Close publishes what was written and Abort discards it, so that a partial output is never published.
+type output interface {
+	io.WriteCloser
+	Abort()
+}
+
+// fileOutput is an output to a local file. Aborting removes the file.
+type fileOutput struct {
+	*os.File
+}
+
+// createFile creates a local file for an output.
+func createFile(name string) (output, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return fileOutput{f}, nil
+}
+
+// Abort closes and removes the file.
+func (f fileOutput) Abort() {
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+// objectOutput is an output to a Cloud Storage object, which is created only when the output is closed.
+type objectOutput struct {
+	*storage.Writer
+	cancel context.CancelFunc
+}
+
+// newObjectOutput starts writing a Cloud Storage object with the given content type.
+func newObjectOutput(ctx context.Context, obj *storage.ObjectHandle, contentType string) *objectOutput {
+	ctx, cancel := context.WithCancel(ctx)
+	w := obj.NewWriter(ctx)
+	w.ObjectAttrs.ContentType = contentType
+	return &objectOutput{Writer: w, cancel: cancel}
+}
+
+// Close creates the object.
+func (o *objectOutput) Close() error {
+	defer o.cancel()
+	return o.Writer.Close()
+}
+
+// Abort cancels the upload, so that the object is not created.
+func (o *objectOutput) Abort() {
+	o.cancel()
+	o.Writer.Close()
+}
+
+// writeOutputs writes the pick set in each of the given formats.
+// The create function is called once per format to open the destination for the output, and an output that cannot
+// be written completely is aborted rather than closed.
+func writeOutputs(ctx context.Context, ps *PickSet, formats []string, create func(ext, contentType string) (output, error)) error {
+	if len(formats) == 0 {
+		formats = defaultFormats
+	}
+	for _, name := range formats {
+		f, ok := outputFormats[name]
+		if !ok {
+			return newError(KindInvalidInput, "unknown output format '%s'", name)
+		}
+		w, err := create(f.ext, f.contentType)
+		if err != nil {
+			return backendError(err, "failed creating %s output", name)
+		}
+		if err := f.write(ctx, w, ps); err != nil {
+			w.Abort()
+			return backendError(err, "failed writing %s output", name)
+		}
+		if err := w.Close(); err != nil {
+			return backendError(err, "failed closing %s output", name)
+		}
+	}
+	return nil
+}
+
+// WriteFiles writes the pick set in each of the given formats (xlsx, md, and html if none are given) to local files named
+// stem.ext, returning the names of the files that were written.
+func WriteFiles(ctx context.Context, ps *PickSet, formats []string, stem string) ([]string, error) {
+	var names []string
+	err := writeOutputs(ctx, ps, formats, func(ext, _ string) (output, error) {
+		name := stem + "." + ext
+		names = append(names, name)
+		return createFile(name)
+	})
+	return names, err
+}
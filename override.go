@@ -0,0 +1,694 @@
+package pickem4me
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of override.
+const (
+	// OverridePick is a straight-up or noisy spread game picked for a different team than the models picked.
+	OverridePick = "pick"
+
+	// OverrideSuperdog is a different superdog picked than the models picked, or none at all.
+	OverrideSuperdog = "superdog"
+
+	// OverrideStreak is a different streak pick than the models picked, or none at all.
+	OverrideStreak = "streak"
+)
+
+// Sources of overrides.
+const (
+	// OverrideInteractive is an override made by hand in the interactive mode of the command line.
+	OverrideInteractive = "interactive"
+
+	// OverrideDeclared is an override declared in an overrides file or in the message that requested the picks.
+	OverrideDeclared = "declared"
+)
+
+// overrideNone is the team name that means nothing is picked, for superdog and streak overrides.
+const overrideNone = "none"
+
+// overrideNote starts every note about an override.
+const overrideNote = "OVERRIDE:  "
+
+// Override is a pick changed by hand from what the models picked.
+type Override struct {
+	// Kind is the kind of override: "pick", "superdog", or "streak".
+	Kind string `firestore:"kind" json:"kind"`
+
+	// Row is the slate row of the game picked by hand. It is zero for streak overrides and for superdog overrides
+	// that pick no superdog.
+	Row int `firestore:"row" json:"row"`
+
+	// Model are the paths to the teams the models picked (empty if they picked nothing).
+	Model []string `firestore:"model" json:"model"`
+
+	// Pick are the paths to the teams picked by hand (empty if nothing is picked).
+	Pick []string `firestore:"pick" json:"pick"`
+
+	// Source is how the override was made, such as "interactive".
+	Source string `firestore:"source" json:"source"`
+}
+
+// Draft is a pick set that has been made but not yet stored, written, or delivered, so that picks can be
+// overridden by hand before they are committed.
+type Draft struct {
+	// ctx is the context of the run that made the picks, which is ended when the draft is committed.
+	ctx  context.Context
+	root *span
+	plan *pickPlan
+}
+
+// NewDraft makes the picks requested by a message without storing, writing, or delivering them.
+// The run that makes the picks ends when the draft is committed.
+func NewDraft(ctx context.Context, pem PickEmMessage) (*Draft, error) {
+	ctx, root := startRun(ctx, pem)
+	plan, err := makePicks(ctx, pem)
+	if err != nil {
+		endRun(ctx, root, pem, nil, err)
+		return nil, err
+	}
+	return &Draft{ctx: ctx, root: root, plan: plan}, nil
+}
+
+// Picks returns the picks of the draft, including any overrides.
+func (d *Draft) Picks() *PickSet {
+	return d.plan.picks
+}
+
+// Teams returns the team resolver used to make the picks.
+func (d *Draft) Teams() *TeamResolver {
+	return d.plan.teams
+}
+
+// FlipPick picks the other team in a straight-up or noisy spread game.
+func (d *Draft) FlipPick(row int) error {
+	for _, g := range d.plan.picks.Export().Games {
+		if g.Row != row {
+			continue
+		}
+		if g.Type == ExportSuperdog {
+			return newError(KindInvalidInput, "row %d is a superdog game: choose the superdog instead", row)
+		}
+		other := g.Home
+		if g.Pick == g.Home {
+			other = g.Road
+		}
+		return d.plan.overridePick(row, other, OverrideInteractive)
+	}
+	return newError(KindInvalidInput, "no game in row %d", row)
+}
+
+// ChooseSuperdog picks the underdog of the superdog game in a slate row, or no superdog if the row is zero.
+func (d *Draft) ChooseSuperdog(row int) error {
+	return d.plan.overrideSuperdog(row, OverrideInteractive)
+}
+
+// SetStreak replaces the streak pick with the named teams, or removes it if no teams are named.
+func (d *Draft) SetStreak(names []string) error {
+	teams := make([]*firestore.DocumentRef, len(names))
+	for i, name := range names {
+		ref, ok := d.plan.teams.ResolveName(name)
+		if !ok {
+			return newError(KindInvalidInput, "no team named '%s'", name)
+		}
+		teams[i] = ref
+	}
+	return d.plan.overrideStreak(teams, OverrideInteractive)
+}
+
+// Commit stores, writes, and delivers the picks of the draft, including any overrides, and publishes the result.
+// The late policy is applied again first, so that nothing is committed for games that started while the picks
+// were drafted. A draft can be committed only once.
+func (d *Draft) Commit() (*PickSet, error) {
+	if d.plan == nil {
+		return nil, newError(KindInvalidInput, "draft already committed or discarded")
+	}
+	var ps *PickSet
+	err := d.plan.checkDeadline(now())
+	if err != nil {
+		logFrom(d.ctx).Errorf("Refusing to commit picks of slate '%s': %v", d.plan.pem.Slate, err)
+	} else {
+		ps, err = d.plan.commit(d.ctx)
+	}
+	endRun(d.ctx, d.root, d.plan.pem, ps, err)
+	d.plan = nil
+	return ps, err
+}
+
+// Discard ends the run of a draft without storing, writing, or delivering anything.
+// It does nothing if the draft has already been committed or discarded.
+func (d *Draft) Discard() {
+	if d.plan == nil {
+		return
+	}
+	endRun(d.ctx, d.root, d.plan.pem, nil, fmt.Errorf("draft discarded: %w", context.Canceled))
+	d.plan = nil
+}
+
+// checkDeadline applies the late policy of the plan at time t. It returns an error if the picks should no longer
+// be made, or if games that were not locked when the picks were made have started since.
+func (p *pickPlan) checkDeadline(t time.Time) error {
+	if p.schedule == nil {
+		return nil
+	}
+	locked, err := enforceDeadline(p.schedule, p.latePolicy, t)
+	if err != nil {
+		return err
+	}
+	var started []int
+	for row := range locked {
+		if !p.picks.Locked[row] {
+			started = append(started, row)
+		}
+	}
+	if len(started) == 0 {
+		return nil
+	}
+	sort.Ints(started)
+	rows := make([]string, len(started))
+	for i, row := range started {
+		rows[i] = strconv.Itoa(row)
+	}
+	return newError(KindDeadlinePassed, "the games in rows %s started after the picks were made", strings.Join(rows, ", "))
+}
+
+// overridePick picks a team (by path) in a straight-up or noisy spread game.
+func (p *pickPlan) overridePick(row int, team string, source string) error {
+	ps := p.picks
+	if ps.Locked[row] {
+		return newError(KindInvalidInput, "the game in row %d has already started", row)
+	}
+	for _, g := range ps.StraightUp {
+		if g.Row == row {
+			return p.setPick(row, &g.Pick, g.HomeTeam, g.AwayTeam, team, source)
+		}
+	}
+	for _, g := range ps.NoisySpread {
+		if g.Row == row {
+			return p.setPick(row, &g.Pick, g.HomeTeam, g.AwayTeam, team, source)
+		}
+	}
+	return newError(KindInvalidInput, "no straight-up or noisy spread game in row %d", row)
+}
+
+// setPick sets a pick to whichever of the home and road teams has the given path.
+func (p *pickPlan) setPick(row int, pick **firestore.DocumentRef, home, road *firestore.DocumentRef, team string, source string) error {
+	var picked *firestore.DocumentRef
+	switch team {
+	case refPath(home):
+		picked = home
+	case refPath(road):
+		picked = road
+	default:
+		return newError(KindInvalidInput, "%s does not play in row %d", p.teamName(team), row)
+	}
+	model := refPath(*pick)
+	*pick = picked
+	p.recordOverride(Override{Kind: OverridePick, Row: row, Model: []string{model}, Pick: []string{team}, Source: source})
+	return nil
+}
+
+// overrideSuperdog picks the underdog in a slate row as the superdog, or no superdog if the row is zero.
+func (p *pickPlan) overrideSuperdog(row int, source string) error {
+	ps := p.picks
+	o := Override{Kind: OverrideSuperdog, Row: row, Source: source}
+	found := row == 0
+	for _, sd := range ps.Superdog {
+		if sd.Pick != nil && ps.Locked[sd.Row] {
+			return newError(KindInvalidInput, "the superdog game in row %d has already started", sd.Row)
+		}
+		if sd.Row == row {
+			if ps.Locked[row] {
+				return newError(KindInvalidInput, "the superdog game in row %d has already started", row)
+			}
+			found = true
+			o.Pick = []string{refPath(sd.Underdog)}
+		}
+	}
+	if !found {
+		return newError(KindInvalidInput, "no superdog game in row %d", row)
+	}
+	for _, sd := range ps.Superdog {
+		if sd.Pick != nil {
+			o.Model = []string{refPath(sd.Pick)}
+		}
+		sd.Pick = nil
+		if sd.Row == row {
+			sd.Pick = sd.Underdog
+		}
+	}
+	p.recordOverride(o)
+	return nil
+}
+
+// overrideStreak replaces the streak pick with the given teams, or removes it if there are none.
+// The predicted spread and probability of a streak picked by hand are unknown, so they are zero.
+func (p *pickPlan) overrideStreak(teams []*firestore.DocumentRef, source string) error {
+	if problems := p.streakProblems(teams); len(problems) > 0 {
+		return newError(KindInvalidInput, "%s", strings.Join(problems, "; "))
+	}
+	ps := p.picks
+	o := Override{Kind: OverrideStreak, Pick: refPaths(teams), Source: source}
+	if ps.Streak != nil {
+		o.Model = refPaths(ps.Streak.Picks)
+	}
+	switch {
+	case len(teams) == 0:
+		ps.Streak = nil
+	case p.modelStreak != nil && strings.Join(o.Pick, ",") == strings.Join(refPaths(p.modelStreak.Picks), ","):
+		ps.Streak = p.modelStreak
+	default:
+		ps.Streak = &bpefs.StreakPick{Picks: teams}
+	}
+	p.recordOverride(o)
+	return nil
+}
+
+// streakProblems returns what is wrong with replacing the streak pick with the given teams: the streak pick cannot be
+// changed once a game of one of its teams has started, and every team must play in a game of the slate that has not.
+func (p *pickPlan) streakProblems(teams []*firestore.DocumentRef) []string {
+	ps := p.picks
+	rows := p.teamRows()
+	var problems []string
+	if ps.Streak != nil {
+		for _, team := range ps.Streak.Picks {
+			if row, ok := rows[p.teams.ID(team)]; ok && ps.Locked[row] {
+				problems = append(problems, fmt.Sprintf("the streak pick includes %s, whose game in row %d has already started", p.teamName(refPath(team)), row))
+			}
+		}
+	}
+	for _, team := range teams {
+		row, ok := rows[p.teams.ID(team)]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s does not play in the slate", p.teamName(refPath(team))))
+		case ps.Locked[row]:
+			problems = append(problems, fmt.Sprintf("the game of %s in row %d has already started", p.teamName(refPath(team)), row))
+		}
+	}
+	return problems
+}
+
+// teamRows maps the ID of every team playing in the slate to the row of its game.
+func (p *pickPlan) teamRows() map[string]int {
+	ps := p.picks
+	rows := make(map[string]int)
+	add := func(row int, teams ...*firestore.DocumentRef) {
+		for _, team := range teams {
+			if team != nil {
+				rows[p.teams.ID(team)] = row
+			}
+		}
+	}
+	for _, g := range ps.StraightUp {
+		add(g.Row, g.HomeTeam, g.AwayTeam)
+	}
+	for _, g := range ps.NoisySpread {
+		add(g.Row, g.HomeTeam, g.AwayTeam)
+	}
+	for _, g := range ps.Superdog {
+		add(g.Row, g.Underdog, g.Overdog)
+	}
+	return rows
+}
+
+// recordOverride records an override in the pick set and annotates the picks with every override.
+// Overriding the same pick again keeps what the models originally picked, and an override back to what
+// the models picked is forgotten.
+func (p *pickPlan) recordOverride(o Override) {
+	ps := p.picks
+	for i, prev := range ps.Overrides {
+		if prev.Kind == o.Kind && (o.Kind != OverridePick || prev.Row == o.Row) {
+			o.Model = prev.Model
+			ps.Overrides = append(ps.Overrides[:i], ps.Overrides[i+1:]...)
+			break
+		}
+	}
+	if strings.Join(o.Model, ",") != strings.Join(o.Pick, ",") {
+		ps.Overrides = append(ps.Overrides, o)
+	}
+	p.annotateOverrides()
+}
+
+// annotateOverrides replaces the notes about overrides with notes about the current overrides.
+func (p *pickPlan) annotateOverrides() {
+	ps := p.picks
+	for row, notes := range ps.Notes {
+		if ps.Notes[row] = removeOverrideNotes(notes); len(ps.Notes[row]) == 0 {
+			delete(ps.Notes, row)
+		}
+	}
+	ps.StreakNotes = removeOverrideNotes(ps.StreakNotes)
+
+	for _, o := range ps.Overrides {
+		model := p.teamNames(o.Model)
+		if model == "" {
+			model = "nothing"
+		}
+		switch o.Kind {
+		case OverridePick:
+			ps.annotate(o.Row, fmt.Sprintf("%sPicked %s (%s override); the model picked %s.", overrideNote, p.teamNames(o.Pick), o.Source, model))
+		case OverrideSuperdog:
+			note := fmt.Sprintf("%sPicked %s as the superdog (%s override); the model picked %s.", overrideNote, p.teamNames(o.Pick), o.Source, model)
+			if o.Row == 0 {
+				note = fmt.Sprintf("%sPicked no superdog (%s override); the model picked %s.", overrideNote, o.Source, model)
+			}
+			for _, sd := range ps.Superdog {
+				if sd.Row == o.Row || (o.Row == 0 && len(o.Model) > 0 && refPath(sd.Underdog) == o.Model[0]) {
+					ps.annotate(sd.Row, note)
+				}
+			}
+		case OverrideStreak:
+			pick := p.teamNames(o.Pick)
+			if pick == "" {
+				pick = "no streak"
+			}
+			ps.StreakNotes = append(ps.StreakNotes, fmt.Sprintf("%sPicked %s (%s override); the model picked %s.", overrideNote, pick, o.Source, model))
+		}
+	}
+}
+
+// removeOverrideNotes returns the notes that are not about overrides.
+func removeOverrideNotes(notes []string) []string {
+	var kept []string
+	for _, note := range notes {
+		if !strings.HasPrefix(note, overrideNote) {
+			kept = append(kept, note)
+		}
+	}
+	return kept
+}
+
+// teamName returns a human-readable name for the team at a path.
+func (p *pickPlan) teamName(t string) string {
+	if ref, ok := p.teams.ResolveName(path.Base(t)); ok {
+		return p.teams.Name(ref)
+	}
+	return path.Base(t)
+}
+
+// teamNames returns human-readable names for the teams at the given paths, joined with commas.
+func (p *pickPlan) teamNames(teams []string) string {
+	names := make([]string, len(teams))
+	for i, t := range teams {
+		names[i] = p.teamName(t)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Overrides are changes to force on the picks after the models make them, declared in a file or in a message.
+// Teams are named by anything the team resolver knows: school names, abbreviations, aliases, or document IDs.
+//
+// In YAML, for example:
+//
+//	picks:
+//	  - team: Purdue
+//	  - row: 7
+//	    team: Iowa
+//	excludeSuperdogs: [Northwestern]
+//	superdog: Illinois
+//	streak: [Ohio State]
+type Overrides struct {
+	// Picks force teams to be picked in straight-up or noisy spread games.
+	Picks []ForcedPick `json:"picks,omitempty" yaml:"picks,omitempty"`
+
+	// ExcludeSuperdogs are underdogs never to pick as the superdog.
+	ExcludeSuperdogs []string `json:"excludeSuperdogs,omitempty" yaml:"excludeSuperdogs,omitempty"`
+
+	// Superdog is the underdog to pick as the superdog, or "none" to pick no superdog (empty lets the models pick).
+	Superdog string `json:"superdog,omitempty" yaml:"superdog,omitempty"`
+
+	// Streak pins the streak pick to these teams, or to no streak pick if it is ["none"] (empty lets the models pick).
+	Streak []string `json:"streak,omitempty" yaml:"streak,omitempty"`
+}
+
+// ForcedPick forces a team to be picked in a game.
+type ForcedPick struct {
+	// Row is the slate row of the game (zero means the game in which the team plays).
+	Row int `json:"row,omitempty" yaml:"row,omitempty"`
+
+	// Team is the team to pick.
+	Team string `json:"team" yaml:"team"`
+}
+
+// ReadOverrides reads overrides in YAML or JSON.
+func ReadOverrides(r io.Reader) (*Overrides, error) {
+	var o Overrides
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&o); err != nil && err != io.EOF {
+		return nil, newError(KindInvalidInput, "failed parsing overrides: %v", err)
+	}
+	if problems := o.problems(); len(problems) > 0 {
+		return nil, newError(KindInvalidInput, "invalid overrides: %s", strings.Join(problems, "; "))
+	}
+	return &o, nil
+}
+
+// LoadOverrides reads overrides in YAML or JSON from a file.
+func LoadOverrides(file string) (*Overrides, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, newError(KindInvalidInput, "failed opening overrides: %v", err)
+	}
+	defer f.Close()
+	return ReadOverrides(f)
+}
+
+// problems returns what is wrong with the overrides without looking at the slate.
+func (o Overrides) problems() []string {
+	var problems []string
+	rows := make(map[int]bool)
+	for _, p := range o.Picks {
+		switch {
+		case strings.TrimSpace(p.Team) == "":
+			problems = append(problems, "forced pick with no team")
+		case p.Row < 0:
+			problems = append(problems, fmt.Sprintf("forced pick of '%s' in negative row %d", p.Team, p.Row))
+		case p.Row > 0 && rows[p.Row]:
+			problems = append(problems, fmt.Sprintf("more than one forced pick in row %d", p.Row))
+		}
+		rows[p.Row] = true
+	}
+	for _, team := range o.ExcludeSuperdogs {
+		if strings.EqualFold(team, o.Superdog) {
+			problems = append(problems, fmt.Sprintf("superdog '%s' is also excluded", team))
+		}
+	}
+	if len(o.Streak) > 1 {
+		for _, team := range o.Streak {
+			if team == overrideNone {
+				problems = append(problems, "streak of 'none' and other teams")
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// applyOverrides validates overrides against the slate and forces them on the picks.
+// Nothing is changed unless every override is valid. A forced pick or streak in a game that has started is valid
+// only if it is already picked, as when repicking with the overrides that made the previous picks.
+func (p *pickPlan) applyOverrides(ctx context.Context, o Overrides) error {
+	ps := p.picks
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	resolve := func(name string) (string, bool) {
+		ref, ok := p.teams.ResolveName(name)
+		if !ok {
+			add("no team named '%s'", name)
+			return "", false
+		}
+		return p.teams.ID(ref), true
+	}
+
+	// Forced picks
+	type forced struct {
+		row  int
+		team string
+	}
+	var picks []forced
+	for _, fp := range o.Picks {
+		id, ok := resolve(fp.Team)
+		if !ok {
+			continue
+		}
+		var matches []forced
+		sides := func(row int, home, road *firestore.DocumentRef) {
+			if fp.Row != 0 && row != fp.Row {
+				return
+			}
+			for _, ref := range []*firestore.DocumentRef{home, road} {
+				if p.teams.ID(ref) == id {
+					matches = append(matches, forced{row, refPath(ref)})
+				}
+			}
+		}
+		for _, g := range ps.StraightUp {
+			sides(g.Row, g.HomeTeam, g.AwayTeam)
+		}
+		for _, g := range ps.NoisySpread {
+			sides(g.Row, g.HomeTeam, g.AwayTeam)
+		}
+		switch {
+		case len(matches) == 0 && fp.Row != 0:
+			add("'%s' does not play in a straight-up or noisy spread game in row %d", fp.Team, fp.Row)
+		case len(matches) == 0:
+			add("'%s' does not play in a straight-up or noisy spread game", fp.Team)
+		case len(matches) > 1:
+			add("'%s' plays in more than one game: give the row", fp.Team)
+		case ps.Locked[matches[0].row] && p.pickPath(matches[0].row) == matches[0].team:
+			logFrom(ctx).With("row", matches[0].row).Infof("Forced pick of '%s' is already the pick of a game that has started", fp.Team)
+		case ps.Locked[matches[0].row]:
+			add("the game of '%s' in row %d has already started", fp.Team, matches[0].row)
+		default:
+			picks = append(picks, matches[0])
+		}
+	}
+
+	// The superdog, and superdogs to exclude
+	excluded := make(map[string]bool)
+	for _, name := range o.ExcludeSuperdogs {
+		id, ok := resolve(name)
+		if !ok {
+			continue
+		}
+		excluded[id] = true
+		underdog := false
+		for _, sd := range ps.Superdog {
+			underdog = underdog || p.teams.ID(sd.Underdog) == id
+		}
+		if !underdog {
+			logFrom(ctx).Warnf("Excluded superdog '%s' is not an underdog in the slate", name)
+		}
+	}
+	superdogRow := -1
+	switch o.Superdog {
+	case "":
+	case overrideNone:
+		superdogRow = 0
+	default:
+		if id, ok := resolve(o.Superdog); ok {
+			for _, sd := range ps.Superdog {
+				if p.teams.ID(sd.Underdog) == id {
+					superdogRow = sd.Row
+				}
+			}
+			if superdogRow < 0 {
+				add("'%s' is not an underdog in the slate", o.Superdog)
+			}
+		}
+	}
+	if superdogRow < 0 && len(excluded) > 0 {
+		superdogRow = p.bestSuperdog(excluded)
+	}
+
+	// The streak
+	var streak []*firestore.DocumentRef
+	pinStreak := len(o.Streak) > 0
+	resolved := true
+	if pinStreak && o.Streak[0] != overrideNone {
+		for _, name := range o.Streak {
+			if ref, ok := p.teams.ResolveName(name); ok {
+				streak = append(streak, ref)
+			} else {
+				add("no team named '%s'", name)
+				resolved = false
+			}
+		}
+	}
+	if pinStreak && resolved && p.streakPicked(streak) {
+		logFrom(ctx).Infof("Forced streak [%s] is already the streak pick", p.teamNames(refPaths(streak)))
+		pinStreak = false
+	}
+	if pinStreak {
+		problems = append(problems, p.streakProblems(streak)...)
+	}
+
+	if len(problems) > 0 {
+		return newError(KindInvalidInput, "invalid overrides for slate '%s': %s", p.pem.Slate, strings.Join(problems, "; "))
+	}
+	for _, f := range picks {
+		if err := p.overridePick(f.row, f.team, OverrideDeclared); err != nil {
+			return err
+		}
+	}
+	if superdogRow >= 0 {
+		if err := p.overrideSuperdog(superdogRow, OverrideDeclared); err != nil {
+			return err
+		}
+	}
+	if pinStreak {
+		if err := p.overrideStreak(streak, OverrideDeclared); err != nil {
+			return err
+		}
+	}
+	for _, o := range ps.Overrides {
+		logFrom(ctx).With("row", o.Row).Infof("Forced %s override: picked [%s] instead of [%s]", o.Kind, p.teamNames(o.Pick), p.teamNames(o.Model))
+	}
+	return nil
+}
+
+// pickPath returns the path of the team picked in the straight-up or noisy spread game in a slate row, or an empty
+// string if there is no such game.
+func (p *pickPlan) pickPath(row int) string {
+	for _, g := range p.picks.StraightUp {
+		if g.Row == row {
+			return refPath(g.Pick)
+		}
+	}
+	for _, g := range p.picks.NoisySpread {
+		if g.Row == row {
+			return refPath(g.Pick)
+		}
+	}
+	return ""
+}
+
+// streakPicked reports whether the streak pick is already the given teams, or no streak if there are none.
+func (p *pickPlan) streakPicked(teams []*firestore.DocumentRef) bool {
+	var picked []*firestore.DocumentRef
+	if p.picks.Streak != nil {
+		picked = p.picks.Streak.Picks
+	}
+	return strings.Join(refPaths(picked), ",") == strings.Join(refPaths(teams), ",")
+}
+
+// bestSuperdog returns the row of the superdog that would be picked if the underdogs with the given team IDs were
+// not considered, or -1 if the superdog that is picked stands (because it is not excluded, or because it is locked).
+func (p *pickPlan) bestSuperdog(excluded map[string]bool) int {
+	ps := p.picks
+	for _, sd := range ps.Superdog {
+		if sd.Pick != nil && (ps.Locked[sd.Row] || !excluded[p.teams.ID(sd.Underdog)]) {
+			return -1
+		}
+	}
+	best := 0
+	var bestValue float64
+	for _, sd := range ps.Superdog {
+		if ps.Locked[sd.Row] || excluded[p.teams.ID(sd.Underdog)] {
+			continue
+		}
+		if ev := sd.PredictedProbability * float64(sd.Value); ev > bestValue {
+			best = sd.Row
+			bestValue = ev
+		}
+	}
+	return best
+}
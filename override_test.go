@@ -0,0 +1,442 @@
+package pickem4me
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// testPlan makes a plan for a slate with straight-up games in rows 1 and 2, a noisy spread game in row 3, and
+// superdog games in rows 6 and 7, with the given rows locked. The models pick Iowa, Ohio State, Minnesota, the
+// Purdue superdog, and a Wisconsin streak.
+func testPlan(locked ...int) *pickPlan {
+	teams := NewTeamResolver()
+	for _, t := range []struct{ id, school string }{
+		{"iowa", "Iowa"}, {"michigan", "Michigan"}, {"ohio-state", "Ohio State"}, {"penn-state", "Penn State"},
+		{"wisconsin", "Wisconsin"}, {"minnesota", "Minnesota"}, {"purdue", "Purdue"}, {"indiana", "Indiana"},
+		{"illinois", "Illinois"}, {"maryland", "Maryland"}, {"rutgers", "Rutgers"},
+	} {
+		teams.AddTeam(teamRef(t.id), bpefs.Team{School: t.school})
+	}
+	streak := &bpefs.StreakPick{Picks: []*firestore.DocumentRef{teamRef("wisconsin")}}
+	ps := &PickSet{
+		StraightUp: []*bpefs.StraightUpPick{
+			{Row: 1, HomeTeam: teamRef("iowa"), AwayTeam: teamRef("michigan"), Pick: teamRef("iowa")},
+			{Row: 2, HomeTeam: teamRef("ohio-state"), AwayTeam: teamRef("penn-state"), Pick: teamRef("ohio-state")},
+		},
+		NoisySpread: []*bpefs.NoisySpreadPick{
+			{Row: 3, HomeTeam: teamRef("wisconsin"), AwayTeam: teamRef("minnesota"), Pick: teamRef("minnesota")},
+		},
+		Superdog: []*bpefs.SuperDogPick{
+			{Row: 6, Underdog: teamRef("purdue"), Overdog: teamRef("indiana"), Value: 10, PredictedProbability: 0.3, Pick: teamRef("purdue")},
+			{Row: 7, Underdog: teamRef("illinois"), Overdog: teamRef("maryland"), Value: 12, PredictedProbability: 0.2},
+		},
+		Streak: streak,
+		Locked: make(map[int]bool),
+	}
+	for _, row := range locked {
+		ps.Locked[row] = true
+	}
+	return &pickPlan{pem: PickEmMessage{Slate: "seasons/2021/weeks/5/slates/1"}, picks: ps, teams: teams, modelStreak: streak}
+}
+
+// testPicks summarizes the picks of a plan by row, with the streak in row 0 and the superdog in row -1.
+func testPicks(p *pickPlan) map[int]string {
+	picks := make(map[int]string)
+	for _, g := range p.picks.StraightUp {
+		picks[g.Row] = g.Pick.ID
+	}
+	for _, g := range p.picks.NoisySpread {
+		picks[g.Row] = g.Pick.ID
+	}
+	for _, sd := range p.picks.Superdog {
+		if sd.Pick != nil {
+			picks[-1] = sd.Pick.ID
+		}
+	}
+	if p.picks.Streak != nil {
+		var ids []string
+		for _, t := range p.picks.Streak.Picks {
+			ids = append(ids, t.ID)
+		}
+		picks[0] = strings.Join(ids, ",")
+	}
+	return picks
+}
+
+func TestApplyOverrides(t *testing.T) {
+	unchanged := map[int]string{1: "iowa", 2: "ohio-state", 3: "minnesota", -1: "purdue", 0: "wisconsin"}
+	with := func(changes map[int]string) map[int]string {
+		picks := make(map[int]string)
+		for row, team := range unchanged {
+			picks[row] = team
+		}
+		for row, team := range changes {
+			if team == "" {
+				delete(picks, row)
+			} else {
+				picks[row] = team
+			}
+		}
+		return picks
+	}
+
+	tests := []struct {
+		name      string
+		o         Overrides
+		locked    []int
+		want      map[int]string
+		overrides int
+		wantErr   string
+	}{
+		{"nothing", Overrides{}, nil, unchanged, 0, ""},
+		{"forced pick", Overrides{Picks: []ForcedPick{{Team: "Michigan"}}}, nil, with(map[int]string{1: "michigan"}), 1, ""},
+		{"forced pick by row", Overrides{Picks: []ForcedPick{{Row: 3, Team: "wisconsin"}}}, nil, with(map[int]string{3: "wisconsin"}), 1, ""},
+		{"forced pick of the model pick", Overrides{Picks: []ForcedPick{{Team: "Iowa"}}}, nil, unchanged, 0, ""},
+		{"forced pick in the wrong row", Overrides{Picks: []ForcedPick{{Row: 2, Team: "Michigan"}}}, nil, unchanged, 0, "does not play in a straight-up or noisy spread game in row 2"},
+		{"forced pick of a superdog", Overrides{Picks: []ForcedPick{{Team: "Purdue"}}}, nil, unchanged, 0, "does not play in a straight-up or noisy spread game"},
+		{"forced pick in a locked game", Overrides{Picks: []ForcedPick{{Team: "Michigan"}}}, []int{1}, unchanged, 0, "has already started"},
+		{"forced pick already kept in a locked game", Overrides{Picks: []ForcedPick{{Team: "Iowa"}}}, []int{1}, unchanged, 0, ""},
+		{"forced pick already kept in a locked game by row", Overrides{Picks: []ForcedPick{{Row: 3, Team: "Minnesota"}}}, []int{3}, unchanged, 0, ""},
+		{"unknown team", Overrides{Picks: []ForcedPick{{Team: "Michigan"}, {Team: "Nebraska"}}}, nil, unchanged, 0, "no team named 'Nebraska'"},
+		{"superdog", Overrides{Superdog: "Illinois"}, nil, with(map[int]string{-1: "illinois"}), 1, ""},
+		{"no superdog", Overrides{Superdog: "none"}, nil, with(map[int]string{-1: ""}), 1, ""},
+		{"superdog not an underdog", Overrides{Superdog: "Maryland"}, nil, unchanged, 0, "'Maryland' is not an underdog"},
+		{"excluded superdog", Overrides{ExcludeSuperdogs: []string{"Purdue"}}, nil, with(map[int]string{-1: "illinois"}), 1, ""},
+		{"excluded locked superdog", Overrides{ExcludeSuperdogs: []string{"Purdue"}}, []int{6}, unchanged, 0, ""},
+		{"streak", Overrides{Streak: []string{"Ohio State", "Michigan"}}, nil, with(map[int]string{0: "ohio-state,michigan"}), 1, ""},
+		{"no streak", Overrides{Streak: []string{"none"}}, nil, with(map[int]string{0: ""}), 1, ""},
+		{"streak not in the slate", Overrides{Picks: []ForcedPick{{Team: "Michigan"}}, Streak: []string{"Rutgers"}}, nil, unchanged, 0, "Rutgers does not play in the slate"},
+		{"streak in a locked game", Overrides{Streak: []string{"Michigan"}}, []int{1}, unchanged, 0, "the game of Michigan in row 1 has already started"},
+		{"locked streak", Overrides{Streak: []string{"Ohio State"}}, []int{3}, unchanged, 0, "the streak pick includes Wisconsin, whose game in row 3 has already started"},
+		{"locked streak kept", Overrides{Streak: []string{"Wisconsin"}}, []int{3}, unchanged, 0, ""},
+		{"locked streak kept with a forced pick", Overrides{Picks: []ForcedPick{{Team: "Michigan"}}, Streak: []string{"Wisconsin"}}, []int{3}, with(map[int]string{1: "michigan"}), 1, ""},
+		{"locked streak removed", Overrides{Streak: []string{"none"}}, []int{3}, unchanged, 0, "has already started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPlan(tt.locked...)
+			err := p.applyOverrides(context.Background(), tt.o)
+			if tt.wantErr != "" {
+				if KindOf(err) != KindInvalidInput || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected invalid input error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("applyOverrides: %v", err)
+			}
+			if got := testPicks(p); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected picks %v, got %v", tt.want, got)
+			}
+			if len(p.picks.Overrides) != tt.overrides {
+				t.Errorf("expected %d overrides, got %+v", tt.overrides, p.picks.Overrides)
+			}
+		})
+	}
+}
+
+func TestDraftSetStreak(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		locked  []int
+		want    string
+		wantErr bool
+	}{
+		{"team in the slate", []string{"penn state"}, nil, "penn-state", false},
+		{"no streak", nil, nil, "", false},
+		{"back to the model", []string{"Wisconsin"}, nil, "wisconsin", false},
+		{"unknown team", []string{"Nebraska"}, nil, "wisconsin", true},
+		{"team not in the slate", []string{"Rutgers"}, nil, "wisconsin", true},
+		{"team in a locked game", []string{"Iowa"}, []int{1}, "wisconsin", true},
+		{"locked streak", []string{"Iowa"}, []int{3}, "wisconsin", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Draft{plan: testPlan(tt.locked...)}
+			err := d.SetStreak(tt.names)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tt.wantErr, err)
+			}
+			if err != nil && KindOf(err) != KindInvalidInput {
+				t.Errorf("expected invalid input, got %v", err)
+			}
+			if got := testPicks(d.plan)[0]; got != tt.want {
+				t.Errorf("expected streak '%s', got '%s'", tt.want, got)
+			}
+			if tt.want == "wisconsin" && len(d.Picks().Overrides) != 0 {
+				t.Errorf("expected no overrides, got %+v", d.Picks().Overrides)
+			}
+		})
+	}
+}
+
+func TestDraftFlipPick(t *testing.T) {
+	tests := []struct {
+		name      string
+		rows      []int
+		locked    []int
+		want      map[int]string
+		overrides int
+		wantErr   string
+	}{
+		{"straight-up game", []int{1}, nil, map[int]string{1: "michigan"}, 1, ""},
+		{"noisy spread game", []int{3}, nil, map[int]string{3: "wisconsin"}, 1, ""},
+		{"flipped back", []int{1, 1}, nil, map[int]string{1: "iowa"}, 0, ""},
+		{"superdog game", []int{6}, nil, map[int]string{1: "iowa"}, 0, "row 6 is a superdog game"},
+		{"no game", []int{9}, nil, map[int]string{1: "iowa"}, 0, "no game in row 9"},
+		{"locked game", []int{1}, []int{1}, map[int]string{1: "iowa"}, 0, "has already started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Draft{plan: testPlan(tt.locked...)}
+			var err error
+			for _, row := range tt.rows {
+				if err = d.FlipPick(row); err != nil {
+					break
+				}
+			}
+			if tt.wantErr != "" {
+				if KindOf(err) != KindInvalidInput || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected invalid input error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("FlipPick: %v", err)
+			}
+			got := testPicks(d.plan)
+			for row, team := range tt.want {
+				if got[row] != team {
+					t.Errorf("row %d: expected %s, got %s", row, team, got[row])
+				}
+			}
+			if len(d.Picks().Overrides) != tt.overrides {
+				t.Errorf("expected %d overrides, got %+v", tt.overrides, d.Picks().Overrides)
+			}
+		})
+	}
+}
+
+func TestDraftChooseSuperdog(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     int
+		locked  []int
+		want    string
+		wantErr string
+	}{
+		{"another superdog", 7, nil, "illinois", ""},
+		{"no superdog", 0, nil, "", ""},
+		{"the model superdog", 6, nil, "purdue", ""},
+		{"not a superdog game", 1, nil, "purdue", "no superdog game in row 1"},
+		{"picked superdog locked", 7, []int{6}, "purdue", "the superdog game in row 6 has already started"},
+		{"chosen superdog locked", 7, []int{7}, "purdue", "the superdog game in row 7 has already started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Draft{plan: testPlan(tt.locked...)}
+			err := d.ChooseSuperdog(tt.row)
+			if tt.wantErr != "" {
+				if KindOf(err) != KindInvalidInput || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected invalid input error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("ChooseSuperdog: %v", err)
+			}
+			if got := testPicks(d.plan)[-1]; got != tt.want {
+				t.Errorf("expected superdog '%s', got '%s'", tt.want, got)
+			}
+			if wantOverride := tt.want != "purdue"; wantOverride != (len(d.Picks().Overrides) == 1) {
+				t.Errorf("expected override %t, got %+v", wantOverride, d.Picks().Overrides)
+			}
+		})
+	}
+}
+
+func TestPlanCheckDeadline(t *testing.T) {
+	t0 := time.Date(2021, 10, 2, 11, 0, 0, 0, time.UTC)
+	sched := &schedule{
+		deadline: t0.Add(3 * time.Hour),
+		kickoffs: map[int]time.Time{1: t0.Add(time.Hour), 2: t0.Add(4 * time.Hour), 3: {}},
+	}
+	tests := []struct {
+		name    string
+		policy  string
+		locked  []int
+		t       time.Time
+		wantErr string
+	}{
+		{"nothing started", LateUnstarted, nil, t0, ""},
+		{"game started while drafting", LateUnstarted, nil, t0.Add(time.Hour), "the games in rows 1 started after the picks were made"},
+		{"game started before drafting", LateUnstarted, []int{1}, t0.Add(time.Hour), ""},
+		{"deadline passed while drafting", LateUnstarted, []int{1}, t0.Add(3 * time.Hour), "the games in rows 3 started"},
+		{"deadline passed under the refuse policy", LateRefuse, nil, t0.Add(3 * time.Hour), "pick deadline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPlan(tt.locked...)
+			p.schedule, p.latePolicy = sched, tt.policy
+			err := p.checkDeadline(tt.t)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if KindOf(err) != KindDeadlinePassed || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected deadline passed error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// A plan without a schedule has no deadline.
+	if err := testPlan().checkDeadline(t0); err != nil {
+		t.Errorf("expected no error without a schedule, got %v", err)
+	}
+}
+
+func TestDraftEndsRun(t *testing.T) {
+	t0 := time.Date(2021, 10, 2, 11, 0, 0, 0, time.UTC)
+	setNow(t, t0)
+	tests := []struct {
+		name    string
+		end     func(d *Draft) error
+		wantErr string
+	}{
+		{"discarded", func(d *Draft) error { d.Discard(); return nil }, "draft discarded"},
+		{"committed after kickoff", func(d *Draft) error { _, err := d.Commit(); return err }, "the games in rows 1 started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &recordingExporter{}
+			setExporter(t, e)
+			ctx, root := startSpan(withTelemetry(context.Background(), "trace"), "run")
+			p := testPlan()
+			p.schedule = &schedule{kickoffs: map[int]time.Time{1: t0}}
+			p.latePolicy = LateUnstarted
+			d := &Draft{ctx: ctx, root: root, plan: p}
+
+			err := tt.end(d)
+			if tt.wantErr != "" && err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+			if len(e.spans) != 1 || e.spans[0].Status != "error" || !strings.Contains(e.spans[0].Error, tt.wantErr) {
+				t.Fatalf("expected the run ended with an error containing %q, got %+v", tt.wantErr, e.spans)
+			}
+
+			// The run ends only once.
+			d.Discard()
+			if _, err := d.Commit(); err == nil {
+				t.Errorf("expected an error committing an ended draft")
+			}
+			if len(e.spans) != 1 {
+				t.Errorf("expected the run ended once, got %+v", e.spans)
+			}
+		})
+	}
+}
+
+func TestBestSuperdog(t *testing.T) {
+	tests := []struct {
+		name     string
+		excluded []string
+		locked   []int
+		picked   bool
+		want     int
+	}{
+		{"picked superdog not excluded", []string{"illinois"}, nil, true, -1},
+		{"picked superdog excluded", []string{"purdue"}, nil, true, 7},
+		{"every superdog excluded", []string{"purdue", "illinois"}, nil, true, 0},
+		{"picked superdog locked", []string{"purdue"}, []int{6}, true, -1},
+		{"best superdog locked", []string{"purdue"}, []int{7}, true, 0},
+		{"nothing picked", []string{"maryland"}, nil, false, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPlan(tt.locked...)
+			if !tt.picked {
+				p.picks.Superdog[0].Pick = nil
+			}
+			excluded := make(map[string]bool)
+			for _, id := range tt.excluded {
+				excluded[id] = true
+			}
+			if got := p.bestSuperdog(excluded); got != tt.want {
+				t.Errorf("expected row %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOverridesProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		o    Overrides
+		want []string
+	}{
+		{"valid", Overrides{Picks: []ForcedPick{{Team: "Iowa"}, {Team: "Purdue"}, {Row: 3, Team: "Iowa"}}, ExcludeSuperdogs: []string{"Purdue"}, Superdog: "Illinois", Streak: []string{"Iowa", "Ohio State"}}, nil},
+		{"no team", Overrides{Picks: []ForcedPick{{Row: 1, Team: " "}}}, []string{"forced pick with no team"}},
+		{"negative row", Overrides{Picks: []ForcedPick{{Row: -1, Team: "Iowa"}}}, []string{"forced pick of 'Iowa' in negative row -1"}},
+		{"same row", Overrides{Picks: []ForcedPick{{Row: 2, Team: "Iowa"}, {Row: 2, Team: "Michigan"}}}, []string{"more than one forced pick in row 2"}},
+		{"excluded superdog", Overrides{ExcludeSuperdogs: []string{"purdue"}, Superdog: "Purdue"}, []string{"superdog 'purdue' is also excluded"}},
+		{"streak of none", Overrides{Streak: []string{"none"}}, nil},
+		{"streak of none and a team", Overrides{Streak: []string{"Iowa", "none"}}, []string{"streak of 'none' and other teams"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.o.problems(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReadOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    *Overrides
+		wantErr bool
+	}{
+		{
+			name: "yaml",
+			in:   "picks:\n  - team: Purdue\n  - row: 7\n    team: Iowa\nexcludeSuperdogs: [Northwestern]\nsuperdog: Illinois\nstreak: [Ohio State]\n",
+			want: &Overrides{
+				Picks:            []ForcedPick{{Team: "Purdue"}, {Row: 7, Team: "Iowa"}},
+				ExcludeSuperdogs: []string{"Northwestern"},
+				Superdog:         "Illinois",
+				Streak:           []string{"Ohio State"},
+			},
+		},
+		{
+			name: "json",
+			in:   `{"picks": [{"row": 1, "team": "Iowa"}], "superdog": "none"}`,
+			want: &Overrides{Picks: []ForcedPick{{Row: 1, Team: "Iowa"}}, Superdog: "none"},
+		},
+		{name: "empty", in: "", want: &Overrides{}},
+		{name: "unknown field", in: "superdogs: [Purdue]\n", wantErr: true},
+		{name: "malformed", in: "picks: [", wantErr: true},
+		{name: "invalid", in: "picks:\n  - row: 2\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadOverrides(strings.NewReader(tt.in))
+			if tt.wantErr {
+				if KindOf(err) != KindInvalidInput {
+					t.Errorf("expected invalid input, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadOverrides: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -4,13 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
 	"gonum.org/v1/gonum/stat/distuv"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 
 	bpefs "github.com/reallyasi9/b1gpickem/firestore"
 )
@@ -24,6 +28,12 @@ var fsclient *firestore.Client
 // csclient is a Cloud Store client
 var csclient *storage.Client
 
+// mailer delivers picks by email (nil means no mail server is configured)
+var mailer Sender
+
+// mailFrom is the address from which picks are delivered
+var mailFrom = os.Getenv("SMTP_FROM")
+
 // PubSubMessage is the payload of a Pub/Sub event.
 type PubSubMessage struct {
 	Data []byte `json:"data"`
@@ -48,444 +58,866 @@ type PickEmMessage struct {
 
 	// DryRun tells the code to print what would be written, but not two create the excel output.
 	DryRun bool `json:"dryrun,omitempty"`
+
+	// Formats lists the output formats to write: any of "xlsx", "json", "csv", "md", or "html" (empty value means "xlsx" with "md" and "html" summaries next to it).
+	Formats []string `json:"formats,omitempty"`
+
+	// Deadline overrides the pick deadline of the slate (nil means use the deadline of the slate, or the earliest kickoff if the slate has none).
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// LatePolicy is what to do after the deadline: "refuse" to pick (the default) or pick only games that have not yet started ("unstarted").
+	// Whatever the policy, the picks already stored for games that have started are kept, as they are when repicking.
+	LatePolicy string `json:"latePolicy,omitempty"`
+
+	// FallbackModel is a path to a model to use for games that the chosen models do not predict (empty value means fall back to the next-best model and then to a heuristic)
+	FallbackModel string `json:"fallbackModel,omitempty"`
+
+	// SwapPolicy is how to resolve games for which the slate has the home and road teams reversed: "trust_model" (the default), "trust_slate", or "fail".
+	SwapPolicy string `json:"swapPolicy,omitempty"`
+
+	// NeutralPolicy is how to resolve games for which the slate and model disagree about the neutral site: "trust_model" (the default), "trust_slate", or "fail".
+	NeutralPolicy string `json:"neutralPolicy,omitempty"`
+
+	// Repick tells the code to keep the picks already made for games that have started and repick only the rest.
+	// Repicking implies the "unstarted" late policy unless another policy is given.
+	Repick bool `json:"repick,omitempty"`
+
+	// TeamAliases maps additional team names, abbreviations, or document IDs to the document IDs of canonical teams.
+	// These supplement the names of the teams and the aliases in the team_aliases collection.
+	TeamAliases map[string]string `json:"teamAliases,omitempty"`
+
+	// Overrides are changes to force on the picks after the models make them (nil means no changes).
+	Overrides *Overrides `json:"overrides,omitempty"`
 }
 
 // Model is a collection of performance metrics, predictions, and a distribution.
+// A Model is indexed when it is made and is safe for concurrent use.
 type Model struct {
 	Performance    bpefs.ModelPerformance
 	Predictions    []bpefs.Prediction
 	Distribution   distuv.Normal
 	PredictionRefs []*firestore.DocumentRef
 
-	homeLookup map[string]int
-	roadLookup map[string]int
+	teams    *TeamResolver
+	matchups map[matchup][]int
 }
 
-// Lookup prediction by home and road teams, and whether or not to swap them for the slate.
-func (m *Model) Lookup(home, road *firestore.DocumentRef) (*bpefs.Prediction, *firestore.DocumentRef, bool, error) {
-	if m.homeLookup == nil || m.roadLookup == nil {
-		// Make a lookup table for home and road teams
-		m.homeLookup = make(map[string]int)
-		m.roadLookup = make(map[string]int)
-		for i, model := range m.Predictions {
-			m.homeLookup[model.HomeTeam.ID] = i
-			m.roadLookup[model.AwayTeam.ID] = i
+// matchup is an unordered pair of team IDs.
+type matchup struct {
+	a, b string
+}
+
+// newMatchup makes a matchup of two teams regardless of which is home and which is road.
+func newMatchup(team1, team2 string) matchup {
+	if team2 < team1 {
+		team1, team2 = team2, team1
+	}
+	return matchup{team1, team2}
+}
+
+// NewModel makes a model from performance metrics and predictions, indexing the predictions by matchup.
+// Teams are matched by their canonical identities if a team resolver is given.
+func NewModel(perf bpefs.ModelPerformance, preds []bpefs.Prediction, predRefs []*firestore.DocumentRef, teams *TeamResolver) *Model {
+	m := &Model{
+		Performance:    perf,
+		Predictions:    preds,
+		Distribution:   distuv.Normal{Mu: perf.Bias, Sigma: perf.StdDev},
+		PredictionRefs: predRefs,
+		teams:          teams,
+		matchups:       make(map[matchup][]int),
+	}
+	for i, pred := range preds {
+		key := newMatchup(teams.ID(pred.HomeTeam), teams.ID(pred.AwayTeam))
+		m.matchups[key] = append(m.matchups[key], i)
+	}
+	for key, idx := range m.matchups {
+		if len(idx) > 1 {
+			logger.Warnf("Model '%s' predicts %s vs. %s %d times: lookups of this matchup will fail", perf.System, key.a, key.b, len(idx))
 		}
 	}
-	var hr, rr int
-	var ok, maybeSwap bool
+	return m
+}
 
-	hr, ok = m.homeLookup[home.ID]
-	// if found, everything is fine.
-	// if not, maybe Luke got home and road mixed up?
+// Lookup prediction by home and road teams, and whether or not to swap them for the slate.
+// Teams are matched by their canonical identities if the model was made with a team resolver.
+// It is an error if the model predicts the same matchup more than once.
+func (m *Model) Lookup(home, road *firestore.DocumentRef) (*bpefs.Prediction, *firestore.DocumentRef, bool, error) {
+	homeID, roadID := m.teams.ID(home), m.teams.ID(road)
+	idx, ok := m.matchups[newMatchup(homeID, roadID)]
 	if !ok {
-		hr, maybeSwap = m.roadLookup[home.ID]
-		if !maybeSwap {
-			return nil, nil, false, fmt.Errorf("home team '%s' not in predicted game", home.ID)
+		return nil, nil, false, fmt.Errorf("home '%s' and road '%s' not playing each other", homeID, roadID)
+	}
+	if len(idx) > 1 {
+		refs := make([]string, len(idx))
+		for i, j := range idx {
+			refs[i] = m.PredictionRefs[j].ID
 		}
+		return nil, nil, false, fmt.Errorf("home '%s' and road '%s' play each other in %d predicted games: %s", homeID, roadID, len(idx), strings.Join(refs, ", "))
 	}
 
-	// if home is where it should be, road should be found as well
-	if !maybeSwap {
-		rr, ok = m.roadLookup[road.ID]
-		if !ok {
-			return nil, nil, false, fmt.Errorf("road team '%s' not in predicted game", road.ID)
+	i := idx[0]
+	pred := &m.Predictions[i]
+	// Maybe Luke got home and road mixed up?
+	swap := m.teams.ID(pred.HomeTeam) != homeID
+	return pred, m.PredictionRefs[i], swap, nil
+}
+
+// gameTypeOf returns the type of pick to make for a game: "StraightUp", "NoisySpread", or "Superdog".
+func gameTypeOf(game bpefs.Game) string {
+	gameType := "StraightUp"
+	if game.Superdog {
+		gameType = "Superdog"
+	}
+	if game.NoisySpread != 0 {
+		gameType = "NoisySpread"
+	}
+	return gameType
+}
+
+// loadedSlate is a slate and its games as loaded from Firestore.
+type loadedSlate struct {
+	doc      *firestore.DocumentSnapshot
+	slate    bpefs.Slate
+	gameDocs []*firestore.DocumentSnapshot
+	games    []bpefs.Game
+}
+
+// loadSlate loads a slate and its games, ordered by row.
+// The slate and its games are read concurrently.
+func loadSlate(ctx context.Context, path string) (*loadedSlate, error) {
+	slateRef := fsclient.Doc(path)
+	if slateRef == nil {
+		return nil, newError(KindInvalidInput, "invalid slate path '%s'", path)
+	}
+	ls := &loadedSlate{}
+
+	g := newGroup(ctx, maxConcurrentReads)
+	g.Go(func(ctx context.Context) error {
+		slateDoc, err := slateRef.Get(ctx)
+		if err != nil {
+			return backendError(err, "failed getting slate '%s'", path)
+		}
+		var slate bpefs.Slate
+		if err := slateDoc.DataTo(&slate); err != nil {
+			return newError(KindInconsistent, "failed parsing slate '%s': %v", path, err)
 		}
-	} else {
-		// road should be in home list
-		rr, ok = m.homeLookup[road.ID]
-		if !ok {
-			return nil, nil, false, fmt.Errorf("road->home team '%s' not in predicted game", road.ID)
+		logFrom(ctx).Debugf("Got slate '%s': week %d, file '%s'", slateDoc.Ref.ID, slate.Week, slate.FileName)
+		ls.doc, ls.slate = slateDoc, slate
+		return nil
+	})
+	g.Go(func(ctx context.Context) error {
+		gameDocs, err := slateRef.Collection("games").OrderBy("row", firestore.Asc).Documents(ctx).GetAll()
+		if err != nil {
+			return backendError(err, "failed getting games from slate '%s'", path)
 		}
+		games := make([]bpefs.Game, len(gameDocs))
+		for i, doc := range gameDocs {
+			var game bpefs.Game
+			if err := doc.DataTo(&game); err != nil {
+				return newError(KindInconsistent, "failed parsing game '%s': %v", doc.Ref.ID, err)
+			}
+			logFrom(ctx).With("row", game.Row).Debugf("Got game '%s'", doc.Ref.ID)
+			games[i] = game
+		}
+		ls.gameDocs, ls.games = gameDocs, games
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return ls, nil
+}
+
+// loadedPicker is a picker and the delivery profile stored with it.
+type loadedPicker struct {
+	doc     *firestore.DocumentSnapshot
+	picker  bpefs.Picker
+	profile pickerProfile
+}
+
+// loadPicker loads a picker by Luke name.
+func loadPicker(ctx context.Context, name string) (*loadedPicker, error) {
+	pickerDoc, err := fsclient.Collection("pickers").Where("name_luke", "==", name).Limit(1).Documents(ctx).Next()
+	if err != nil {
+		return nil, backendError(err, "failed getting picker '%s'", name)
+	}
+	lp := &loadedPicker{doc: pickerDoc}
+	if err := pickerDoc.DataTo(&lp.picker); err != nil {
+		return nil, newError(KindInconsistent, "failed parsing picker '%s': %v", name, err)
+	}
+	logFrom(ctx).Debugf("Got picker '%s' (%s)", pickerDoc.Ref.ID, lp.picker.Name)
+	if err := pickerDoc.DataTo(&lp.profile); err != nil {
+		return nil, newError(KindInconsistent, "failed parsing profile of picker '%s': %v", name, err)
 	}
+	return lp, nil
+}
+
+// loadModels loads the models for each game type (as returned by GetModels) concurrently.
+// A model chosen for more than one game type is loaded only once.
+func loadModels(ctx context.Context, docs map[string]*firestore.DocumentSnapshot, teams *TeamResolver) (map[string]*Model, error) {
+	byPath := make(map[string]*Model)
+	unique := make(map[string]*firestore.DocumentSnapshot)
+	for _, doc := range docs {
+		unique[doc.Ref.Path] = doc
+	}
+
+	var mu sync.Mutex
+	g := newGroup(ctx, maxConcurrentReads)
+	for p, doc := range unique {
+		p, doc := p, doc
+		g.Go(func(ctx context.Context) error {
+			model, err := loadModel(ctx, doc, teams)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			byPath[p] = model
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	models := make(map[string]*Model)
+	for gameType, doc := range docs {
+		models[gameType] = byPath[doc.Ref.Path]
+	}
+	return models, nil
+}
 
-	// now check if the predicted games are the same (i.e., home is actually playing road!)
-	if hr != rr {
-		return nil, nil, false, fmt.Errorf("home '%s' and road '%s' not playing each other", home.ID, road.ID)
+// loadModel loads a model's performance and predictions from a model performance document.
+// The teams of the predictions are replaced with their canonical teams if a team resolver is given.
+func loadModel(ctx context.Context, doc *firestore.DocumentSnapshot, teams *TeamResolver) (*Model, error) {
+	var modelPerf bpefs.ModelPerformance
+	if err := doc.DataTo(&modelPerf); err != nil {
+		return nil, newError(KindInconsistent, "failed parsing model performance '%s': %v", doc.Ref.ID, err)
 	}
+	logFrom(ctx).Debugf("Got model performance for '%s' (%s)", doc.Ref.ID, modelPerf.System)
 
-	return &(m.Predictions[hr]), m.PredictionRefs[hr], maybeSwap, nil
+	preds, predRefs, err := predictions.get(ctx, doc.Ref)
+	if err != nil {
+		return nil, err
+	}
+	for i := range preds {
+		preds[i].HomeTeam = teams.Resolve(preds[i].HomeTeam)
+		preds[i].AwayTeam = teams.Resolve(preds[i].AwayTeam)
+	}
+	logFrom(ctx).Debugf("Got %d predictions from model '%s'", len(preds), doc.Ref.ID)
+
+	return NewModel(modelPerf, preds, predRefs, teams), nil
 }
 
 func init() {
-	ctx := context.Background()
-	var err error
-	fsclient, err = firestore.NewClient(ctx, projectID)
+	// Clients that cannot be made from the environment are not fatal, so that commands can connect later.
+	if err := Connect(context.Background(), projectID, ""); err != nil {
+		logger.Debugf("Not connected: %v", err)
+	}
+	s, err := NewSMTPSenderFromEnv()
+	switch {
+	case err != nil:
+		logger.Warnf("Not delivering picks by email: %v", err)
+	case s != nil:
+		mailer = s
+	}
+}
+
+// Connect makes the Firestore and Cloud Storage clients used by the package, replacing any clients already made.
+// An empty project means the project given by GCP_PROJECT, and an empty credentials file means the default
+// credentials of the environment.
+func Connect(ctx context.Context, project, credentialsFile string) error {
+	if project == "" {
+		project = os.Getenv("GCP_PROJECT")
+	}
+	var opts []option.ClientOption
+	if credentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsFile))
+	}
+	fs, err := firestore.NewClient(ctx, project, opts...)
 	if err != nil {
-		log.Fatalf("failed making Firestore client: %v", err)
-		panic(err)
+		return fmt.Errorf("failed making Firestore client: %v", err)
 	}
-	csclient, err = storage.NewClient(ctx)
+	cs, err := storage.NewClient(ctx, opts...)
 	if err != nil {
-		log.Fatalf("Failed making Cloud Storage client: %v", err)
-		panic(err)
+		fs.Close()
+		return fmt.Errorf("failed making Cloud Storage client: %v", err)
+	}
+	if fsclient != nil {
+		fsclient.Close()
+	}
+	if csclient != nil {
+		csclient.Close()
 	}
+	projectID, fsclient, csclient = project, fs, cs
+	return nil
+}
+
+// connected fails if the package has no clients to work with.
+func connected() error {
+	if fsclient == nil || csclient == nil {
+		return newError(KindUnknown, "not connected to Firestore: set GCP_PROJECT or call Connect")
+	}
+	return nil
+}
+
+// SetSender replaces the sender used to deliver picks by email.
+func SetSender(s Sender) {
+	mailer = s
 }
 
 // PickEm consumes a Pub/Sub message.
+// Only retryable failures are returned, so that Pub/Sub does not retry requests that will never succeed.
 func PickEm(ctx context.Context, m PubSubMessage) error {
 	var pem PickEmMessage
 	err := json.Unmarshal(m.Data, &pem)
 	if err != nil {
-		log.Printf("json.Unmarshal: %v", err)
-		return err
+		logger.Errorf("Malformed message: %v", err)
+		return nil
+	}
+	_, err = pickAndPublish(ctx, pem)
+	if err != nil && !IsRetryable(err) {
+		logger.Errorf("Permanent failure (%s): not retrying: %v", KindOf(err), err)
+		return nil
 	}
+	return err
+}
 
-	// Get the slate
-	slateDoc, err := fsclient.Doc(pem.Slate).Get(ctx)
+// Run makes, stores, writes, and delivers the picks requested by a message, and publishes the result.
+// Unlike PickEm, every failure is returned.
+func Run(ctx context.Context, pem PickEmMessage) (*PickSet, error) {
+	return pickAndPublish(ctx, pem)
+}
+
+// Preview makes the picks requested by a message without storing, writing, or delivering them.
+func Preview(ctx context.Context, pem PickEmMessage) (*PickSet, error) {
+	plan, err := makePicks(ctx, pem)
 	if err != nil {
-		log.Printf("Failed getting slate '%s': %v", pem.Slate, err)
-		return err
+		return nil, err
 	}
-	var slate bpefs.Slate
-	err = slateDoc.DataTo(&slate)
+	return plan.picks, nil
+}
+
+// pickEm makes, stores, writes, and delivers the picks requested by a message, returning the picks that were made.
+// If the message asks for a dry run, nothing is stored and outputs are written to local files.
+func pickEm(ctx context.Context, pem PickEmMessage) (*PickSet, error) {
+	plan, err := makePicks(ctx, pem)
 	if err != nil {
-		log.Printf("Failed parsing slate '%s': %v", pem.Slate, err)
-		return err
+		return nil, err
 	}
-	log.Printf("Got slate '%s': %v", slateDoc.Ref.ID, slate)
+	return plan.commit(ctx)
+}
 
-	gameDocs, err := slateDoc.Ref.Collection("games").OrderBy("row", firestore.Asc).Documents(ctx).GetAll()
+// pickPlan is a pick set that has been made but not yet stored, written, or delivered, with what is needed to do so.
+type pickPlan struct {
+	pem      PickEmMessage
+	picks    *PickSet
+	slate    bpefs.Slate
+	picker   bpefs.Picker
+	profile  pickerProfile
+	repickOf *firestore.DocumentRef
+
+	// games are the games of the slate, computed are how they were picked by row, and teams resolved their teams.
+	games    []bpefs.Game
+	computed map[int]*computedPick
+	teams    *TeamResolver
+
+	// modelStreak is the streak pick before any override.
+	modelStreak *bpefs.StreakPick
+
+	// schedule is the schedule of the slate, and latePolicy how to treat games that have started.
+	schedule   *schedule
+	latePolicy string
+}
+
+// makePicks reads everything needed to pick the slate requested by a message and makes the picks.
+func makePicks(ctx context.Context, pem PickEmMessage) (*pickPlan, error) {
+	if err := connected(); err != nil {
+		return nil, err
+	}
+	if err := checkMessage(pem); err != nil {
+		logFrom(ctx).Errorf("Bad message: %v", err)
+		return nil, err
+	}
+	policies, err := newReconcilePolicies(pem.SwapPolicy, pem.NeutralPolicy)
 	if err != nil {
-		log.Printf("Failed getting games from slate '%s': %v", pem.Slate, err)
-		return err
+		logFrom(ctx).Errorf("Bad reconciliation policy: %v", err)
+		return nil, err
 	}
-	games := make([]bpefs.Game, len(gameDocs))
-	for i, doc := range gameDocs {
-		var game bpefs.Game
-		err = doc.DataTo(&game)
+	run := runFrom(ctx)
+
+	// Read the slate, teams, picker, and models concurrently
+	var (
+		ls            *loadedSlate
+		teams         *TeamResolver
+		lp            *loadedPicker
+		modelPerfDocs map[string]*firestore.DocumentSnapshot
+	)
+	pctx, done := startPhase(ctx, "read")
+	g := newGroup(pctx, maxConcurrentReads)
+	g.Go(func(ctx context.Context) error {
+		ctx, sp := startSpan(ctx, "slate.load")
+		var err error
+		ls, err = loadSlate(ctx, pem.Slate)
+		sp.end(err)
+		if err != nil {
+			return fmt.Errorf("failed loading slate: %w", err)
+		}
+		sp.set("games", len(ls.games))
+		return nil
+	})
+	g.Go(func(ctx context.Context) error {
+		var err error
+		if teams, err = LoadTeamResolver(ctx); err != nil {
+			return fmt.Errorf("failed loading teams: %w", err)
+		}
+		return nil
+	})
+	g.Go(func(ctx context.Context) error {
+		var err error
+		lp, err = loadPicker(ctx, pem.Picker)
+		return err
+	})
+	g.Go(func(ctx context.Context) error {
+		ctx, sp := startSpan(ctx, "models.resolve")
+		var err error
+		modelPerfDocs, err = GetModels(ctx, pem.StraightModel, pem.NoisySpreadModel, pem.SuperdogModel)
+		sp.end(err)
 		if err != nil {
-			log.Printf("Failed parsing game '%s': %v", doc.Ref.ID, err)
-			return err
+			return fmt.Errorf("failed getting models: %w", err)
+		}
+		return nil
+	})
+	err = g.Wait()
+	done(err)
+	if err != nil {
+		logFrom(ctx).Errorf("%v", err)
+		return nil, err
+	}
+	slateDoc, slate, gameDocs, games := ls.doc, ls.slate, ls.gameDocs, ls.games
+	pickerDoc, picker, profile := lp.doc, lp.picker, lp.profile
+
+	// Match the teams of the slate to canonical teams
+	for alias, id := range pem.TeamAliases {
+		if err := teams.AddAlias(alias, id); err != nil {
+			logFrom(ctx).Errorf("Bad team alias: %v", err)
+			return nil, err
 		}
-		log.Printf("Got game '%s': %v", doc.Ref.ID, game)
-		games[i] = game
+	}
+	rows := make([]int, len(games))
+	for i := range games {
+		teams.resolveGame(&games[i])
+		rows[i] = games[i].Row
+	}
+	if unresolved := teams.Unresolved(); len(unresolved) > 0 {
+		logFrom(ctx).Warnf("Slate teams not matched to any known team: %s", strings.Join(unresolved, ", "))
 	}
 
-	// Get the picker
-	pickerDoc, err := fsclient.Collection("pickers").Where("name_luke", "==", pem.Picker).Limit(1).Documents(ctx).Next()
+	// Check the deadline
+	sched, err := readSchedule(slateDoc, gameDocs, rows, pem.Deadline)
 	if err != nil {
-		log.Printf("Failed getting picker '%s': %v", pem.Picker, err)
-		return err
+		logFrom(ctx).Errorf("Failed reading schedule of slate '%s': %v", pem.Slate, err)
+		return nil, err
 	}
-	var picker bpefs.Picker
-	if err := pickerDoc.DataTo(&picker); err != nil {
-		log.Printf("Failed parsing picker '%s': %v", pem.Picker, err)
-		return err
+	latePolicy := pem.LatePolicy
+	if pem.Repick && latePolicy == "" {
+		latePolicy = LateUnstarted
 	}
-	log.Printf("Got picker '%s': %v", pickerDoc.Ref.ID, picker)
-
-	// Figure out the models to use
-	modelPerfDocs, err := GetModels(ctx, pem.StraightModel, pem.NoisySpreadModel, pem.SuperdogModel)
+	locked, err := enforceDeadline(sched, latePolicy, now())
 	if err != nil {
-		log.Printf("Failed getting models: %v", err)
-		return err
+		logFrom(ctx).Errorf("Refusing to pick slate '%s': %v", pem.Slate, err)
+		return nil, err
+	}
+	if len(locked) > 0 {
+		logFrom(ctx).Infof("Games in %d rows have already started and are locked", len(locked))
 	}
 
-	models := make(map[string]Model)
-	for gameType, doc := range modelPerfDocs {
-		var modelPerf bpefs.ModelPerformance
-		if err := doc.DataTo(&modelPerf); err != nil {
-			log.Printf("Failed parsing model performance '%v': %v", doc, err)
-			return err
-		}
-		log.Printf("Got model performance for '%s': %v", doc.Ref.ID, modelPerf)
-
-		predictionDocs, err := doc.Ref.Collection("predictions").Documents(ctx).GetAll()
+	// Read the predictions, streak, and previous picks concurrently
+	var (
+		models     map[string]*Model
+		streakPick *bpefs.StreakPick
+		prev       *previousPicks
+	)
+	pctx, done = startPhase(ctx, "predictions")
+	g = newGroup(pctx, maxConcurrentReads)
+	g.Go(func(ctx context.Context) error {
+		ctx, sp := startSpan(ctx, "predictions.load")
+		var err error
+		models, err = loadModels(ctx, modelPerfDocs, teams)
+		sp.end(err)
 		if err != nil {
-			log.Printf("Failed getting predictions from model '%v': %v", doc, err)
-			return err
+			return fmt.Errorf("failed loading model: %w", err)
 		}
-		preds := make([]bpefs.Prediction, len(predictionDocs))
-		predRefs := make([]*firestore.DocumentRef, len(predictionDocs))
-		for i, doc := range predictionDocs {
-			predRefs[i] = doc.Ref
-			var prediction bpefs.Prediction
-			if err := doc.DataTo(&prediction); err != nil {
-				log.Printf("Failed parsing prediction '%s': %v", doc.Ref.ID, err)
-				return err
+		sp.set("models", len(models))
+		return nil
+	})
+	g.Go(func(ctx context.Context) error {
+		var err error
+		streakPick, err = LookupStreakPick(ctx, pickerDoc.Ref, slate.Season, slate.Week)
+		return err
+	})
+	keepPrevious := pem.Repick || len(locked) > 0
+	if keepPrevious {
+		g.Go(func(ctx context.Context) error {
+			var err error
+			if prev, err = loadPreviousPicks(ctx, pickerDoc.Ref, slateDoc.Ref); err != nil {
+				return fmt.Errorf("failed loading previous picks: %w", err)
 			}
-			log.Printf("Got prediction '%s': %v", doc.Ref.ID, prediction)
-			preds[i] = prediction
-		}
-
-		dist := distuv.Normal{
-			Mu:    modelPerf.Bias,
-			Sigma: modelPerf.StdDev,
-		}
-
-		models[gameType] = Model{
-			Predictions:    preds,
-			Performance:    modelPerf,
-			Distribution:   dist,
-			PredictionRefs: predRefs,
-		}
+			return nil
+		})
 	}
-
-	// Pick-a-dog
-	var pickedDog *bpefs.SuperDogPick
-	var bestValue float64
+	err = g.Wait()
+	done(err)
+	if err != nil {
+		logFrom(ctx).Errorf("%v", err)
+		return nil, err
+	}
+	sdPath := pem.SuperdogModel
+	if sdPath == "" {
+		sdPath = pem.NoisySpreadModel
+	}
+	run.useModels(modelPerfDocs, models, map[string]string{
+		"StraightUp":  pem.StraightModel,
+		"NoisySpread": pem.NoisySpreadModel,
+		"Superdog":    sdPath,
+	})
+	fallbacks := newFallbackChain(modelPerfDocs, pem.FallbackModel, teams)
+	_, done = startPhase(ctx, "pick")
 
 	// Make picks separate from slate games
 	suPicks := make([]*bpefs.StraightUpPick, 0)
 	nsPicks := make([]*bpefs.NoisySpreadPick, 0)
 	sdPicks := make([]*bpefs.SuperDogPick, 0)
+	fallbackRows := make(map[int]string)
+	var reconciliations []Reconciliation
+	computed := make(map[int]*computedPick, len(games))
 
 	for _, game := range games {
-		gameType := "StraightUp"
-		if game.Superdog {
-			gameType = "Superdog"
-		}
-		if game.NoisySpread != 0 {
-			gameType = "NoisySpread"
+		gameType := gameTypeOf(game)
+		l := logFrom(ctx).With("row", game.Row)
+		gp := fallbacks.predict(ctx, gameType, models[gameType], game)
+		if gp.fallback != "" {
+			fallbackRows[game.Row] = gp.fallback
 		}
+		l.Debugf("Found prediction for teams %s and %s: spread %.1f", teams.Name(game.HomeTeam), teams.Name(game.AwayTeam), gp.prediction.Spread)
 
-		model := models[gameType]
-		modelPred, predRef, swap, err := model.Lookup(game.HomeTeam, game.AwayTeam)
+		cp, err := computePick(game, gp, policies, teams)
 		if err != nil {
-			log.Printf("Failed looking up prediction: %v", err)
-			return err
+			l.Errorf("Failed reconciling slate with model: %v", err)
+			done(err)
+			return nil, err
 		}
-		log.Printf("Found prediction for teams %s and %s: %v", game.HomeTeam.ID, game.AwayTeam.ID, *modelPred)
-
-		// The the model spread is always relative to the _correct_ home team (as understood by the model).
-		// That means the target, which is relative to the home team of the slate, might need ot be swapped as well.
-		spread := modelPred.Spread
-		target := game.NoisySpread
-		if swap {
-			spread *= -1 // "spread" is now relative to the slate home team.
-			target *= -1 // "target" is now relative to the true home team.
+		for _, r := range cp.reconciliations {
+			l.Infof("%s", r)
 		}
-		// This is tricky because prob needs to be relative to the true home team.
-		// The model already calculates the spread based on the true home team.
-		// The target (noisy spread) was just flipped if necessary, so it is also relative to the true home team.
-		prob := model.Distribution.CDF(modelPred.Spread - float64(target))
-
-		// Disagreement over neutral site?
-		neutralDisagreement := game.NeutralSite != modelPred.NeutralSite
-
-		// Update game
-		// Note that the game that is written reflects the slate, not the "truth".
-		// That means home and away teams and spreads might need to be swapped later.
-		if game.Superdog {
-			// The probability is always relative to the true home team.
-			// The "underdog" and "overdog" is parsed from the slate. They are taken to be correct as-is.
-			// The way that superdogs are parsed means the underdog is always considered the away team in the slate.
-			// So from the game's point of view, prob is the probability that the overdog wins.
-			// That means the probability has to be inverted for display purposes (unless the home team actually is the underdog, in which case we are okay).
-			if !swap {
-				prob = 1 - prob
-			} else {
-				// ...but it also means that the spread has to be set back to the original value. Ugh.
-				spread *= -1
-			}
-			sdp := bpefs.SuperDogPick{
-				Underdog:             game.Underdog,
-				Overdog:              game.Overdog,
-				UnderdogRank:         game.AwayRank,
-				OverdogRank:          game.HomeRank,
-				Value:                game.Value,
-				NeutralSite:          game.NeutralSite != neutralDisagreement, // logic: 0,0->0, 0,1->1, 1,0->1, 1,1->0
-				NeutralDisagreement:  neutralDisagreement,
-				HomeAwaySwap:         swap,
-				Pick:                 nil, // hold off on picking superdogs
-				PredictedSpread:      spread,
-				PredictedProbability: prob,
-				ModeledGame:          predRef,
-				Row:                  game.Row,
-			}
-			sdPicks = append(sdPicks, &sdp)
-			ev := prob * float64(game.Value)
-			if ev > bestValue {
-				pickedDog = &sdp
-				bestValue = ev
-			}
-			continue
+		reconciliations = append(reconciliations, cp.reconciliations...)
+		computed[game.Row] = cp
+		switch {
+		case cp.superdog != nil:
+			sdPicks = append(sdPicks, cp.superdog)
+		case cp.noisySpread != nil:
+			nsPicks = append(nsPicks, cp.noisySpread)
+		default:
+			suPicks = append(suPicks, cp.straightUp)
 		}
+	}
 
-		pick := modelPred.HomeTeam
-		if prob < 0.5 {
-			pick = modelPred.AwayTeam
-		}
-		if game.NoisySpread != 0 {
-			nsPicks = append(nsPicks, &bpefs.NoisySpreadPick{
-				HomeTeam:             modelPred.HomeTeam,
-				AwayTeam:             modelPred.AwayTeam,
-				AwayRank:             game.AwayRank,
-				HomeRank:             game.HomeRank,
-				NoisySpread:          game.NoisySpread,
-				NeutralSite:          game.NeutralSite != neutralDisagreement, // logic: 0,0->0, 0,1->1, 1,0->1, 1,1->0
-				NeutralDisagreement:  neutralDisagreement,
-				HomeAwaySwap:         swap,
-				Pick:                 pick,
-				PredictedSpread:      spread,
-				PredictedProbability: prob,
-				ModeledGame:          predRef,
-				Row:                  game.Row,
-			})
-			continue
+	picks := &PickSet{
+		Slate:           slateDoc.Ref,
+		Season:          slate.Season,
+		Week:            slate.Week,
+		Picker:          pickerDoc.Ref,
+		StraightUp:      suPicks,
+		NoisySpread:     nsPicks,
+		Superdog:        sdPicks,
+		Streak:          streakPick,
+		Locked:          locked,
+		Fallbacks:       fallbackRows,
+		Reconciliations: reconciliations,
+	}
+	for _, r := range reconciliations {
+		picks.annotate(r.Row, "RECONCILED:  "+r.String())
+	}
+	for _, row := range picks.lockedRows() {
+		picks.annotate(row, "LOCKED:  This game started before the picks were made.")
+	}
+
+	// Keep what has already been picked for locked games, so that games that have started are never picked anew
+	var previousRef *firestore.DocumentRef
+	if keepPrevious {
+		if prev == nil {
+			logFrom(ctx).Infof("No previous picks for picker '%s' in week %d: picking every game", pem.Picker, slate.Week)
+		} else {
+			logFrom(ctx).Infof("Repicking over previous picks '%s'", prev.ref.ID)
+			picks.keepLocked(ctx, prev)
+			previousRef = prev.ref
 		}
-		suPicks = append(suPicks, &bpefs.StraightUpPick{
-			HomeTeam:             modelPred.HomeTeam,
-			AwayTeam:             modelPred.AwayTeam,
-			AwayRank:             game.AwayRank,
-			HomeRank:             game.HomeRank,
-			GOTW:                 game.GOTW,
-			NeutralSite:          game.NeutralSite != neutralDisagreement, // logic: 0,0->0, 0,1->1, 1,0->1, 1,1->0
-			NeutralDisagreement:  neutralDisagreement,
-			HomeAwaySwap:         swap,
-			Pick:                 pick,
-			PredictedSpread:      spread,
-			PredictedProbability: prob,
-			ModeledGame:          predRef,
-			Row:                  game.Row,
-		})
 	}
 
-	// Pick that dog!  But only if dogs are still being picked!
-	if pickedDog != nil {
-		pickedDog.Pick = pickedDog.Underdog
+	for _, row := range picks.fallbackRows() {
+		picks.annotate(row, fmt.Sprintf("FALLBACK:  Picked using %s.", picks.Fallbacks[row]))
 	}
 
-	// Finally look up streak
-	streakPick, err := LookupStreakPick(ctx, pickerDoc.Ref, slate.Season, slate.Week)
-	if err != nil {
-		return err
+	// Pick that dog!  But only if dogs are still being picked!
+	picks.chooseSuperdog()
+
+	plan := &pickPlan{
+		pem:      pem,
+		picks:    picks,
+		slate:    slate,
+		picker:   picker,
+		profile:  profile,
+		repickOf: previousRef,
+		games:    games,
+		computed: computed,
+		teams:    teams,
+
+		modelStreak: picks.Streak,
+
+		schedule:   sched,
+		latePolicy: latePolicy,
 	}
 
-	if pem.DryRun {
-		f, err := os.CreateTemp(".", "dryrun.*.xlsx")
-		if err != nil {
-			return err
+	// Force what the message says to force
+	if pem.Overrides != nil {
+		if err := plan.applyOverrides(ctx, *pem.Overrides); err != nil {
+			logFrom(ctx).Errorf("Failed applying overrides: %v", err)
+			done(err)
+			return nil, err
 		}
-		defer f.Close()
+	}
+	done(nil)
 
-		log.Printf("DRYRUN: writing Excel output to path %s", f.Name())
+	return plan, nil
+}
 
-		outExcel, err := newExcelFile(ctx, suPicks, nsPicks, sdPicks, streakPick)
+// commit stores, writes, and delivers the picks of a plan, returning the picks.
+// If the plan is for a dry run, nothing is stored and outputs are written to local files.
+func (p *pickPlan) commit(ctx context.Context) (*PickSet, error) {
+	run := runFrom(ctx)
+	pem, picks, slate := p.pem, p.picks, p.slate
+	attachmentName := path.Base(slate.FileName)
+
+	if pem.DryRun {
+		var stem string
+		_, done := startPhase(ctx, "write")
+		err := writeOutputs(ctx, picks, pem.Formats, func(ext, _ string) (output, error) {
+			if stem != "" {
+				logFrom(ctx).Infof("DRYRUN: writing %s output to path %s.%s", ext, stem, ext)
+				run.output(stem + "." + ext)
+				return createFile(stem + "." + ext)
+			}
+			f, err := os.CreateTemp(".", "dryrun.*."+ext)
+			if err != nil {
+				return nil, err
+			}
+			stem = strings.TrimSuffix(f.Name(), "."+ext)
+			logFrom(ctx).Infof("DRYRUN: writing %s output to path %s", ext, f.Name())
+			run.output(f.Name())
+			return fileOutput{f}, nil
+		})
+		done(err)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		outExcel.Write(f)
-		return nil
+		pctx, done := startPhase(ctx, "deliver")
+		err = deliver(pctx, picks, p.picker, attachmentName, p.profile.Recipients, nil, true)
+		done(err)
+		return picks, err
 	}
 
 	// With picks in place, write to Firestore
-	err = fsclient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		picksColl := fsclient.Collection("picks")
-		picksRef := picksColl.NewDoc()
-		if err := tx.Create(picksRef, &bpefs.Picks{
-			Season: slate.Season,
-			Week:   slate.Week,
-			Picker: pickerDoc.Ref,
+	picksRef := fsclient.Collection("picks").NewDoc()
+	pctx, done := startPhase(ctx, "store")
+	err := fsclient.RunTransaction(pctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Create(picksRef, &picksDocument{
+			Picks: bpefs.Picks{
+				Season: picks.Season,
+				Week:   picks.Week,
+				Picker: picks.Picker,
+			},
+			Slate:           picks.Slate,
+			LockedRows:      picks.lockedRows(),
+			RepickOf:        p.repickOf,
+			Fallbacks:       picks.fallbackRecords(),
+			Reconciliations: picks.Reconciliations,
+			Run:             runRef(run),
+			Overrides:       picks.Overrides,
 		}); err != nil {
-			return fmt.Errorf("transaction failed to create picks: %v", err)
+			return backendError(err, "transaction failed to create picks")
 		}
 
 		suColl := picksRef.Collection("straight_up")
 		nsColl := picksRef.Collection("noisy_spread")
 		sdColl := picksRef.Collection("superdog")
 		streakColl := picksRef.Collection("streak")
-		for _, pick := range suPicks {
+		for _, pick := range picks.StraightUp {
 			ref := suColl.NewDoc()
 			if err := tx.Create(ref, pick); err != nil {
-				return fmt.Errorf("transaction failed to create StraightUpPick: %v", err)
+				return backendError(err, "transaction failed to create StraightUpPick")
 			}
 		}
-		for _, pick := range nsPicks {
+		for _, pick := range picks.NoisySpread {
 			ref := nsColl.NewDoc()
 			if err := tx.Create(ref, pick); err != nil {
-				return fmt.Errorf("transaction failed to create NoisySpreadPick: %v", err)
+				return backendError(err, "transaction failed to create NoisySpreadPick")
 			}
 		}
-		for _, pick := range sdPicks {
+		for _, pick := range picks.Superdog {
 			ref := sdColl.NewDoc()
 			if err := tx.Create(ref, pick); err != nil {
-				return fmt.Errorf("transaction failed to create SuperDogPick: %v", err)
+				return backendError(err, "transaction failed to create SuperDogPick")
 			}
 		}
-		if streakPick != nil {
+		if picks.Streak != nil {
 			ref := streakColl.NewDoc()
-			if err := tx.Create(ref, streakPick); err != nil {
-				return fmt.Errorf("transaction failed to create StreakPick: %v", err)
+			if err := tx.Create(ref, picks.Streak); err != nil {
+				return backendError(err, "transaction failed to create StreakPick")
 			}
 		}
 		return nil
 	})
+	done(err)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	picks.Ref = picksRef
 
 	bucket := csclient.Bucket(slate.Bucket)
-	obj := bucket.Object("picks/" + slate.FileName)
-	w := obj.NewWriter(ctx)
-	defer w.Close()
-	w.ObjectAttrs.ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
-
-	outExcel, err := newExcelFile(ctx, suPicks, nsPicks, sdPicks, streakPick)
+	stem := "picks/" + strings.TrimSuffix(slate.FileName, path.Ext(slate.FileName))
+	pctx, done = startPhase(ctx, "upload")
+	err = writeOutputs(pctx, picks, pem.Formats, func(ext, contentType string) (output, error) {
+		run.output(fmt.Sprintf("gs://%s/%s.%s", slate.Bucket, stem, ext))
+		return newObjectOutput(pctx, bucket.Object(stem+"."+ext), contentType), nil
+	})
+	done(err)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	outExcel.Write(w)
+	pctx, done = startPhase(ctx, "deliver")
+	err = deliver(pctx, picks, p.picker, attachmentName, p.profile.Recipients, picksRef, false)
+	done(err)
+	return picks, err
+}
 
+// modelCriterion is how the best model for picking a type of game is chosen from a prediction tracker.
+type modelCriterion struct {
+	orderBy string
+	dir     firestore.Direction
+}
+
+// modelCriteriaMu guards modelCriteria, which can be changed while models are being chosen.
+var modelCriteriaMu sync.RWMutex
+
+// modelCriteria are the criteria for choosing the best model for each type of game.
+var modelCriteria = map[string]modelCriterion{
+	// Greatest straight-up wins for straight-up picks
+	"StraightUp": {"suw", firestore.Desc},
+	// Lowest mean absolute error for noisy spread picks
+	"NoisySpread": {"mae", firestore.Asc},
+	// Lowest mean absolute error for superdog picks
+	"Superdog": {"mae", firestore.Asc},
+}
+
+// criterionFor returns the criterion for choosing the best model for a type of game.
+func criterionFor(gameType string) (modelCriterion, bool) {
+	modelCriteriaMu.RLock()
+	defer modelCriteriaMu.RUnlock()
+	c, ok := modelCriteria[gameType]
+	return c, ok
+}
+
+// SetModelCriterion changes how the best model for picking a type of game ("StraightUp", "NoisySpread", or "Superdog")
+// is chosen when no model is requested: by the greatest or least value of a metric, as named in ModelMetrics.
+func SetModelCriterion(gameType, metric string, descending bool) error {
+	if _, ok := criterionFor(gameType); !ok {
+		return newError(KindInvalidInput, "unknown game type '%s': expected StraightUp, NoisySpread, or Superdog", gameType)
+	}
+	if _, ok := modelMetrics[metric]; !ok {
+		return newError(KindInvalidInput, "unknown metric '%s': expected one of %s", metric, strings.Join(ModelMetrics(), ", "))
+	}
+	dir := firestore.Asc
+	if descending {
+		dir = firestore.Desc
+	}
+	modelCriteriaMu.Lock()
+	defer modelCriteriaMu.Unlock()
+	modelCriteria[gameType] = modelCriterion{metric, dir}
 	return nil
 }
 
 // GetModels returns the model requested by the given identifier string, or the most conservative model if an empty path is given.
 func GetModels(ctx context.Context, suPath, nsPath, sdPath string) (map[string]*firestore.DocumentSnapshot, error) {
+	if err := connected(); err != nil {
+		return nil, err
+	}
 
 	latestTracker, err := fsclient.Collection("prediction_tracker").OrderBy("timestamp", firestore.Desc).Limit(1).Documents(ctx).Next()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get latest prediction tracker: %v", err)
+		return nil, backendError(err, "failed to get latest prediction tracker")
+	}
+
+	if t, err := latestTracker.DataAt("timestamp"); err == nil {
+		if ts, ok := t.(time.Time); ok {
+			predictions.observeTracker(ctx, ts)
+		}
 	}
 
 	modelPerfs := latestTracker.Ref.Collection("model_performance")
 	models := make(map[string]*firestore.DocumentSnapshot)
 
-	search := func(path, orderBy string, dir firestore.Direction) (*firestore.DocumentSnapshot, error) {
+	search := func(ctx context.Context, path, orderBy string, dir firestore.Direction) (*firestore.DocumentSnapshot, error) {
 		if path == "" {
-			log.Printf("No model requested: finding model by %s (%v) at the time of pick", orderBy, dir)
+			logFrom(ctx).Infof("No model requested: finding model by %s (%v) at the time of pick", orderBy, dir)
 
 			greatModel, err := modelPerfs.OrderBy(orderBy, dir).Limit(1).Documents(ctx).Next()
 			if err != nil {
-				return nil, fmt.Errorf("failed to get best model: %v", err)
+				return nil, backendError(err, "failed to get best model")
 			}
 			return greatModel, nil
 		}
 		modelRef := fsclient.Doc(path)
 		model, err := modelPerfs.Where("model", "==", modelRef).Limit(1).Documents(ctx).Next()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get model at path '%s': %v", path, err)
+			return nil, backendError(err, "failed to get model at path '%s'", path)
 		}
 		return model, nil
 	}
 
-	// Greatest straight-up wins for straight-up picks
-	m, err := search(suPath, "suw", firestore.Desc)
-	if err != nil {
-		return nil, fmt.Errorf("GetModels: failed to get model for straight-up picks: %v", err)
+	if sdPath == "" {
+		logFrom(ctx).Infof("Superdog model not given: using noisy spread model instead")
+		sdPath = nsPath
 	}
-	models["StraightUp"] = m
-
-	// Lowest mean absolute error for noisy spread picks
-	m, err = search(nsPath, "mae", firestore.Asc)
-	if err != nil {
-		return nil, fmt.Errorf("GetModels: failed to get model for noisy spread picks: %v", err)
+	searches := []struct {
+		gameType string
+		what     string
+		path     string
+	}{
+		{"StraightUp", "straight-up", suPath},
+		{"NoisySpread", "noisy spread", nsPath},
+		{"Superdog", "superdog", sdPath},
 	}
-	models["NoisySpread"] = m
 
-	// Lowest mean absolute error for superdog picks
-	if sdPath == "" {
-		log.Print("Superdog model not given: using noisy spread model instead")
-		sdPath = nsPath
+	var mu sync.Mutex
+	g := newGroup(ctx, maxConcurrentReads)
+	for _, s := range searches {
+		s := s
+		g.Go(func(ctx context.Context) error {
+			c, _ := criterionFor(s.gameType)
+			m, err := search(ctx, s.path, c.orderBy, c.dir)
+			if err != nil {
+				return fmt.Errorf("GetModels: failed to get model for %s picks: %w", s.what, err)
+			}
+			mu.Lock()
+			models[s.gameType] = m
+			mu.Unlock()
+			return nil
+		})
 	}
-	m, err = search(sdPath, "mae", firestore.Asc)
-	if err != nil {
-		return nil, fmt.Errorf("GetModels: failed to get model for superdog picks: %v", err)
+	if err := g.Wait(); err != nil {
+		return nil, err
 	}
-	models["Superdog"] = m
 
 	return models, nil
 }
@@ -499,11 +931,11 @@ func LookupStreakPick(ctx context.Context, picker, season *firestore.DocumentRef
 		return nil, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed getting streak prediction for picker '%s', season '%s', week %d: %v", picker.ID, season.ID, week, err)
+		return nil, backendError(err, "failed getting streak prediction for picker '%s', season '%s', week %d", picker.ID, season.ID, week)
 	}
 	var streakPrediction bpefs.StreakPredictions
 	if err := streakPredictionDoc.DataTo(&streakPrediction); err != nil {
-		return nil, fmt.Errorf("failed parsing streak prediction for picker '%s', season '%s', week %d: %v", picker.ID, season.ID, week, err)
+		return nil, newError(KindInconsistent, "failed parsing streak prediction for picker '%s', season '%s', week %d: %v", picker.ID, season.ID, week, err)
 	}
 	streakPick := &bpefs.StreakPick{Picks: streakPrediction.BestPick,
 		PredictedProbability: streakPrediction.Probability,
@@ -0,0 +1,153 @@
+package pickem4me
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// testClient makes document references for tests. It never connects to Firestore.
+var testClient = func() *firestore.Client {
+	c, err := firestore.NewClient(context.Background(), "pickem4me-test", option.WithoutAuthentication(),
+		option.WithEndpoint("localhost:1"), option.WithGRPCDialOption(grpc.WithInsecure()))
+	if err != nil {
+		panic(err)
+	}
+	return c
+}()
+
+// teamRef returns a reference to a team document.
+func teamRef(id string) *firestore.DocumentRef {
+	return testClient.Collection("teams").Doc(id)
+}
+
+// restoreModelCriteria restores the criteria for choosing models when a test ends.
+func restoreModelCriteria(t *testing.T) {
+	modelCriteriaMu.RLock()
+	saved := make(map[string]modelCriterion, len(modelCriteria))
+	for gameType, c := range modelCriteria {
+		saved[gameType] = c
+	}
+	modelCriteriaMu.RUnlock()
+	t.Cleanup(func() {
+		modelCriteriaMu.Lock()
+		defer modelCriteriaMu.Unlock()
+		modelCriteria = saved
+	})
+}
+
+func TestSetModelCriterion(t *testing.T) {
+	restoreModelCriteria(t)
+	tests := []struct {
+		gameType   string
+		metric     string
+		descending bool
+		want       modelCriterion
+		wantErr    bool
+	}{
+		{"StraightUp", "mae", false, modelCriterion{"mae", firestore.Asc}, false},
+		{"Superdog", "suw", true, modelCriterion{"suw", firestore.Desc}, false},
+		{"Streak", "mae", false, modelCriterion{}, true},
+		{"NoisySpread", "luck", false, modelCriterion{"mae", firestore.Asc}, true},
+	}
+	for _, tt := range tests {
+		err := SetModelCriterion(tt.gameType, tt.metric, tt.descending)
+		if tt.wantErr {
+			if KindOf(err) != KindInvalidInput {
+				t.Errorf("SetModelCriterion(%s, %s): expected invalid input, got %v", tt.gameType, tt.metric, err)
+			}
+		} else if err != nil {
+			t.Errorf("SetModelCriterion(%s, %s): %v", tt.gameType, tt.metric, err)
+		}
+		if got, _ := criterionFor(tt.gameType); got != tt.want {
+			t.Errorf("%s: expected criterion %+v, got %+v", tt.gameType, tt.want, got)
+		}
+	}
+}
+
+func TestSetModelCriterionConcurrent(t *testing.T) {
+	restoreModelCriteria(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if err := SetModelCriterion("StraightUp", ModelMetrics()[i%len(ModelMetrics())], i%2 == 0); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, ok := criterionFor("StraightUp"); !ok {
+				t.Error("expected a criterion for straight-up picks")
+			}
+			modelSelection("StraightUp", "")
+		}()
+	}
+	wg.Wait()
+}
+
+func TestModelLookup(t *testing.T) {
+	teams := NewTeamResolver()
+	for _, t := range []struct{ id, school string }{{"iowa", "Iowa"}, {"purdue", "Purdue"}, {"illinois", "Illinois"}} {
+		teams.AddTeam(teamRef(t.id), bpefs.Team{School: t.school})
+	}
+	pred := func(home, road string) bpefs.Prediction {
+		return bpefs.Prediction{HomeTeam: teamRef(home), AwayTeam: teamRef(road)}
+	}
+	preds := []bpefs.Prediction{
+		pred("iowa", "purdue"),
+		pred("Illinois", "wisconsin"), // named by school rather than by ID
+		pred("minnesota", "nebraska"), // a doubleheader
+		pred("nebraska", "minnesota"),
+	}
+	refs := make([]*firestore.DocumentRef, len(preds))
+	for i := range preds {
+		refs[i] = testClient.Doc(fmt.Sprintf("predictions/%d", i))
+	}
+	m := NewModel(bpefs.ModelPerformance{System: "line"}, preds, refs, teams)
+
+	tests := []struct {
+		name       string
+		home, road string
+		wantRef    string
+		wantSwap   bool
+		wantErr    string
+	}{
+		{"as predicted", "iowa", "purdue", "predictions/0", false, ""},
+		{"home and road swapped", "purdue", "iowa", "predictions/0", true, ""},
+		{"canonical team", "illinois", "wisconsin", "predictions/1", false, ""},
+		{"duplicate matchup", "minnesota", "nebraska", "", false, "play each other in 2 predicted games: 2, 3"},
+		{"duplicate matchup swapped", "nebraska", "minnesota", "", false, "play each other in 2 predicted games"},
+		{"missing matchup", "iowa", "illinois", "", false, "not playing each other"},
+		{"one team missing", "iowa", "rutgers", "", false, "not playing each other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ref, swap, err := m.Lookup(teamRef(tt.home), teamRef(tt.road))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if p != nil || ref != nil {
+					t.Errorf("expected no prediction, got %+v (%v)", p, ref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+			if refPath(ref) != tt.wantRef || swap != tt.wantSwap {
+				t.Errorf("expected '%s' with swap %t, got '%s' with swap %t", tt.wantRef, tt.wantSwap, refPath(ref), swap)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package pickem4me
+
+import (
+	"fmt"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// computedPick is a pick for a slate game along with the intermediate values used to make it.
+type computedPick struct {
+	// prediction is the prediction the pick was made from.
+	prediction *gamePrediction
+
+	// homeAdjustment is the number of points added to the model's spread (relative to the model's home team) to move home
+	// field advantage to where the reconciled game has it: away from a neutral site, or to the slate's home team if trusted.
+	homeAdjustment float64
+
+	// modelSpread is the adjusted spread relative to the true home team.
+	modelSpread float64
+
+	// target is the noisy spread relative to the true home team.
+	target float64
+
+	// homeProbability is the probability that the true home team beats the target.
+	homeProbability float64
+
+	// Exactly one of the following picks is set.
+	straightUp  *bpefs.StraightUpPick
+	noisySpread *bpefs.NoisySpreadPick
+	superdog    *bpefs.SuperDogPick
+
+	// reconciliations are the disagreements between the slate and the model about the game.
+	reconciliations []Reconciliation
+}
+
+// computePick picks a slate game using a prediction, reconciling disagreements between the slate and the prediction by policy.
+// Teams are named in reconciliations using the team resolver.
+// Superdog games are never picked here: see PickSet.chooseSuperdog.
+func computePick(game bpefs.Game, gp *gamePrediction, policies reconcilePolicies, teams *TeamResolver) (*computedPick, error) {
+	modelPred, predRef, swap := gp.prediction, gp.ref, gp.swap
+	cp := &computedPick{prediction: gp}
+
+	// Disagreement over home and road?
+	trustSlateHome := false
+	if swap {
+		r := Reconciliation{
+			Row:   game.Row,
+			Kind:  ReconcileHomeAway,
+			Slate: fmt.Sprintf("home team %s", teams.Name(game.HomeTeam)),
+			Model: fmt.Sprintf("home team %s", teams.Name(modelPred.HomeTeam)),
+		}
+		if err := resolve(&r, policies.swap); err != nil {
+			return nil, err
+		}
+		trustSlateHome = r.Policy == TrustSlate
+		cp.reconciliations = append(cp.reconciliations, r)
+	}
+
+	// Disagreement over neutral site?
+	neutralDisagreement := game.NeutralSite != modelPred.NeutralSite
+	neutralSite := modelPred.NeutralSite
+	if neutralDisagreement {
+		r := Reconciliation{
+			Row:   game.Row,
+			Kind:  ReconcileNeutralSite,
+			Slate: neutralString(game.NeutralSite),
+			Model: neutralString(modelPred.NeutralSite),
+		}
+		if err := resolve(&r, policies.neutral); err != nil {
+			return nil, err
+		}
+		if r.Policy == TrustSlate {
+			// Take home field advantage away from the model's home team, or give it to the true home team.
+			if game.NeutralSite {
+				cp.homeAdjustment = -heuristicHomeAdvantage
+			} else if trustSlateHome {
+				cp.homeAdjustment = -heuristicHomeAdvantage
+			} else {
+				cp.homeAdjustment = heuristicHomeAdvantage
+			}
+			neutralSite = game.NeutralSite
+			neutralDisagreement = false
+		}
+		cp.reconciliations = append(cp.reconciliations, r)
+	}
+
+	// Trusting the slate's home team at a site that is not neutral moves home field advantage from the model's home team
+	// to the slate's, which swings the spread by twice the advantage. (A neutral site trusted from the slate has already
+	// given the advantage to the slate's home team above.)
+	if trustSlateHome && !modelPred.NeutralSite && !neutralSite {
+		cp.homeAdjustment = -2 * heuristicHomeAdvantage
+	}
+
+	// The the model spread is always relative to the _correct_ home team (as understood by the model).
+	// That means the target, which is relative to the home team of the slate, might need ot be swapped as well.
+	cp.modelSpread = modelPred.Spread + cp.homeAdjustment
+	spread := cp.modelSpread
+	target := game.NoisySpread
+	if swap {
+		spread *= -1 // "spread" is now relative to the slate home team.
+		target *= -1 // "target" is now relative to the true home team.
+	}
+	cp.target = float64(target)
+	// This is tricky because prob needs to be relative to the true home team.
+	// The model already calculates the spread based on the true home team.
+	// The target (noisy spread) was just flipped if necessary, so it is also relative to the true home team.
+	prob := gp.distribution.CDF(cp.modelSpread - cp.target)
+	cp.homeProbability = prob
+
+	// Update game
+	// Note that the game that is written reflects the slate, not the "truth".
+	// That means home and away teams and spreads might need to be swapped later.
+	if game.Superdog {
+		// The probability is always relative to the true home team.
+		// The "underdog" and "overdog" is parsed from the slate. They are taken to be correct as-is.
+		// The way that superdogs are parsed means the underdog is always considered the away team in the slate.
+		// So from the game's point of view, prob is the probability that the overdog wins.
+		// That means the probability has to be inverted for display purposes (unless the home team actually is the underdog, in which case we are okay).
+		if !swap {
+			prob = 1 - prob
+		} else {
+			// ...but it also means that the spread has to be set back to the original value. Ugh.
+			spread *= -1
+		}
+		cp.superdog = &bpefs.SuperDogPick{
+			Underdog:             game.Underdog,
+			Overdog:              game.Overdog,
+			UnderdogRank:         game.AwayRank,
+			OverdogRank:          game.HomeRank,
+			Value:                game.Value,
+			NeutralSite:          neutralSite,
+			NeutralDisagreement:  neutralDisagreement,
+			HomeAwaySwap:         swap && !trustSlateHome,
+			Pick:                 nil, // hold off on picking superdogs
+			PredictedSpread:      spread,
+			PredictedProbability: prob,
+			ModeledGame:          predRef,
+			Row:                  game.Row,
+		}
+		return cp, nil
+	}
+
+	pick := modelPred.HomeTeam
+	if prob < 0.5 {
+		pick = modelPred.AwayTeam
+	}
+	home, away := modelPred.HomeTeam, modelPred.AwayTeam
+	if trustSlateHome {
+		// Write the game as the slate has it: probability and spread relative to the slate home team.
+		home, away = game.HomeTeam, game.AwayTeam
+		prob = 1 - prob
+		swap = false
+	}
+	if game.NoisySpread != 0 {
+		cp.noisySpread = &bpefs.NoisySpreadPick{
+			HomeTeam:             home,
+			AwayTeam:             away,
+			AwayRank:             game.AwayRank,
+			HomeRank:             game.HomeRank,
+			NoisySpread:          game.NoisySpread,
+			NeutralSite:          neutralSite,
+			NeutralDisagreement:  neutralDisagreement,
+			HomeAwaySwap:         swap,
+			Pick:                 pick,
+			PredictedSpread:      spread,
+			PredictedProbability: prob,
+			ModeledGame:          predRef,
+			Row:                  game.Row,
+		}
+		return cp, nil
+	}
+	cp.straightUp = &bpefs.StraightUpPick{
+		HomeTeam:             home,
+		AwayTeam:             away,
+		AwayRank:             game.AwayRank,
+		HomeRank:             game.HomeRank,
+		GOTW:                 game.GOTW,
+		NeutralSite:          neutralSite,
+		NeutralDisagreement:  neutralDisagreement,
+		HomeAwaySwap:         swap,
+		Pick:                 pick,
+		PredictedSpread:      spread,
+		PredictedProbability: prob,
+		ModeledGame:          predRef,
+		Row:                  game.Row,
+	}
+	return cp, nil
+}
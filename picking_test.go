@@ -0,0 +1,199 @@
+package pickem4me
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/stat/distuv"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+func TestComputePick(t *testing.T) {
+	const h = heuristicHomeAdvantage
+	dist := distuv.Normal{Mu: 0, Sigma: 10}
+
+	// The slate has Michigan at Iowa unless the game is swapped, in which case it has Iowa at Michigan.
+	// The model always has Michigan at Iowa.
+	game := func(noisySpread int, neutral, swapped bool) bpefs.Game {
+		g := bpefs.Game{Row: 1, HomeTeam: teamRef("iowa"), AwayTeam: teamRef("michigan"), NoisySpread: noisySpread, NeutralSite: neutral}
+		if swapped {
+			g.HomeTeam, g.AwayTeam = g.AwayTeam, g.HomeTeam
+		}
+		return g
+	}
+	prediction := func(spread float64, neutral, swapped bool) *gamePrediction {
+		return &gamePrediction{
+			prediction:   &bpefs.Prediction{HomeTeam: teamRef("iowa"), AwayTeam: teamRef("michigan"), Spread: spread, NeutralSite: neutral},
+			swap:         swapped,
+			distribution: dist,
+		}
+	}
+
+	tests := []struct {
+		name            string
+		game            bpefs.Game
+		prediction      *gamePrediction
+		swapPolicy      string
+		neutralPolicy   string
+		wantAdjustment  float64
+		wantHome        string
+		wantPick        string
+		wantProbability float64 // of the home team as written
+		wantSwap        bool
+		reconciliations int
+		wantErr         ErrorKind
+	}{
+		{
+			name: "agreement", game: game(0, false, false), prediction: prediction(7, false, false),
+			wantHome: "iowa", wantPick: "iowa", wantProbability: dist.CDF(7),
+		},
+		{
+			name: "noisy spread", game: game(10, false, false), prediction: prediction(7, false, false),
+			wantHome: "iowa", wantPick: "michigan", wantProbability: dist.CDF(-3),
+		},
+		{
+			name: "swap trusting model", game: game(0, false, true), prediction: prediction(3, false, true),
+			wantHome: "iowa", wantPick: "iowa", wantProbability: dist.CDF(3), wantSwap: true, reconciliations: 1,
+		},
+		{
+			name: "swap trusting slate moves home field advantage", game: game(0, false, true), prediction: prediction(3, false, true),
+			swapPolicy:     TrustSlate,
+			wantAdjustment: -2 * h, wantHome: "michigan", wantPick: "michigan", wantProbability: 1 - dist.CDF(3-2*h), reconciliations: 1,
+		},
+		{
+			name: "swap trusting slate with noisy spread", game: game(-4, false, true), prediction: prediction(3, false, true),
+			swapPolicy: TrustSlate,
+			// Iowa (the slate's road team) is favored by 4: Iowa must win by more than 4 to cover.
+			wantAdjustment: -2 * h, wantHome: "michigan", wantPick: "michigan", wantProbability: 1 - dist.CDF(3-2*h-4), reconciliations: 1,
+		},
+		{
+			name: "swap trusting slate at a neutral site", game: game(0, true, true), prediction: prediction(3, true, true),
+			swapPolicy: TrustSlate,
+			wantHome:   "michigan", wantPick: "iowa", wantProbability: 1 - dist.CDF(3), reconciliations: 1,
+		},
+		{
+			name: "neutral site trusting model", game: game(0, true, false), prediction: prediction(1, false, false),
+			wantHome: "iowa", wantPick: "iowa", wantProbability: dist.CDF(1), reconciliations: 1,
+		},
+		{
+			name: "neutral site trusting slate", game: game(0, true, false), prediction: prediction(1, false, false),
+			neutralPolicy:  TrustSlate,
+			wantAdjustment: -h, wantHome: "iowa", wantPick: "michigan", wantProbability: dist.CDF(1 - h), reconciliations: 1,
+		},
+		{
+			name: "home site trusting slate", game: game(0, false, false), prediction: prediction(-1, true, false),
+			neutralPolicy:  TrustSlate,
+			wantAdjustment: h, wantHome: "iowa", wantPick: "iowa", wantProbability: dist.CDF(-1 + h), reconciliations: 1,
+		},
+		{
+			name: "home site trusting slate and model home", game: game(0, false, true), prediction: prediction(-1, true, true),
+			neutralPolicy:  TrustSlate,
+			wantAdjustment: h, wantHome: "iowa", wantPick: "iowa", wantProbability: dist.CDF(-1 + h), wantSwap: true, reconciliations: 2,
+		},
+		{
+			name: "home site trusting slate and slate home", game: game(0, false, true), prediction: prediction(-1, true, true),
+			swapPolicy: TrustSlate, neutralPolicy: TrustSlate,
+			wantAdjustment: -h, wantHome: "michigan", wantPick: "michigan", wantProbability: 1 - dist.CDF(-1-h), reconciliations: 2,
+		},
+		{
+			name: "swap fails", game: game(0, false, true), prediction: prediction(3, false, true),
+			swapPolicy: FailOnDisagreement, wantErr: KindInconsistent,
+		},
+		{
+			name: "neutral site fails", game: game(0, true, false), prediction: prediction(3, false, false),
+			neutralPolicy: FailOnDisagreement, wantErr: KindInconsistent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := newReconcilePolicies(tt.swapPolicy, tt.neutralPolicy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cp, err := computePick(tt.game, tt.prediction, policies, NewTeamResolver())
+			if tt.wantErr != KindUnknown {
+				if KindOf(err) != tt.wantErr {
+					t.Fatalf("expected %s error, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("computePick: %v", err)
+			}
+			if cp.homeAdjustment != tt.wantAdjustment {
+				t.Errorf("expected home adjustment %.1f, got %.1f", tt.wantAdjustment, cp.homeAdjustment)
+			}
+			if len(cp.reconciliations) != tt.reconciliations {
+				t.Errorf("expected %d reconciliations, got %v", tt.reconciliations, cp.reconciliations)
+			}
+			var home, pick string
+			var prob float64
+			var swap bool
+			if cp.noisySpread != nil {
+				home, pick, prob, swap = cp.noisySpread.HomeTeam.ID, cp.noisySpread.Pick.ID, cp.noisySpread.PredictedProbability, cp.noisySpread.HomeAwaySwap
+			} else {
+				home, pick, prob, swap = cp.straightUp.HomeTeam.ID, cp.straightUp.Pick.ID, cp.straightUp.PredictedProbability, cp.straightUp.HomeAwaySwap
+			}
+			if home != tt.wantHome || pick != tt.wantPick || swap != tt.wantSwap {
+				t.Errorf("expected home %s, pick %s, swap %t: got home %s, pick %s, swap %t", tt.wantHome, tt.wantPick, tt.wantSwap, home, pick, swap)
+			}
+			if math.Abs(prob-tt.wantProbability) > 1e-9 {
+				t.Errorf("expected probability %.4f, got %.4f", tt.wantProbability, prob)
+			}
+		})
+	}
+}
+
+func TestComputePickSuperdog(t *testing.T) {
+	dist := distuv.Normal{Mu: 0, Sigma: 10}
+	game := bpefs.Game{Row: 6, HomeTeam: teamRef("indiana"), AwayTeam: teamRef("purdue"), Superdog: true, Overdog: teamRef("indiana"), Underdog: teamRef("purdue"), Value: 10}
+	tests := []struct {
+		name     string
+		pred     *bpefs.Prediction
+		swap     bool
+		wantProb float64
+	}{
+		{"underdog on the road", &bpefs.Prediction{HomeTeam: teamRef("indiana"), AwayTeam: teamRef("purdue"), Spread: 7}, false, 1 - dist.CDF(7)},
+		{"underdog at home", &bpefs.Prediction{HomeTeam: teamRef("purdue"), AwayTeam: teamRef("indiana"), Spread: -7}, true, dist.CDF(-7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp, err := computePick(game, &gamePrediction{prediction: tt.pred, swap: tt.swap, distribution: dist}, reconcilePolicies{TrustModel, TrustModel}, NewTeamResolver())
+			if err != nil {
+				t.Fatalf("computePick: %v", err)
+			}
+			if cp.superdog == nil || cp.superdog.Pick != nil {
+				t.Fatalf("expected an unpicked superdog, got %+v", cp.superdog)
+			}
+			if math.Abs(cp.superdog.PredictedProbability-tt.wantProb) > 1e-9 {
+				t.Errorf("expected underdog probability %.4f, got %.4f", tt.wantProb, cp.superdog.PredictedProbability)
+			}
+		})
+	}
+}
+
+func TestNewReconcilePolicies(t *testing.T) {
+	tests := []struct {
+		swap, neutral         string
+		wantSwap, wantNeutral string
+		wantErr               bool
+	}{
+		{"", "", TrustModel, TrustModel, false},
+		{TrustSlate, FailOnDisagreement, TrustSlate, FailOnDisagreement, false},
+		{"trust_luke", "", "", "", true},
+		{"", "maybe", "", "", true},
+	}
+	for _, tt := range tests {
+		p, err := newReconcilePolicies(tt.swap, tt.neutral)
+		if tt.wantErr {
+			if KindOf(err) != KindInvalidInput {
+				t.Errorf("newReconcilePolicies(%q, %q): expected invalid input, got %v", tt.swap, tt.neutral, err)
+			}
+			continue
+		}
+		if err != nil || p.swap != tt.wantSwap || p.neutral != tt.wantNeutral {
+			t.Errorf("newReconcilePolicies(%q, %q): got %+v, %v", tt.swap, tt.neutral, p, err)
+		}
+	}
+}
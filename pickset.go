@@ -0,0 +1,162 @@
+package pickem4me
+
+import (
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// PickSet is the complete set of picks made for a picker on a slate.
+type PickSet struct {
+	// Ref is a reference to the picks document in which the picks were stored (nil if the picks were not stored).
+	Ref *firestore.DocumentRef
+
+	// Slate is a reference to the slate that was picked.
+	Slate *firestore.DocumentRef
+
+	// Season is a reference to the season of the slate.
+	Season *firestore.DocumentRef
+
+	// Week is the week of the slate.
+	Week int
+
+	// Picker is a reference to the picker for whom the picks were made.
+	Picker *firestore.DocumentRef
+
+	// StraightUp are the straight-up picks.
+	StraightUp []*bpefs.StraightUpPick
+
+	// NoisySpread are the noisy spread picks.
+	NoisySpread []*bpefs.NoisySpreadPick
+
+	// Superdog are the superdog games, with at most one of them picked.
+	Superdog []*bpefs.SuperDogPick
+
+	// Streak is the beat the streak pick (nil if the picker has no streak pick this week).
+	Streak *bpefs.StreakPick
+
+	// Locked are the slate rows of games that had already started when the picks were made.
+	Locked map[int]bool
+
+	// Fallbacks describe how games that could not be picked with the chosen models were picked, keyed by slate row.
+	Fallbacks map[int]string
+
+	// Reconciliations are the disagreements between the slate and the models, and how they were resolved.
+	Reconciliations []Reconciliation
+
+	// Notes are additional notes on the picks, keyed by slate row.
+	Notes map[int][]string
+
+	// StreakNotes are additional notes on the streak pick.
+	StreakNotes []string
+
+	// Overrides are the picks changed by hand from what the models picked.
+	Overrides []Override
+}
+
+// annotate adds a note to the pick in the given slate row.
+func (ps *PickSet) annotate(row int, note string) {
+	if ps.Notes == nil {
+		ps.Notes = make(map[int][]string)
+	}
+	ps.Notes[row] = append(ps.Notes[row], note)
+}
+
+// chooseSuperdog picks the unlocked superdog with the greatest expected value.
+// If a locked superdog has already been picked, that pick stands and no other superdog is picked.
+func (ps *PickSet) chooseSuperdog() {
+	for _, sd := range ps.Superdog {
+		if ps.Locked[sd.Row] && sd.Pick != nil {
+			return
+		}
+	}
+	var best *bpefs.SuperDogPick
+	var bestValue float64
+	for _, sd := range ps.Superdog {
+		if ps.Locked[sd.Row] {
+			continue
+		}
+		sd.Pick = nil
+		ev := sd.PredictedProbability * float64(sd.Value)
+		if ev > bestValue {
+			best = sd
+			bestValue = ev
+		}
+	}
+	if best != nil {
+		best.Pick = best.Underdog
+	}
+}
+
+// lockedRows returns the locked slate rows in ascending order.
+func (ps *PickSet) lockedRows() []int {
+	rows := make([]int, 0, len(ps.Locked))
+	for row, locked := range ps.Locked {
+		if locked {
+			rows = append(rows, row)
+		}
+	}
+	sort.Ints(rows)
+	return rows
+}
+
+// fallbackRows returns the slate rows of fallback picks in ascending order.
+func (ps *PickSet) fallbackRows() []int {
+	rows := make([]int, 0, len(ps.Fallbacks))
+	for row := range ps.Fallbacks {
+		rows = append(rows, row)
+	}
+	sort.Ints(rows)
+	return rows
+}
+
+// fallbackRecords returns the fallback picks in the form stored in the picks document.
+func (ps *PickSet) fallbackRecords() []fallbackRecord {
+	rows := ps.fallbackRows()
+	records := make([]fallbackRecord, len(rows))
+	for i, row := range rows {
+		records[i] = fallbackRecord{Row: row, Source: ps.Fallbacks[row]}
+	}
+	return records
+}
+
+// picksDocument is the picks document written to Firestore.
+// It extends bpefs.Picks with details about how the picks were made.
+type picksDocument struct {
+	bpefs.Picks
+
+	// Slate is a reference to the slate that was picked.
+	Slate *firestore.DocumentRef `firestore:"slate,omitempty"`
+
+	// LockedRows are the slate rows of games that had already started when the picks were made.
+	LockedRows []int `firestore:"locked_rows,omitempty"`
+
+	// Fallbacks are the picks that were made without the chosen models.
+	Fallbacks []fallbackRecord `firestore:"fallbacks,omitempty"`
+
+	// Reconciliations are the disagreements between the slate and the models, and how they were resolved.
+	Reconciliations []Reconciliation `firestore:"reconciliations,omitempty"`
+
+	// RepickOf is a reference to the picks document whose picks of locked games were kept (nil if these are not repicks).
+	RepickOf *firestore.DocumentRef `firestore:"repick_of,omitempty"`
+
+	// Run is a reference to the record of the run that made the picks.
+	Run *firestore.DocumentRef `firestore:"run,omitempty"`
+
+	// Overrides are the picks changed by hand from what the models picked.
+	Overrides []Override `firestore:"overrides,omitempty"`
+}
+
+// refPath returns the path of a document relative to the database root, or an empty string if the reference is nil.
+func refPath(ref *firestore.DocumentRef) string {
+	if ref == nil {
+		return ""
+	}
+	if i := strings.Index(ref.Path, "/documents/"); i >= 0 {
+		return ref.Path[i+len("/documents/"):]
+	}
+	return ref.Path
+}
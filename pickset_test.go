@@ -0,0 +1,56 @@
+package pickem4me
+
+import (
+	"testing"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+func TestChooseSuperdog(t *testing.T) {
+	type dog struct {
+		row    int
+		value  int
+		prob   float64
+		picked bool
+	}
+	tests := []struct {
+		name   string
+		dogs   []dog
+		locked map[int]bool
+		want   int // row of the picked superdog, or 0 for none
+	}{
+		{"greatest expected value", []dog{{6, 10, 0.15, false}, {7, 5, 0.4, false}, {8, 20, 0.05, false}}, nil, 7},
+		{"value beats probability", []dog{{6, 20, 0.15, false}, {7, 5, 0.4, false}}, nil, 6},
+		{"previous pick cleared", []dog{{6, 10, 0.1, true}, {7, 10, 0.3, false}}, nil, 7},
+		{"locked pick stands", []dog{{6, 10, 0.1, true}, {7, 10, 0.3, false}}, map[int]bool{6: true}, 6},
+		{"locked unpicked skipped", []dog{{6, 10, 0.3, false}, {7, 10, 0.1, false}}, map[int]bool{6: true}, 7},
+		{"no chance", []dog{{6, 10, 0, false}}, nil, 0},
+		{"no superdogs", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := &PickSet{Locked: tt.locked}
+			for _, d := range tt.dogs {
+				sd := &bpefs.SuperDogPick{Row: d.row, Value: d.value, PredictedProbability: d.prob, Underdog: teamRef("underdog"), Overdog: teamRef("overdog")}
+				if d.picked {
+					sd.Pick = sd.Underdog
+				}
+				ps.Superdog = append(ps.Superdog, sd)
+			}
+			ps.chooseSuperdog()
+			got := 0
+			for _, sd := range ps.Superdog {
+				if sd.Pick == nil {
+					continue
+				}
+				if got != 0 {
+					t.Fatalf("expected one superdog picked, got rows %d and %d", got, sd.Row)
+				}
+				got = sd.Row
+			}
+			if got != tt.want {
+				t.Errorf("expected superdog in row %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
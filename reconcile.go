@@ -0,0 +1,99 @@
+package pickem4me
+
+import (
+	"fmt"
+)
+
+// Kinds of reconciliation between the slate and the model.
+const (
+	// ReconcileHomeAway is a game for which the slate and the model disagree about which team is at home.
+	ReconcileHomeAway = "home_away_swap"
+
+	// ReconcileNeutralSite is a game for which the slate and the model disagree about whether it is played at a neutral site.
+	ReconcileNeutralSite = "neutral_site"
+)
+
+// Resolution policies for reconciliations.
+const (
+	// TrustModel resolves a disagreement in favor of the model (the default).
+	TrustModel = "trust_model"
+
+	// TrustSlate resolves a disagreement in favor of the slate.
+	TrustSlate = "trust_slate"
+
+	// FailOnDisagreement refuses to pick a slate with the disagreement.
+	FailOnDisagreement = "fail"
+)
+
+// Reconciliation is a disagreement between the slate and the model about a game, and how it was resolved.
+type Reconciliation struct {
+	// Row is the slate row of the game.
+	Row int `firestore:"row" json:"row"`
+
+	// Kind is the kind of disagreement: "home_away_swap" or "neutral_site".
+	Kind string `firestore:"kind" json:"kind"`
+
+	// Slate is what the slate says.
+	Slate string `firestore:"slate" json:"slate"`
+
+	// Model is what the model says.
+	Model string `firestore:"model" json:"model"`
+
+	// Policy is the resolution policy that was applied: "trust_model" or "trust_slate".
+	Policy string `firestore:"policy" json:"policy"`
+}
+
+// String describes the reconciliation for logs and notes.
+func (r Reconciliation) String() string {
+	var what string
+	switch r.Kind {
+	case ReconcileHomeAway:
+		what = "home and road teams"
+	case ReconcileNeutralSite:
+		what = "neutral site"
+	default:
+		what = r.Kind
+	}
+	trusted := "model"
+	if r.Policy == TrustSlate {
+		trusted = "slate"
+	}
+	return fmt.Sprintf("Slate (%s) and model (%s) disagree about the %s: trusting the %s.", r.Slate, r.Model, what, trusted)
+}
+
+// reconcilePolicies are the resolution policies to apply to each kind of reconciliation.
+type reconcilePolicies struct {
+	swap    string
+	neutral string
+}
+
+// newReconcilePolicies checks the given policies, replacing empty policies with the default.
+func newReconcilePolicies(swap, neutral string) (reconcilePolicies, error) {
+	p := reconcilePolicies{swap: swap, neutral: neutral}
+	for _, policy := range []*string{&p.swap, &p.neutral} {
+		switch *policy {
+		case "":
+			*policy = TrustModel
+		case TrustModel, TrustSlate, FailOnDisagreement:
+		default:
+			return p, newError(KindInvalidInput, "unknown reconciliation policy '%s'", *policy)
+		}
+	}
+	return p, nil
+}
+
+// resolve applies the policy to a reconciliation, returning an error if the policy is to fail.
+func resolve(r *Reconciliation, policy string) error {
+	if policy == FailOnDisagreement {
+		return newError(KindInconsistent, "row %d: slate (%s) and model (%s) disagree (%s)", r.Row, r.Slate, r.Model, r.Kind)
+	}
+	r.Policy = policy
+	return nil
+}
+
+func neutralString(neutral bool) string {
+	if neutral {
+		return "neutral site"
+	}
+	return "home site"
+}
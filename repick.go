@@ -0,0 +1,160 @@
+package pickem4me
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// previousPicks are the picks stored in an existing picks document, keyed by slate row.
+type previousPicks struct {
+	ref         *firestore.DocumentRef
+	straightUp  map[int]*bpefs.StraightUpPick
+	noisySpread map[int]*bpefs.NoisySpreadPick
+	superdog    map[int]*bpefs.SuperDogPick
+	streak      *bpefs.StreakPick
+}
+
+// loadPreviousPicks loads the most recent picks made for a picker from a given slate.
+// Picks made from other slates of the same week are not considered.
+// It returns nil if the picker has no picks from the slate.
+func loadPreviousPicks(ctx context.Context, picker, slate *firestore.DocumentRef) (*previousPicks, error) {
+	picksDoc, err := fsclient.Collection("picks").Where("picker", "==", picker).Where("slate", "==", slate).OrderBy("timestamp", firestore.Desc).Limit(1).Documents(ctx).Next()
+	if err == iterator.Done {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, backendError(err, "failed getting picks for picker '%s' from slate '%s'", picker.ID, refPath(slate))
+	}
+	return readPicks(ctx, picksDoc)
+}
+
+// readPicks reads the picks stored in a picks document.
+func readPicks(ctx context.Context, picksDoc *firestore.DocumentSnapshot) (*previousPicks, error) {
+	prev := &previousPicks{
+		ref:         picksDoc.Ref,
+		straightUp:  make(map[int]*bpefs.StraightUpPick),
+		noisySpread: make(map[int]*bpefs.NoisySpreadPick),
+		superdog:    make(map[int]*bpefs.SuperDogPick),
+	}
+
+	docs, err := picksDoc.Ref.Collection("straight_up").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, backendError(err, "failed getting straight-up picks from '%s'", picksDoc.Ref.ID)
+	}
+	for _, doc := range docs {
+		var pick bpefs.StraightUpPick
+		if err := doc.DataTo(&pick); err != nil {
+			return nil, newError(KindInconsistent, "failed parsing straight-up pick '%s': %v", doc.Ref.ID, err)
+		}
+		prev.straightUp[pick.Row] = &pick
+	}
+
+	docs, err = picksDoc.Ref.Collection("noisy_spread").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, backendError(err, "failed getting noisy spread picks from '%s'", picksDoc.Ref.ID)
+	}
+	for _, doc := range docs {
+		var pick bpefs.NoisySpreadPick
+		if err := doc.DataTo(&pick); err != nil {
+			return nil, newError(KindInconsistent, "failed parsing noisy spread pick '%s': %v", doc.Ref.ID, err)
+		}
+		prev.noisySpread[pick.Row] = &pick
+	}
+
+	docs, err = picksDoc.Ref.Collection("superdog").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, backendError(err, "failed getting superdog picks from '%s'", picksDoc.Ref.ID)
+	}
+	for _, doc := range docs {
+		var pick bpefs.SuperDogPick
+		if err := doc.DataTo(&pick); err != nil {
+			return nil, newError(KindInconsistent, "failed parsing superdog pick '%s': %v", doc.Ref.ID, err)
+		}
+		prev.superdog[pick.Row] = &pick
+	}
+
+	docs, err = picksDoc.Ref.Collection("streak").Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, backendError(err, "failed getting streak pick from '%s'", picksDoc.Ref.ID)
+	}
+	for _, doc := range docs {
+		var pick bpefs.StreakPick
+		if err := doc.DataTo(&pick); err != nil {
+			return nil, newError(KindInconsistent, "failed parsing streak pick '%s': %v", doc.Ref.ID, err)
+		}
+		prev.streak = &pick
+	}
+
+	return prev, nil
+}
+
+// keepLocked replaces the picks of locked games with the previous picks of those games.
+// A previous pick is kept only if it is of the same teams as the game now in its row.
+// If any of the teams in the previous streak pick play in a locked game, the previous streak pick is kept as well.
+func (ps *PickSet) keepLocked(ctx context.Context, prev *previousPicks) {
+	const kept = "LOCKED:  Kept the pick that was already made."
+	lockedTeams := make(map[string]bool)
+
+	for i, pick := range ps.StraightUp {
+		if !ps.Locked[pick.Row] {
+			continue
+		}
+		lockedTeams[pick.HomeTeam.ID] = true
+		lockedTeams[pick.AwayTeam.ID] = true
+		if p, ok := prev.straightUp[pick.Row]; ok && sameGame(ctx, pick.Row, p.HomeTeam, p.AwayTeam, pick.HomeTeam, pick.AwayTeam) {
+			delete(ps.Fallbacks, pick.Row)
+			ps.StraightUp[i] = p
+			ps.annotate(pick.Row, kept)
+		}
+	}
+	for i, pick := range ps.NoisySpread {
+		if !ps.Locked[pick.Row] {
+			continue
+		}
+		lockedTeams[pick.HomeTeam.ID] = true
+		lockedTeams[pick.AwayTeam.ID] = true
+		if p, ok := prev.noisySpread[pick.Row]; ok && sameGame(ctx, pick.Row, p.HomeTeam, p.AwayTeam, pick.HomeTeam, pick.AwayTeam) {
+			delete(ps.Fallbacks, pick.Row)
+			ps.NoisySpread[i] = p
+			ps.annotate(pick.Row, kept)
+		}
+	}
+	for i, pick := range ps.Superdog {
+		if !ps.Locked[pick.Row] {
+			continue
+		}
+		lockedTeams[pick.Underdog.ID] = true
+		lockedTeams[pick.Overdog.ID] = true
+		if p, ok := prev.superdog[pick.Row]; ok && sameGame(ctx, pick.Row, p.Underdog, p.Overdog, pick.Underdog, pick.Overdog) {
+			delete(ps.Fallbacks, pick.Row)
+			ps.Superdog[i] = p
+			ps.annotate(pick.Row, kept)
+		}
+	}
+
+	if prev.streak == nil {
+		return
+	}
+	for _, team := range prev.streak.Picks {
+		if lockedTeams[team.ID] {
+			logFrom(ctx).Infof("Streak pick includes team '%s' in a locked game: keeping previous streak pick", team.ID)
+			ps.Streak = prev.streak
+			return
+		}
+	}
+}
+
+// sameGame reports whether a previous pick in a row was of the same two teams as the game now in the row, in either order.
+// A previous pick of a different game is logged so that the locked row is not silently repicked.
+func sameGame(ctx context.Context, row int, prev1, prev2, team1, team2 *firestore.DocumentRef) bool {
+	p1, p2, t1, t2 := refPath(prev1), refPath(prev2), refPath(team1), refPath(team2)
+	if (p1 == t1 && p2 == t2) || (p1 == t2 && p2 == t1) {
+		return true
+	}
+	logFrom(ctx).Warnf("Previous pick in row %d was of '%s' and '%s', not '%s' and '%s': not keeping it", row, p1, p2, t1, t2)
+	return false
+}
@@ -0,0 +1,102 @@
+package pickem4me
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+func TestKeepLocked(t *testing.T) {
+	su := func(row int, home, road, pick string) *bpefs.StraightUpPick {
+		return &bpefs.StraightUpPick{Row: row, HomeTeam: teamRef(home), AwayTeam: teamRef(road), Pick: teamRef(pick)}
+	}
+	ns := func(row int, home, road, pick string) *bpefs.NoisySpreadPick {
+		return &bpefs.NoisySpreadPick{Row: row, HomeTeam: teamRef(home), AwayTeam: teamRef(road), Pick: teamRef(pick), NoisySpread: 7}
+	}
+	sd := func(row int, under, over string, picked bool) *bpefs.SuperDogPick {
+		p := &bpefs.SuperDogPick{Row: row, Underdog: teamRef(under), Overdog: teamRef(over), Value: 10}
+		if picked {
+			p.Pick = p.Underdog
+		}
+		return p
+	}
+	streak := func(teams ...string) *bpefs.StreakPick {
+		s := &bpefs.StreakPick{}
+		for _, team := range teams {
+			s.Picks = append(s.Picks, teamRef(team))
+		}
+		return s
+	}
+
+	tests := []struct {
+		name       string
+		prevStreak *bpefs.StreakPick
+		wantStreak string
+	}{
+		{"streak team played", streak("michigan"), "teams/michigan"},
+		{"streak team in a locked superdog game", streak("purdue"), "teams/purdue"},
+		{"streak team not played", streak("ohio-state"), "teams/wisconsin"},
+		{"no previous streak", nil, "teams/wisconsin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := &PickSet{
+				StraightUp:  []*bpefs.StraightUpPick{su(1, "iowa", "michigan", "iowa"), su(2, "ohio-state", "penn-state", "ohio-state")},
+				NoisySpread: []*bpefs.NoisySpreadPick{ns(3, "wisconsin", "minnesota", "minnesota"), ns(4, "nebraska", "rutgers", "nebraska")},
+				Superdog:    []*bpefs.SuperDogPick{sd(6, "purdue", "indiana", false), sd(7, "illinois", "maryland", true)},
+				Streak:      streak("wisconsin"),
+				Locked:      map[int]bool{1: true, 3: true, 6: true},
+				Fallbacks:   map[int]string{1: "heuristic", 2: "heuristic"},
+			}
+			prev := &previousPicks{
+				straightUp: map[int]*bpefs.StraightUpPick{
+					1: su(1, "iowa", "michigan", "michigan"),
+					2: su(2, "ohio-state", "penn-state", "penn-state"),
+				},
+				noisySpread: map[int]*bpefs.NoisySpreadPick{3: ns(3, "nebraska", "rutgers", "rutgers")},
+				superdog:    map[int]*bpefs.SuperDogPick{6: sd(6, "purdue", "indiana", true)},
+				streak:      tt.prevStreak,
+			}
+			ps.keepLocked(context.Background(), prev)
+
+			picks := map[int]*firestore.DocumentRef{}
+			for _, p := range ps.StraightUp {
+				picks[p.Row] = p.Pick
+			}
+			for _, p := range ps.NoisySpread {
+				picks[p.Row] = p.Pick
+			}
+			for _, p := range ps.Superdog {
+				picks[p.Row] = p.Pick
+			}
+			want := map[int]string{
+				1: "michigan",   // locked: kept
+				2: "ohio-state", // not locked: repicked
+				3: "minnesota",  // locked, but previously a different game
+				4: "nebraska",
+				6: "purdue", // locked: kept
+				7: "illinois",
+			}
+			for row, team := range want {
+				if picks[row] == nil || picks[row].ID != team {
+					t.Errorf("row %d: expected pick '%s', got %v", row, team, picks[row])
+				}
+			}
+			if _, ok := ps.Fallbacks[1]; ok {
+				t.Errorf("expected fallback of kept row 1 to be removed")
+			}
+			if _, ok := ps.Fallbacks[2]; !ok {
+				t.Errorf("expected fallback of repicked row 2 to stay")
+			}
+			if len(ps.Notes[1]) != 1 || len(ps.Notes[6]) != 1 || len(ps.Notes[3]) != 0 {
+				t.Errorf("expected notes on kept rows 1 and 6 only, got %v", ps.Notes)
+			}
+			if got := streakTeams(ps); got != tt.wantStreak {
+				t.Errorf("expected streak pick '%s', got '%s'", tt.wantStreak, got)
+			}
+		})
+	}
+}
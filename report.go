@@ -0,0 +1,245 @@
+package pickem4me
+
+import (
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/template"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// report is a human-readable summary of a pick set.
+type report struct {
+	Week     int
+	Games    []reportGame
+	Dogs     []reportDog
+	Streak   *reportStreak
+	Warnings []string
+}
+
+// reportGame is a straight-up or noisy spread game in a report.
+type reportGame struct {
+	Row         int
+	Game        string
+	Instruction string
+	Pick        string
+	Confidence  float64
+	Spread      string
+	Notes       []string
+}
+
+// reportDog is a superdog game in a report.
+type reportDog struct {
+	Row         int
+	Game        string
+	Value       int
+	Probability float64
+	EV          float64
+	Picked      bool
+	Notes       []string
+}
+
+// reportStreak is the beat the streak pick in a report.
+type reportStreak struct {
+	Pick        string
+	Spread      string
+	Probability float64
+}
+
+// newReport builds a report from a pick set, looking up team names as necessary.
+func newReport(ctx context.Context, ps *PickSet) (*report, error) {
+	r := &report{Week: ps.Week}
+
+	addGame := func(pick bpefs.SlateRowBuilder, row int, prob float64) error {
+		out, err := pick.BuildSlateRow(ctx)
+		if err != nil {
+			return fmt.Errorf("failed making report row %d: %v", row, err)
+		}
+		g := reportGame{
+			Row:         row,
+			Game:        out[0],
+			Instruction: out[1],
+			Pick:        out[2],
+			Confidence:  prob,
+			Spread:      out[3],
+		}
+		if out[4] != "" {
+			g.Notes = strings.Split(out[4], "\n")
+		}
+		g.Notes = append(g.Notes, ps.Notes[row]...)
+		r.Games = append(r.Games, g)
+		return nil
+	}
+
+	for _, p := range ps.StraightUp {
+		if err := addGame(p, p.Row, pickProbability(p.Pick, p.HomeTeam, p.PredictedProbability)); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range ps.NoisySpread {
+		if err := addGame(p, p.Row, pickProbability(p.Pick, p.HomeTeam, p.PredictedProbability)); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(r.Games, func(i, j int) bool { return r.Games[i].Row < r.Games[j].Row })
+
+	for _, p := range ps.Superdog {
+		out, err := p.BuildSlateRow(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed making report row %d: %v", p.Row, err)
+		}
+		r.Dogs = append(r.Dogs, reportDog{
+			Row:         p.Row,
+			Game:        out[0],
+			Value:       p.Value,
+			Probability: p.PredictedProbability,
+			EV:          float64(p.Value) * p.PredictedProbability,
+			Picked:      p.Pick != nil,
+			Notes:       ps.Notes[p.Row],
+		})
+	}
+	sort.SliceStable(r.Dogs, func(i, j int) bool { return r.Dogs[i].EV > r.Dogs[j].EV })
+
+	if ps.Streak != nil {
+		out, err := ps.Streak.BuildSlateRow(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed making report streak: %v", err)
+		}
+		r.Streak = &reportStreak{
+			Pick:        out[2],
+			Spread:      out[3],
+			Probability: ps.Streak.PredictedProbability,
+		}
+	}
+
+	for _, rec := range ps.Reconciliations {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Row %d: %s", rec.Row, rec))
+	}
+	return r, nil
+}
+
+// confidenceBar draws a probability as a ten-segment bar.
+func confidenceBar(p float64) string {
+	n := int(math.Round(p * 10))
+	if n < 0 {
+		n = 0
+	} else if n > 10 {
+		n = 10
+	}
+	return strings.Repeat("█", n) + strings.Repeat("░", 10-n)
+}
+
+func percent(p float64) string {
+	return fmt.Sprintf("%.0f%%", p*100)
+}
+
+// markdownCell escapes text for a cell of a Markdown table, in which a pipe ends the cell and a newline ends the row.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// markdownCells escapes lines of text and joins them into one cell of a Markdown table.
+func markdownCells(lines []string) string {
+	cells := make([]string, len(lines))
+	for i, line := range lines {
+		cells[i] = markdownCell(line)
+	}
+	return strings.Join(cells, "<br>")
+}
+
+var reportFuncs = map[string]interface{}{
+	"bar":     confidenceBar,
+	"percent": percent,
+	"cell":    markdownCell,
+	"cells":   markdownCells,
+}
+
+const markdownReport = `# Week {{.Week}} picks
+{{if .Warnings}}
+## Warnings
+{{range .Warnings}}
+- {{.}}{{end}}
+{{end}}
+## Games
+
+| Row | Game | Pick | Confidence | Spread | Notes |
+| ---: | --- | --- | --- | ---: | --- |
+{{range .Games}}| {{.Row}} | {{cell .Game}}{{if .Instruction}} ({{cell .Instruction}}){{end}} | **{{cell .Pick}}** | {{bar .Confidence}} {{percent .Confidence}} | {{cell .Spread}} | {{cells .Notes}} |
+{{end}}
+## Superdogs
+
+| Row | Game | Value | Win probability | EV | Notes |
+| ---: | --- | ---: | ---: | ---: | --- |
+{{range .Dogs}}| {{.Row}} | {{if .Picked}}**{{cell .Game}}** (picked){{else}}{{cell .Game}}{{end}} | {{.Value}} | {{percent .Probability}} | {{printf "%.3f" .EV}} | {{cells .Notes}} |
+{{end}}
+## Beat the Streak
+{{if .Streak}}
+**{{.Streak.Pick}}** (spread {{.Streak.Spread}}, {{percent .Streak.Probability}} to beat the streak)
+{{else}}
+No streak pick this week.
+{{end}}`
+
+const htmlReport = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Week {{.Week}} picks</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em; text-align: left; vertical-align: top; }
+.bar { font-family: monospace; white-space: nowrap; }
+.warning { color: #a00; }
+.picked { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Week {{.Week}} picks</h1>
+{{if .Warnings}}<h2>Warnings</h2>
+<ul>
+{{range .Warnings}}<li class="warning">{{.}}</li>
+{{end}}</ul>
+{{end}}<h2>Games</h2>
+<table>
+<tr><th>Row</th><th>Game</th><th>Pick</th><th>Confidence</th><th>Spread</th><th>Notes</th></tr>
+{{range .Games}}<tr><td>{{.Row}}</td><td>{{.Game}}{{if .Instruction}}<br>{{.Instruction}}{{end}}</td><td class="picked">{{.Pick}}</td><td class="bar">{{bar .Confidence}} {{percent .Confidence}}</td><td>{{.Spread}}</td><td>{{range .Notes}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+<h2>Superdogs</h2>
+<table>
+<tr><th>Row</th><th>Game</th><th>Value</th><th>Win probability</th><th>EV</th><th>Notes</th></tr>
+{{range .Dogs}}<tr{{if .Picked}} class="picked"{{end}}><td>{{.Row}}</td><td>{{.Game}}{{if .Picked}} (picked){{end}}</td><td>{{.Value}}</td><td>{{percent .Probability}}</td><td>{{printf "%.3f" .EV}}</td><td>{{range .Notes}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+<h2>Beat the Streak</h2>
+{{if .Streak}}<p><b>{{.Streak.Pick}}</b> (spread {{.Streak.Spread}}, {{percent .Streak.Probability}} to beat the streak)</p>
+{{else}}<p>No streak pick this week.</p>
+{{end}}</body>
+</html>
+`
+
+var markdownTemplate = template.Must(template.New("markdown").Funcs(reportFuncs).Parse(markdownReport))
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(reportFuncs).Parse(htmlReport))
+
+// writeMarkdown writes a Markdown summary of the pick set.
+func writeMarkdown(ctx context.Context, w io.Writer, ps *PickSet) error {
+	r, err := newReport(ctx, ps)
+	if err != nil {
+		return err
+	}
+	return markdownTemplate.Execute(w, r)
+}
+
+// writeHTML writes an HTML summary of the pick set.
+func writeHTML(ctx context.Context, w io.Writer, ps *PickSet) error {
+	r, err := newReport(ctx, ps)
+	if err != nil {
+		return err
+	}
+	return htmlTemplate.Execute(w, r)
+}
@@ -0,0 +1,81 @@
+package pickem4me
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// nopCloser is a buffer that can be closed and aborted.
+type nopCloser struct {
+	bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+func (nopCloser) Abort()       {}
+
+func TestWriteOutputsDefaultFormats(t *testing.T) {
+	var exts []string
+	err := writeOutputs(context.Background(), &PickSet{Week: 3}, nil, func(ext, _ string) (output, error) {
+		exts = append(exts, ext)
+		return &nopCloser{}, nil
+	})
+	if err != nil {
+		t.Fatalf("writeOutputs: %v", err)
+	}
+	if want := []string{"xlsx", "md", "html"}; !reflect.DeepEqual(exts, want) {
+		t.Errorf("expected formats %v, got %v", want, exts)
+	}
+}
+
+func TestMarkdownCell(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Iowa @ Michigan", "Iowa @ Michigan"},
+		{"A|B", `A\|B`},
+		{"one\ntwo", "one<br>two"},
+		{"|\n|", `\|<br>\|`},
+	}
+	for _, tt := range tests {
+		if got := markdownCell(tt.in); got != tt.want {
+			t.Errorf("markdownCell(%q): expected %q, got %q", tt.in, tt.want, got)
+		}
+	}
+	if got, want := markdownCells([]string{"a|b", "c"}), `a\|b<br>c`; got != want {
+		t.Errorf("markdownCells: expected %q, got %q", want, got)
+	}
+}
+
+func TestMarkdownReportEscapesCells(t *testing.T) {
+	r := &report{
+		Week: 4,
+		Games: []reportGame{{
+			Row:        1,
+			Game:       "Iowa | Ames @ Michigan",
+			Pick:       "Hawk|eyes",
+			Confidence: 0.7,
+			Spread:     "3.5",
+			Notes:      []string{"RECONCILED:  a | b", "second"},
+		}},
+		Dogs: []reportDog{{Row: 6, Game: "Purdue | over Indiana", Value: 10, Probability: 0.2, EV: 2, Picked: true}},
+	}
+	var buf bytes.Buffer
+	if err := markdownTemplate.Execute(&buf, r); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if !strings.HasPrefix(line, "| 1 |") && !strings.HasPrefix(line, "| 6 |") {
+			continue
+		}
+		// Every row of the tables has exactly seven unescaped pipes.
+		if n := strings.Count(line, "|") - strings.Count(line, `\|`); n != 7 {
+			t.Errorf("expected 7 cell separators in row %q, got %d", line, n)
+		}
+	}
+	if !strings.Contains(buf.String(), `RECONCILED:  a \| b<br>second`) {
+		t.Errorf("expected escaped notes in report:\n%s", buf.String())
+	}
+}
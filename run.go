@@ -0,0 +1,224 @@
+package pickem4me
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Run outcomes.
+const (
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+)
+
+// runRecordTimeout is how long writing a run record may take, even if the run itself was cancelled.
+const runRecordTimeout = 10 * time.Second
+
+// runModel records a model used in a run.
+type runModel struct {
+	// Performance is a reference to the model performance document.
+	Performance *firestore.DocumentRef `firestore:"performance"`
+
+	// Model is a reference to the model itself.
+	Model *firestore.DocumentRef `firestore:"model"`
+
+	// System is the name of the model.
+	System string `firestore:"system"`
+
+	// Selection describes how the model was chosen.
+	Selection string `firestore:"selection"`
+
+	// Bias and StdDev are the parameters of the distribution of the model's errors.
+	Bias   float64 `firestore:"bias"`
+	StdDev float64 `firestore:"std_dev"`
+
+	// Predictions is the number of predictions the model made.
+	Predictions int `firestore:"predictions"`
+}
+
+// runRecord is the audit record of one run, stored in the runs collection under the run ID.
+// It is safe for concurrent use.
+type runRecord struct {
+	mu sync.Mutex
+
+	// RunID is the ID of the run.
+	RunID string `firestore:"run_id"`
+
+	// Message is the message that requested the run, as JSON fields.
+	Message map[string]interface{} `firestore:"message"`
+
+	// DryRun is set if nothing was stored.
+	DryRun bool `firestore:"dry_run"`
+
+	// Tracker is a reference to the prediction tracker the models were chosen from.
+	Tracker *firestore.DocumentRef `firestore:"tracker"`
+
+	// Models are the models used, keyed by game type.
+	Models map[string]runModel `firestore:"models"`
+
+	// Started and Finished are when the run started and finished.
+	Started  time.Time `firestore:"started"`
+	Finished time.Time `firestore:"finished"`
+
+	// Timings are the durations of the phases of the run in seconds, keyed by phase.
+	Timings map[string]float64 `firestore:"timings"`
+
+	// Warnings are the warnings logged during the run.
+	Warnings []string `firestore:"warnings"`
+
+	// Outputs are the locations of the outputs that were written.
+	Outputs []string `firestore:"outputs"`
+
+	// Picks is a reference to the picks document (nil if no picks were stored).
+	Picks *firestore.DocumentRef `firestore:"picks"`
+
+	// Outcome is "completed" or "failed".
+	Outcome string `firestore:"outcome"`
+
+	// Error and ErrorKind describe why the run failed.
+	Error     string `firestore:"error,omitempty"`
+	ErrorKind string `firestore:"error_kind,omitempty"`
+}
+
+// newRunRecord starts the record of a run.
+func newRunRecord(id string, pem PickEmMessage) *runRecord {
+	r := &runRecord{
+		RunID:   id,
+		DryRun:  pem.DryRun,
+		Models:  make(map[string]runModel),
+		Started: now(),
+		Timings: make(map[string]float64),
+	}
+	// Store the message as it was sent, with JSON field names.
+	if b, err := json.Marshal(pem); err == nil {
+		json.Unmarshal(b, &r.Message)
+	}
+	return r
+}
+
+// runRecordKey is the context key of the record of a run.
+type runRecordKey struct{}
+
+// runFrom returns the record of the run carried by a context, or nil if there is none.
+// Every method of a nil record does nothing.
+func runFrom(ctx context.Context) *runRecord {
+	r, _ := ctx.Value(runRecordKey{}).(*runRecord)
+	return r
+}
+
+// runRef returns a reference to the run document of a run, or nil if there is no run or no Firestore client.
+func runRef(r *runRecord) *firestore.DocumentRef {
+	if r == nil || fsclient == nil {
+		return nil
+	}
+	return fsclient.Collection("runs").Doc(r.RunID)
+}
+
+// phase starts timing a phase of the run. Call the returned function when the phase is done.
+func (r *runRecord) phase(name string) func() {
+	start := now()
+	return func() {
+		if r == nil {
+			return
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.Timings[name] += now().Sub(start).Seconds()
+	}
+}
+
+// warn records a warning.
+func (r *runRecord) warn(msg string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Warnings = append(r.Warnings, msg)
+}
+
+// output records the location of an output.
+func (r *runRecord) output(location string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Outputs = append(r.Outputs, location)
+}
+
+// useModels records the models chosen for each game type, and how they were chosen.
+func (r *runRecord) useModels(docs map[string]*firestore.DocumentSnapshot, models map[string]*Model, paths map[string]string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for gameType, doc := range docs {
+		rm := runModel{
+			Performance: doc.Ref,
+			Selection:   modelSelection(gameType, paths[gameType]),
+		}
+		if m, ok := models[gameType]; ok {
+			rm.Model = m.Performance.Model
+			rm.System = m.Performance.System
+			rm.Bias = m.Distribution.Mu
+			rm.StdDev = m.Distribution.Sigma
+			rm.Predictions = len(m.Predictions)
+		}
+		r.Models[gameType] = rm
+		r.Tracker = doc.Ref.Parent.Parent
+	}
+}
+
+// modelSelection describes how the model for a game type is chosen given the requested path.
+func modelSelection(gameType, path string) string {
+	if path != "" {
+		return "requested " + path
+	}
+	c, _ := criterionFor(gameType)
+	dir := "ascending"
+	if c.dir == firestore.Desc {
+		dir = "descending"
+	}
+	return fmt.Sprintf("best by %s (%s)", c.orderBy, dir)
+}
+
+// finish records the outcome of the run and stores the record.
+// The record is not stored if there is no Firestore client, and failures to store it are logged but otherwise ignored.
+func (r *runRecord) finish(ctx context.Context, ps *PickSet, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.Finished = now()
+	r.Timings["total"] = r.Finished.Sub(r.Started).Seconds()
+	r.Outcome = RunCompleted
+	if err != nil {
+		r.Outcome = RunFailed
+		r.Error = err.Error()
+		r.ErrorKind = KindOf(err).String()
+	}
+	if ps != nil {
+		r.Picks = ps.Ref
+	}
+	r.mu.Unlock()
+
+	if err := connected(); err != nil {
+		logFrom(ctx).Warnf("Not recording run '%s': %v", r.RunID, err)
+		return
+	}
+	// Record the run even if the run was cancelled.
+	wctx, cancel := context.WithTimeout(context.Background(), runRecordTimeout)
+	defer cancel()
+	if _, err := runRef(r).Set(wctx, r); err != nil {
+		logFrom(ctx).Warnf("Failed recording run: %v", err)
+		return
+	}
+	logFrom(ctx).Infof("Recorded run '%s' (%s)", r.RunID, r.Outcome)
+}
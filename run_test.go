@@ -0,0 +1,59 @@
+package pickem4me
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// recordingPublisher keeps the events it is asked to publish.
+type recordingPublisher struct {
+	events []*CloudEvent
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, ev *CloudEvent) error {
+	p.events = append(p.events, ev)
+	return nil
+}
+
+func TestRunNotConnected(t *testing.T) {
+	oldFS, oldCS, oldPublisher := fsclient, csclient, publisher
+	fsclient, csclient = nil, nil
+	p := &recordingPublisher{}
+	publisher = p
+	t.Cleanup(func() { fsclient, csclient, publisher = oldFS, oldCS, oldPublisher })
+
+	ps, err := Run(context.Background(), PickEmMessage{Slate: "seasons/2021/weeks/5/slates/1", Picker: "LUKE"})
+	if err == nil || !strings.Contains(err.Error(), "not connected") {
+		t.Fatalf("expected a not connected error, got %v", err)
+	}
+	if ps != nil {
+		t.Errorf("expected no picks, got %+v", ps)
+	}
+
+	if len(p.events) != 1 || p.events[0].Type != PicksFailedType {
+		t.Fatalf("expected one picks failed event, got %v", p.events)
+	}
+	var data PicksEventData
+	if err := json.Unmarshal(p.events[0].Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Run != "" {
+		t.Errorf("expected no run document, got '%s'", data.Run)
+	}
+}
+
+func TestRunRefNotConnected(t *testing.T) {
+	old := fsclient
+	fsclient = nil
+	t.Cleanup(func() { fsclient = old })
+
+	if ref := runRef(&runRecord{RunID: "1"}); ref != nil {
+		t.Errorf("expected no reference without a client, got %v", ref)
+	}
+	fsclient = testClient
+	if ref := runRef(&runRecord{RunID: "1"}); refPath(ref) != "runs/1" {
+		t.Errorf("expected 'runs/1', got '%s'", refPath(ref))
+	}
+}
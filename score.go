@@ -0,0 +1,63 @@
+package pickem4me
+
+import (
+	"math"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Score is the number of points a pick set is expected to score according to the predicted probabilities of its picks.
+// Every straight-up and noisy spread game picked correctly scores one point, except the game of the week, which scores
+// two. The picked superdog scores its value if the underdog wins. The streak pick does not score.
+type Score struct {
+	// Expected is the expected number of points.
+	Expected float64 `json:"expected"`
+
+	// StdDev is the standard deviation of the number of points, treating games as independent.
+	StdDev float64 `json:"stdDev"`
+
+	// Max is the number of points scored if every pick is correct.
+	Max int `json:"max"`
+}
+
+// ExpectedScore computes the expected score of a pick set.
+func ExpectedScore(ps *PickSet) Score {
+	var s Score
+	var variance float64
+	add := func(points int, p float64) {
+		v := float64(points)
+		s.Expected += v * p
+		variance += v * v * p * (1 - p)
+		s.Max += points
+	}
+	for _, p := range ps.StraightUp {
+		points := 1
+		if p.GOTW {
+			points = 2
+		}
+		add(points, pickProbability(p.Pick, p.HomeTeam, p.PredictedProbability))
+	}
+	for _, p := range ps.NoisySpread {
+		add(1, pickProbability(p.Pick, p.HomeTeam, p.PredictedProbability))
+	}
+	for _, p := range ps.Superdog {
+		if p.Pick != nil {
+			add(p.Value, p.PredictedProbability)
+		}
+	}
+	s.StdDev = math.Sqrt(variance)
+	return s
+}
+
+// pickProbability returns the probability that a pick is correct, given the probability that the home team wins.
+// A nil pick is never correct.
+func pickProbability(pick, home *firestore.DocumentRef, homeProbability float64) float64 {
+	switch {
+	case pick == nil:
+		return 0
+	case refPath(pick) == refPath(home):
+		return homeProbability
+	default:
+		return 1 - homeProbability
+	}
+}
@@ -0,0 +1,56 @@
+package pickem4me
+
+import (
+	"math"
+	"testing"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+func TestExpectedScore(t *testing.T) {
+	su := func(pick string, p float64, gotw bool) *bpefs.StraightUpPick {
+		g := &bpefs.StraightUpPick{HomeTeam: teamRef("iowa"), AwayTeam: teamRef("michigan"), PredictedProbability: p, GOTW: gotw}
+		if pick != "" {
+			g.Pick = teamRef(pick)
+		}
+		return g
+	}
+	tests := []struct {
+		name         string
+		ps           *PickSet
+		wantExpected float64
+		wantVariance float64
+		wantMax      int
+	}{
+		{"no picks", &PickSet{}, 0, 0, 0},
+		{"home pick", &PickSet{StraightUp: []*bpefs.StraightUpPick{su("iowa", 0.7, false)}}, 0.7, 0.21, 1},
+		{"road pick", &PickSet{StraightUp: []*bpefs.StraightUpPick{su("michigan", 0.7, false)}}, 0.3, 0.21, 1},
+		{"game of the week", &PickSet{StraightUp: []*bpefs.StraightUpPick{su("iowa", 0.7, true)}}, 1.4, 0.84, 2},
+		{"unpicked game", &PickSet{StraightUp: []*bpefs.StraightUpPick{su("", 0.7, false)}}, 0, 0, 1},
+		{"noisy spread", &PickSet{NoisySpread: []*bpefs.NoisySpreadPick{
+			{HomeTeam: teamRef("wisconsin"), AwayTeam: teamRef("minnesota"), Pick: teamRef("minnesota"), PredictedProbability: 0.4},
+		}}, 0.6, 0.24, 1},
+		{"superdogs", &PickSet{Superdog: []*bpefs.SuperDogPick{
+			{Underdog: teamRef("purdue"), Pick: teamRef("purdue"), Value: 10, PredictedProbability: 0.3},
+			{Underdog: teamRef("illinois"), Value: 12, PredictedProbability: 0.2},
+		}}, 3, 21, 10},
+		{"everything", &PickSet{
+			StraightUp: []*bpefs.StraightUpPick{su("iowa", 0.7, true), su("michigan", 0.7, false)},
+			Superdog:   []*bpefs.SuperDogPick{{Underdog: teamRef("purdue"), Pick: teamRef("purdue"), Value: 10, PredictedProbability: 0.3}},
+		}, 4.7, 22.05, 13},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := ExpectedScore(tt.ps)
+			if math.Abs(s.Expected-tt.wantExpected) > 1e-9 {
+				t.Errorf("expected %g points, got %g", tt.wantExpected, s.Expected)
+			}
+			if math.Abs(s.StdDev-math.Sqrt(tt.wantVariance)) > 1e-9 {
+				t.Errorf("expected standard deviation %g, got %g", math.Sqrt(tt.wantVariance), s.StdDev)
+			}
+			if s.Max != tt.wantMax {
+				t.Errorf("expected at most %d points, got %d", tt.wantMax, s.Max)
+			}
+		})
+	}
+}
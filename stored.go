@@ -0,0 +1,99 @@
+package pickem4me
+
+import (
+	"context"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// LoadPicks loads the pick set stored in a picks document, given its path (e.g. "picks/abc123").
+func LoadPicks(ctx context.Context, path string) (*PickSet, error) {
+	if err := connected(); err != nil {
+		return nil, err
+	}
+	if !validDocPath(path) {
+		return nil, newError(KindInvalidInput, "'%s' is not a document path", path)
+	}
+	doc, err := fsclient.Doc(path).Get(ctx)
+	if err != nil {
+		return nil, backendError(err, "failed getting picks '%s'", path)
+	}
+	return storedPickSet(ctx, doc)
+}
+
+// LatestPicks loads the pick set most recently stored for a picker (by Luke name) on a slate.
+// It fails with a not found error if the picker has no picks for the week of the slate.
+func LatestPicks(ctx context.Context, picker, slatePath string) (*PickSet, error) {
+	if err := connected(); err != nil {
+		return nil, err
+	}
+	ls, err := loadSlate(ctx, slatePath)
+	if err != nil {
+		return nil, err
+	}
+	lp, err := loadPicker(ctx, picker)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := fsclient.Collection("picks").Where("picker", "==", lp.doc.Ref).Where("season", "==", ls.slate.Season).Where("week", "==", ls.slate.Week).OrderBy("timestamp", firestore.Desc).Limit(1).Documents(ctx).Next()
+	if err == iterator.Done {
+		return nil, newError(KindNotFound, "picker '%s' has no picks for week %d", picker, ls.slate.Week)
+	}
+	if err != nil {
+		return nil, backendError(err, "failed getting picks for picker '%s'", picker)
+	}
+	ps, err := storedPickSet(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	if ps.Slate == nil {
+		ps.Slate = ls.doc.Ref
+	}
+	return ps, nil
+}
+
+// storedPickSet reads a picks document and its picks into a pick set.
+func storedPickSet(ctx context.Context, doc *firestore.DocumentSnapshot) (*PickSet, error) {
+	var pd picksDocument
+	if err := doc.DataTo(&pd); err != nil {
+		return nil, newError(KindInconsistent, "failed parsing picks '%s': %v", doc.Ref.ID, err)
+	}
+	prev, err := readPicks(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &PickSet{
+		Ref:             doc.Ref,
+		Slate:           pd.Slate,
+		Season:          pd.Season,
+		Week:            pd.Week,
+		Picker:          pd.Picker,
+		Streak:          prev.streak,
+		Locked:          make(map[int]bool),
+		Fallbacks:       make(map[int]string),
+		Reconciliations: pd.Reconciliations,
+		Overrides:       pd.Overrides,
+	}
+	for _, row := range pd.LockedRows {
+		ps.Locked[row] = true
+	}
+	for _, f := range pd.Fallbacks {
+		ps.Fallbacks[f.Row] = f.Source
+	}
+	for _, p := range prev.straightUp {
+		ps.StraightUp = append(ps.StraightUp, p)
+	}
+	for _, p := range prev.noisySpread {
+		ps.NoisySpread = append(ps.NoisySpread, p)
+	}
+	for _, p := range prev.superdog {
+		ps.Superdog = append(ps.Superdog, p)
+	}
+	sort.Slice(ps.StraightUp, func(i, j int) bool { return ps.StraightUp[i].Row < ps.StraightUp[j].Row })
+	sort.Slice(ps.NoisySpread, func(i, j int) bool { return ps.NoisySpread[i].Row < ps.NoisySpread[j].Row })
+	sort.Slice(ps.Superdog, func(i, j int) bool { return ps.Superdog[i].Row < ps.Superdog[j].Row })
+	return ps, nil
+}
@@ -0,0 +1,211 @@
+package pickem4me
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// teamAlias is an entry in the team_aliases collection, mapping alternate names and document IDs to a canonical team.
+type teamAlias struct {
+	// Team is a reference to the canonical team document.
+	Team *firestore.DocumentRef `firestore:"team"`
+
+	// Names are alternate names or abbreviations of the team.
+	Names []string `firestore:"names"`
+
+	// IDs are alternate document IDs of the team.
+	IDs []string `firestore:"ids"`
+}
+
+// TeamResolver maps the names, abbreviations, and document IDs by which teams are known to canonical team documents.
+// It is safe for concurrent use.
+type TeamResolver struct {
+	// mu guards everything below: teams and aliases may be added while names are resolved.
+	mu         sync.RWMutex
+	teams      map[string]bpefs.Team
+	refs       map[string]*firestore.DocumentRef
+	aliases    map[string]string
+	unresolved map[string]bool
+}
+
+// NewTeamResolver makes an empty team resolver.
+func NewTeamResolver() *TeamResolver {
+	return &TeamResolver{
+		teams:      make(map[string]bpefs.Team),
+		refs:       make(map[string]*firestore.DocumentRef),
+		aliases:    make(map[string]string),
+		unresolved: make(map[string]bool),
+	}
+}
+
+// LoadTeamResolver loads every team from the teams collection and every alias from the team_aliases collection.
+// Teams are known by their document IDs, short names, Luke names, other names, and school names.
+func LoadTeamResolver(ctx context.Context) (*TeamResolver, error) {
+	r := NewTeamResolver()
+
+	teamDocs, err := fsclient.Collection("teams").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, backendError(err, "failed getting teams")
+	}
+	for _, doc := range teamDocs {
+		var team bpefs.Team
+		if err := doc.DataTo(&team); err != nil {
+			return nil, newError(KindInconsistent, "failed parsing team '%s': %v", doc.Ref.ID, err)
+		}
+		r.AddTeam(doc.Ref, team)
+	}
+
+	aliasDocs, err := fsclient.Collection("team_aliases").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, backendError(err, "failed getting team aliases")
+	}
+	for _, doc := range aliasDocs {
+		var alias teamAlias
+		if err := doc.DataTo(&alias); err != nil {
+			return nil, newError(KindInconsistent, "failed parsing team alias '%s': %v", doc.Ref.ID, err)
+		}
+		if alias.Team == nil {
+			logFrom(ctx).Warnf("Team alias '%s' has no team: ignoring", doc.Ref.ID)
+			continue
+		}
+		for _, name := range append(alias.Names, alias.IDs...) {
+			if err := r.AddAlias(name, alias.Team.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	r.mu.RLock()
+	logFrom(ctx).Infof("Loaded %d teams and %d aliases", len(r.refs), len(r.aliases))
+	r.mu.RUnlock()
+	return r, nil
+}
+
+// AddTeam adds a canonical team, known by its document ID and all of its names.
+func (r *TeamResolver) AddTeam(ref *firestore.DocumentRef, team bpefs.Team) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refs[ref.ID] = ref
+	r.teams[ref.ID] = team
+	names := []string{team.Name4, team.School}
+	names = append(names, team.LukeNames...)
+	names = append(names, team.OtherNames...)
+	for _, name := range names {
+		key := normalizeTeamName(name)
+		if key == "" {
+			continue
+		}
+		if id, ok := r.aliases[key]; ok && id != ref.ID {
+			logger.Warnf("Team name '%s' is ambiguous between '%s' and '%s': keeping '%s'", name, id, ref.ID, id)
+			continue
+		}
+		r.aliases[key] = ref.ID
+	}
+}
+
+// AddAlias adds an alternate name, abbreviation, or document ID for a canonical team.
+func (r *TeamResolver) AddAlias(alias, teamID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.refs[teamID]; !ok {
+		return newError(KindInvalidInput, "alias '%s' refers to unknown team '%s'", alias, teamID)
+	}
+	r.aliases[normalizeTeamName(alias)] = teamID
+	return nil
+}
+
+// ResolveName returns the canonical team known by the given name, abbreviation, or document ID.
+// Names that cannot be resolved are remembered and reported by Unresolved.
+func (r *TeamResolver) ResolveName(name string) (*firestore.DocumentRef, bool) {
+	r.mu.RLock()
+	ref, ok := r.refs[name]
+	if !ok {
+		if id, found := r.aliases[normalizeTeamName(name)]; found {
+			ref, ok = r.refs[id], true
+		}
+	}
+	r.mu.RUnlock()
+	if ok {
+		return ref, true
+	}
+	r.mu.Lock()
+	r.unresolved[name] = true
+	r.mu.Unlock()
+	return nil, false
+}
+
+// Resolve returns the canonical team for a team reference, or the reference itself if it cannot be resolved.
+// A nil resolver resolves every reference to itself.
+func (r *TeamResolver) Resolve(ref *firestore.DocumentRef) *firestore.DocumentRef {
+	if r == nil || ref == nil {
+		return ref
+	}
+	if canonical, ok := r.ResolveName(ref.ID); ok {
+		return canonical
+	}
+	return ref
+}
+
+// ID returns the document ID of the canonical team for a team reference.
+func (r *TeamResolver) ID(ref *firestore.DocumentRef) string {
+	return r.Resolve(ref).ID
+}
+
+// Team returns the team data of a canonical team reference.
+func (r *TeamResolver) Team(ref *firestore.DocumentRef) (bpefs.Team, bool) {
+	if r == nil || ref == nil {
+		return bpefs.Team{}, false
+	}
+	id := r.ID(ref)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	team, ok := r.teams[id]
+	return team, ok
+}
+
+// Name returns a human-readable name for a team reference: the school name if known, otherwise the document ID.
+func (r *TeamResolver) Name(ref *firestore.DocumentRef) string {
+	if team, ok := r.Team(ref); ok && team.School != "" {
+		return team.School
+	}
+	if ref == nil {
+		return ""
+	}
+	return ref.ID
+}
+
+// Unresolved returns the names that could not be resolved, sorted.
+func (r *TeamResolver) Unresolved() []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.unresolved))
+	for name := range r.unresolved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveGame replaces the team references of a slate game with their canonical teams.
+func (r *TeamResolver) resolveGame(game *bpefs.Game) {
+	game.HomeTeam = r.Resolve(game.HomeTeam)
+	game.AwayTeam = r.Resolve(game.AwayTeam)
+	game.Overdog = r.Resolve(game.Overdog)
+	game.Underdog = r.Resolve(game.Underdog)
+}
+
+// normalizeTeamName makes a name comparable regardless of case, punctuation, and spacing.
+// For example, "Ok. St." and "OK ST" are the same name.
+func normalizeTeamName(name string) string {
+	name = strings.ToUpper(strings.ReplaceAll(name, ".", " "))
+	return strings.Join(strings.Fields(name), " ")
+}
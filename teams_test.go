@@ -0,0 +1,145 @@
+package pickem4me
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+func TestNormalizeTeamName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Ohio State", "OHIO STATE"},
+		{"Ok. St.", "OK ST"},
+		{"OK ST", "OK ST"},
+		{"  miami   (fl) ", "MIAMI (FL)"},
+		{"...", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeTeamName(tt.in); got != tt.want {
+			t.Errorf("normalizeTeamName(%q): expected %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
+
+// testResolver makes a team resolver with a few teams.
+func testResolver() *TeamResolver {
+	r := NewTeamResolver()
+	r.AddTeam(teamRef("ohio-state"), bpefs.Team{Name4: "OSU", School: "Ohio State", Name: "Buckeyes", LukeNames: []string{"Ohio St."}})
+	r.AddTeam(teamRef("oklahoma-state"), bpefs.Team{Name4: "OKST", School: "Oklahoma State", Name: "Cowboys", OtherNames: []string{"Ok. St.", "OSU"}})
+	r.AddTeam(teamRef("iowa"), bpefs.Team{Name4: "IOWA", School: "Iowa", Name: "Hawkeyes"})
+	return r
+}
+
+func TestTeamResolverResolveName(t *testing.T) {
+	r := testResolver()
+	if err := r.AddAlias("Hawks", "iowa"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddAlias("iowa-hawkeyes", "iowa"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		wantID string
+	}{
+		{"ohio-state", "ohio-state"}, // document ID
+		{"Ohio State", "ohio-state"}, // school
+		{"ohio st", "ohio-state"},    // Luke name, normalized
+		{"OSU", "ohio-state"},        // ambiguous: the first team keeps the name
+		{"ok st", "oklahoma-state"},  // other name
+		{"hawks", "iowa"},            // alias
+		{"iowa-hawkeyes", "iowa"},    // alternate document ID
+		{"Buckeyes", ""},             // nicknames are not names
+		{"Michigan", ""},             // unknown
+	}
+	for _, tt := range tests {
+		ref, ok := r.ResolveName(tt.name)
+		if tt.wantID == "" {
+			if ok {
+				t.Errorf("ResolveName(%q): expected no team, got '%s'", tt.name, ref.ID)
+			}
+			continue
+		}
+		if !ok || ref.ID != tt.wantID {
+			t.Errorf("ResolveName(%q): expected '%s', got %v", tt.name, tt.wantID, ref)
+		}
+	}
+	if got, want := r.Unresolved(), []string{"Buckeyes", "Michigan"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected unresolved %v, got %v", want, got)
+	}
+}
+
+func TestTeamResolverAddAliasUnknownTeam(t *testing.T) {
+	if err := testResolver().AddAlias("Wolverines", "michigan"); KindOf(err) != KindInvalidInput {
+		t.Errorf("expected invalid input, got %v", err)
+	}
+}
+
+func TestTeamResolverResolve(t *testing.T) {
+	r := testResolver()
+	if err := r.AddAlias("iowa-hawkeyes", "iowa"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ref      string
+		wantID   string
+		wantName string
+	}{
+		{"iowa", "iowa", "Iowa"},
+		{"iowa-hawkeyes", "iowa", "Iowa"},
+		{"michigan", "michigan", "michigan"},
+	}
+	for _, tt := range tests {
+		ref := teamRef(tt.ref)
+		if got := r.ID(ref); got != tt.wantID {
+			t.Errorf("ID(%s): expected '%s', got '%s'", tt.ref, tt.wantID, got)
+		}
+		if got := r.Name(ref); got != tt.wantName {
+			t.Errorf("Name(%s): expected '%s', got '%s'", tt.ref, tt.wantName, got)
+		}
+	}
+
+	var nilResolver *TeamResolver
+	if got := nilResolver.Resolve(teamRef("iowa")); got.ID != "iowa" {
+		t.Errorf("nil resolver: expected 'iowa', got '%s'", got.ID)
+	}
+	if got := r.Resolve(nil); got != nil {
+		t.Errorf("expected nil for nil reference, got %v", got)
+	}
+	if got := r.Name(nil); got != "" {
+		t.Errorf("expected no name for nil reference, got '%s'", got)
+	}
+}
+
+func TestTeamResolverConcurrentAliases(t *testing.T) {
+	r := testResolver()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if err := r.AddAlias(fmt.Sprintf("Hawks %d", i), "iowa"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			r.ResolveName(fmt.Sprintf("hawks %d", i))
+			r.Name(teamRef("iowa"))
+			r.Unresolved()
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 8; i++ {
+		if ref, ok := r.ResolveName(fmt.Sprintf("HAWKS %d", i)); !ok || ref.ID != "iowa" {
+			t.Errorf("expected alias %d to resolve to 'iowa', got %v", i, ref)
+		}
+	}
+}
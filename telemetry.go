@@ -0,0 +1,370 @@
+package pickem4me
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Metric names.
+const (
+	// MetricRuns counts runs by outcome and kind of failure.
+	MetricRuns = "pickem4me.runs"
+
+	// MetricRunDuration is the duration of a run in seconds, by outcome.
+	MetricRunDuration = "pickem4me.run.duration"
+
+	// MetricPhaseDuration is the duration of a phase of a run in seconds, by phase.
+	MetricPhaseDuration = "pickem4me.phase.duration"
+
+	// MetricGames counts the games picked by game type.
+	MetricGames = "pickem4me.games"
+
+	// MetricFallbacks counts the games picked without the chosen models, by what picked them instead.
+	MetricFallbacks = "pickem4me.fallbacks"
+
+	// MetricSwaps counts the games with home and road teams reversed between the slate and the model, by policy.
+	MetricSwaps = "pickem4me.swaps"
+)
+
+// Kinds of metric.
+const (
+	// MetricCounter is a count that is summed over the run.
+	MetricCounter = "counter"
+
+	// MetricHistogram is one measurement of a distribution, such as a duration.
+	MetricHistogram = "histogram"
+)
+
+// Span is a timed operation within a run, in the manner of an OpenTelemetry span.
+type Span struct {
+	// TraceID identifies the run. Every span of a run has the same trace ID.
+	TraceID string `json:"trace_id"`
+
+	// SpanID identifies the span.
+	SpanID string `json:"span_id"`
+
+	// ParentID identifies the span that contains this one (empty for the span of the whole run).
+	ParentID string `json:"parent_span_id,omitempty"`
+
+	// Name is the name of the operation.
+	Name string `json:"name"`
+
+	// Start and End are when the operation started and ended.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Attributes describe the operation.
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+
+	// Status is "ok", or "error" if the operation failed.
+	Status string `json:"status"`
+
+	// Error describes why the operation failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Metric is a measurement of a run, in the manner of an OpenTelemetry data point.
+type Metric struct {
+	// Name is the name of the metric, such as "pickem4me.games".
+	Name string `json:"name"`
+
+	// Kind is "counter" or "histogram".
+	Kind string `json:"kind"`
+
+	// Unit is the unit of the value, such as "s" or "{game}".
+	Unit string `json:"unit,omitempty"`
+
+	// Value is the value of the measurement.
+	Value float64 `json:"value"`
+
+	// Attributes distinguish measurements of the same metric.
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// Time is when the measurement was made.
+	Time time.Time `json:"time"`
+}
+
+// TelemetryExporter exports the spans and metrics of a run when the run is done.
+type TelemetryExporter interface {
+	Export(ctx context.Context, spans []Span, metrics []Metric) error
+}
+
+// WriterExporter is an offline exporter that writes each span and metric as a line of JSON,
+// as {"span": {...}} or {"metric": {...}}.
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter makes an exporter that writes spans and metrics to w.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// telemetryLine is one line written by a WriterExporter.
+type telemetryLine struct {
+	Span   *Span   `json:"span,omitempty"`
+	Metric *Metric `json:"metric,omitempty"`
+}
+
+// Export writes spans and metrics.
+func (e *WriterExporter) Export(ctx context.Context, spans []Span, metrics []Metric) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for i := range spans {
+		if err := enc.Encode(telemetryLine{Span: &spans[i]}); err != nil {
+			return fmt.Errorf("failed writing span: %v", err)
+		}
+	}
+	for i := range metrics {
+		if err := enc.Encode(telemetryLine{Metric: &metrics[i]}); err != nil {
+			return fmt.Errorf("failed writing metric: %v", err)
+		}
+	}
+	return nil
+}
+
+// FileExporter is an offline exporter that appends spans and metrics to a file, written as a WriterExporter writes them.
+// The file is opened for each export and closed after it, so that no file is held open between runs.
+type FileExporter struct {
+	mu   sync.Mutex
+	name string
+}
+
+// NewFileExporter makes an exporter that appends spans and metrics to the named file, creating it if necessary.
+func NewFileExporter(name string) *FileExporter {
+	return &FileExporter{name: name}
+}
+
+// Export appends spans and metrics to the file.
+func (e *FileExporter) Export(ctx context.Context, spans []Span, metrics []Metric) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f, err := os.OpenFile(e.name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed opening telemetry file '%s': %v", e.name, err)
+	}
+	if err := NewWriterExporter(f).Export(ctx, spans, metrics); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed closing telemetry file '%s': %v", e.name, err)
+	}
+	return nil
+}
+
+// telemetryExporter exports the spans and metrics of every run (nil means they are not exported).
+var telemetryExporter = exporterFromEnv()
+
+// exporterFromEnv exports to the file given by TELEMETRY_FILE, if any ("-" means standard error, so that telemetry does
+// not mix with the output of the CLI). The file is not opened until telemetry is exported.
+func exporterFromEnv() TelemetryExporter {
+	switch file := os.Getenv("TELEMETRY_FILE"); file {
+	case "":
+		return nil
+	case "-":
+		return NewWriterExporter(os.Stderr)
+	default:
+		return NewFileExporter(file)
+	}
+}
+
+// SetTelemetryExporter replaces the exporter of the spans and metrics of every run.
+func SetTelemetryExporter(e TelemetryExporter) {
+	telemetryExporter = e
+}
+
+// telemetry collects the spans and metrics of one run. It is safe for concurrent use.
+type telemetry struct {
+	mu      sync.Mutex
+	traceID string
+	spans   []Span
+	metrics []Metric
+}
+
+// telemetryKey is the context key of the telemetry of a run, and spanKey of the ID of the current span.
+type (
+	telemetryKey struct{}
+	spanKey      struct{}
+)
+
+// withTelemetry returns a context that collects spans and metrics under the given trace ID.
+func withTelemetry(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, telemetryKey{}, &telemetry{traceID: traceID})
+}
+
+// telemetryFrom returns the telemetry carried by a context, or nil if there is none.
+// Every method of nil telemetry does nothing.
+func telemetryFrom(ctx context.Context) *telemetry {
+	t, _ := ctx.Value(telemetryKey{}).(*telemetry)
+	return t
+}
+
+// count adds n to a counter.
+func (t *telemetry) count(name, unit string, n float64, attrs map[string]string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.metrics {
+		m := &t.metrics[i]
+		if m.Kind == MetricCounter && m.Name == name && sameAttributes(m.Attributes, attrs) {
+			m.Value += n
+			m.Time = now()
+			return
+		}
+	}
+	t.metrics = append(t.metrics, Metric{Name: name, Kind: MetricCounter, Unit: unit, Value: n, Attributes: attrs, Time: now()})
+}
+
+// record adds a measurement to a histogram.
+func (t *telemetry) record(name, unit string, value float64, attrs map[string]string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metrics = append(t.metrics, Metric{Name: name, Kind: MetricHistogram, Unit: unit, Value: value, Attributes: attrs, Time: now()})
+}
+
+func sameAttributes(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// span is a span that has been started but not yet ended.
+type span struct {
+	t *telemetry
+	s Span
+}
+
+// startSpan starts a span within the current span of a context, returning a context in which the new span is current.
+// If the context has no telemetry, the span is nil, and every method of a nil span does nothing.
+func startSpan(ctx context.Context, name string) (context.Context, *span) {
+	t := telemetryFrom(ctx)
+	if t == nil {
+		return ctx, nil
+	}
+	parent, _ := ctx.Value(spanKey{}).(string)
+	sp := &span{t: t, s: Span{
+		TraceID:  t.traceID,
+		SpanID:   newEventID()[:16],
+		ParentID: parent,
+		Name:     name,
+		Start:    now(),
+	}}
+	return context.WithValue(ctx, spanKey{}, sp.s.SpanID), sp
+}
+
+// set sets an attribute of the span.
+func (sp *span) set(key string, value interface{}) {
+	if sp == nil {
+		return
+	}
+	if sp.s.Attributes == nil {
+		sp.s.Attributes = make(map[string]interface{})
+	}
+	sp.s.Attributes[key] = value
+}
+
+// end ends the span, marking it as failed if err is not nil.
+func (sp *span) end(err error) {
+	if sp == nil {
+		return
+	}
+	sp.s.End = now()
+	sp.s.Status = "ok"
+	if err != nil {
+		sp.s.Status = "error"
+		sp.s.Error = err.Error()
+		sp.set("error.kind", KindOf(err).String())
+	}
+	sp.t.mu.Lock()
+	defer sp.t.mu.Unlock()
+	sp.t.spans = append(sp.t.spans, sp.s)
+}
+
+// startPhase starts a span for a main phase of a run. The phase is also timed in the run record and in the phase
+// duration metric. Call the returned function with the error of the phase, if any, when the phase is done.
+func startPhase(ctx context.Context, name string) (context.Context, func(error)) {
+	done := runFrom(ctx).phase(name)
+	ctx, sp := startSpan(ctx, name)
+	return ctx, func(err error) {
+		done()
+		sp.end(err)
+		if sp != nil {
+			sp.t.record(MetricPhaseDuration, "s", sp.s.End.Sub(sp.s.Start).Seconds(), map[string]string{"phase": name})
+		}
+	}
+}
+
+// countPicks records the games picked, fallbacks used, and swaps detected in a pick set.
+func (t *telemetry) countPicks(ps *PickSet) {
+	if t == nil || ps == nil {
+		return
+	}
+	games := []struct {
+		gameType string
+		n        int
+	}{
+		{"StraightUp", len(ps.StraightUp)},
+		{"NoisySpread", len(ps.NoisySpread)},
+		{"Superdog", len(ps.Superdog)},
+	}
+	for _, g := range games {
+		t.count(MetricGames, "{game}", float64(g.n), map[string]string{"game_type": g.gameType})
+	}
+	for _, source := range ps.Fallbacks {
+		t.count(MetricFallbacks, "{game}", 1, map[string]string{"source": source})
+	}
+	for _, r := range ps.Reconciliations {
+		if r.Kind == ReconcileHomeAway {
+			t.count(MetricSwaps, "{game}", 1, map[string]string{"policy": r.Policy})
+		}
+	}
+}
+
+// exportTelemetry ends the span of a run, records the metrics of its outcome, and exports everything collected.
+// Failures to export are logged but otherwise ignored.
+func exportTelemetry(ctx context.Context, root *span, ps *PickSet, err error) {
+	t := telemetryFrom(ctx)
+	if t == nil {
+		return
+	}
+	root.end(err)
+	outcome := map[string]string{"outcome": RunCompleted}
+	if err != nil {
+		outcome = map[string]string{"outcome": RunFailed, "error_kind": KindOf(err).String()}
+	}
+	t.count(MetricRuns, "{run}", 1, outcome)
+	if root != nil {
+		t.record(MetricRunDuration, "s", root.s.End.Sub(root.s.Start).Seconds(), map[string]string{"outcome": outcome["outcome"]})
+	}
+	t.countPicks(ps)
+
+	if telemetryExporter == nil {
+		return
+	}
+	t.mu.Lock()
+	spans := append([]Span(nil), t.spans...)
+	metrics := append([]Metric(nil), t.metrics...)
+	t.mu.Unlock()
+	if err := telemetryExporter.Export(ctx, spans, metrics); err != nil {
+		logFrom(ctx).Warnf("Failed exporting telemetry: %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package pickem4me
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// recordingExporter keeps the spans and metrics it is asked to export.
+type recordingExporter struct {
+	spans   []Span
+	metrics []Metric
+	err     error
+}
+
+func (e *recordingExporter) Export(ctx context.Context, spans []Span, metrics []Metric) error {
+	e.spans = append(e.spans, spans...)
+	e.metrics = append(e.metrics, metrics...)
+	return e.err
+}
+
+// setExporter replaces the telemetry exporter until the test ends.
+func setExporter(t *testing.T, e TelemetryExporter) {
+	old := telemetryExporter
+	SetTelemetryExporter(e)
+	t.Cleanup(func() { SetTelemetryExporter(old) })
+}
+
+// findMetric returns the metric with the given name and attributes, or nil if there is none.
+func findMetric(metrics []Metric, name string, attrs map[string]string) *Metric {
+	for i := range metrics {
+		if metrics[i].Name == name && sameAttributes(metrics[i].Attributes, attrs) {
+			return &metrics[i]
+		}
+	}
+	return nil
+}
+
+func TestTelemetryCount(t *testing.T) {
+	tel := &telemetry{}
+	tel.count(MetricGames, "{game}", 2, map[string]string{"game_type": "StraightUp"})
+	tel.count(MetricGames, "{game}", 3, map[string]string{"game_type": "StraightUp"})
+	tel.count(MetricGames, "{game}", 1, map[string]string{"game_type": "Superdog"})
+	tel.count(MetricFallbacks, "{game}", 1, map[string]string{"game_type": "StraightUp"})
+	tel.record(MetricPhaseDuration, "s", 1.5, map[string]string{"phase": "pick"})
+	tel.record(MetricPhaseDuration, "s", 0.5, map[string]string{"phase": "pick"})
+
+	tests := []struct {
+		name  string
+		attrs map[string]string
+		want  float64
+	}{
+		{MetricGames, map[string]string{"game_type": "StraightUp"}, 5},
+		{MetricGames, map[string]string{"game_type": "Superdog"}, 1},
+		{MetricFallbacks, map[string]string{"game_type": "StraightUp"}, 1},
+	}
+	for _, tt := range tests {
+		m := findMetric(tel.metrics, tt.name, tt.attrs)
+		if m == nil || m.Value != tt.want || m.Kind != MetricCounter {
+			t.Errorf("%s %v: expected a counter of %g, got %+v", tt.name, tt.attrs, tt.want, m)
+		}
+	}
+	if len(tel.metrics) != 5 {
+		t.Errorf("expected 3 counters and 2 histogram measurements, got %+v", tel.metrics)
+	}
+
+	var none *telemetry
+	none.count(MetricGames, "{game}", 1, nil) // does nothing
+	none.record(MetricPhaseDuration, "s", 1, nil)
+}
+
+func TestStartSpanParents(t *testing.T) {
+	ctx := withTelemetry(context.Background(), "trace")
+	rctx, root := startSpan(ctx, "run")
+	cctx, child := startSpan(rctx, "read")
+	_, grandchild := startSpan(cctx, "slate.load")
+	grandchild.end(nil)
+	child.end(nil)
+	_, sibling := startSpan(rctx, "pick")
+	sibling.set("games", 5)
+	sibling.end(errors.New("boom"))
+	root.end(nil)
+
+	spans := telemetryFrom(ctx).spans
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %+v", spans)
+	}
+	byName := make(map[string]Span)
+	for _, s := range spans {
+		if s.TraceID != "trace" {
+			t.Errorf("expected every span in trace 'trace', got %+v", s)
+		}
+		byName[s.Name] = s
+	}
+	tests := []struct {
+		name, parent string
+	}{
+		{"run", ""},
+		{"read", "run"},
+		{"slate.load", "read"},
+		{"pick", "run"},
+	}
+	for _, tt := range tests {
+		want := ""
+		if tt.parent != "" {
+			want = byName[tt.parent].SpanID
+		}
+		if got := byName[tt.name].ParentID; got != want {
+			t.Errorf("%s: expected parent '%s' (%s), got '%s'", tt.name, tt.parent, want, got)
+		}
+	}
+	if s := byName["pick"]; s.Status != "error" || s.Error != "boom" || s.Attributes["games"] != 5 {
+		t.Errorf("expected a failed pick span with 5 games, got %+v", s)
+	}
+
+	// Without telemetry, spans do nothing.
+	nctx, sp := startSpan(context.Background(), "run")
+	if sp != nil || nctx != context.Background() {
+		t.Errorf("expected no span without telemetry, got %+v", sp)
+	}
+	sp.set("games", 1)
+	sp.end(nil)
+}
+
+func TestExportTelemetry(t *testing.T) {
+	ps := &PickSet{
+		StraightUp:      []*bpefs.StraightUpPick{{Row: 1}, {Row: 2}},
+		Superdog:        []*bpefs.SuperDogPick{{Row: 6}},
+		Fallbacks:       map[int]string{1: "heuristic", 2: "heuristic"},
+		Reconciliations: []Reconciliation{{Row: 1, Kind: ReconcileHomeAway, Policy: TrustSlate}, {Row: 2, Kind: ReconcileNeutralSite, Policy: TrustSlate}},
+	}
+	tests := []struct {
+		name      string
+		ps        *PickSet
+		err       error
+		wantRuns  map[string]string
+		wantGames float64
+	}{
+		{"completed", ps, nil, map[string]string{"outcome": RunCompleted}, 2},
+		{"failed", nil, newError(KindNotFound, "no slate"), map[string]string{"outcome": RunFailed, "error_kind": KindNotFound.String()}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &recordingExporter{}
+			setExporter(t, e)
+			ctx := withTelemetry(context.Background(), "trace")
+			ctx, root := startSpan(ctx, "run")
+			exportTelemetry(ctx, root, tt.ps, tt.err)
+
+			if len(e.spans) != 1 || e.spans[0].Name != "run" || (e.spans[0].Status == "ok") != (tt.err == nil) {
+				t.Errorf("expected the ended run span, got %+v", e.spans)
+			}
+			if m := findMetric(e.metrics, MetricRuns, tt.wantRuns); m == nil || m.Value != 1 {
+				t.Errorf("expected one run %v, got %+v", tt.wantRuns, e.metrics)
+			}
+			if m := findMetric(e.metrics, MetricRunDuration, map[string]string{"outcome": tt.wantRuns["outcome"]}); m == nil || m.Kind != MetricHistogram {
+				t.Errorf("expected the run duration, got %+v", e.metrics)
+			}
+			m := findMetric(e.metrics, MetricGames, map[string]string{"game_type": "StraightUp"})
+			if tt.wantGames == 0 {
+				if m != nil {
+					t.Errorf("expected no games counted, got %+v", m)
+				}
+				return
+			}
+			if m == nil || m.Value != tt.wantGames {
+				t.Errorf("expected %g straight-up games, got %+v", tt.wantGames, m)
+			}
+			if m := findMetric(e.metrics, MetricFallbacks, map[string]string{"source": "heuristic"}); m == nil || m.Value != 2 {
+				t.Errorf("expected 2 heuristic fallbacks, got %+v", m)
+			}
+			if m := findMetric(e.metrics, MetricSwaps, map[string]string{"policy": TrustSlate}); m == nil || m.Value != 1 {
+				t.Errorf("expected 1 swap, got %+v", m)
+			}
+		})
+	}
+
+	// Failing to export is not an error, and nothing is exported without telemetry.
+	e := &recordingExporter{err: errors.New("disk full")}
+	setExporter(t, e)
+	exportTelemetry(context.Background(), nil, ps, nil)
+	if len(e.spans) != 0 || len(e.metrics) != 0 {
+		t.Errorf("expected nothing exported without telemetry, got %+v %+v", e.spans, e.metrics)
+	}
+	ctx := withTelemetry(context.Background(), "trace")
+	exportTelemetry(ctx, nil, ps, nil)
+}
+
+func TestFileExporter(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "telemetry.jsonl")
+	t.Setenv("TELEMETRY_FILE", name)
+	e := exporterFromEnv()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("expected the file not opened until export, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := e.Export(context.Background(), []Span{{Name: "run"}}, []Metric{{Name: MetricRuns, Value: 1}}); err != nil {
+			t.Fatalf("Export: %v", err)
+		}
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var spans, metrics int
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var line telemetryLine
+		if err := json.Unmarshal(s.Bytes(), &line); err != nil {
+			t.Fatalf("expected a JSON line, got %q", s.Text())
+		}
+		if line.Span != nil {
+			spans++
+		}
+		if line.Metric != nil {
+			metrics++
+		}
+	}
+	if spans != 2 || metrics != 2 {
+		t.Errorf("expected both exports appended, got %d spans and %d metrics", spans, metrics)
+	}
+
+	bad := NewFileExporter(filepath.Join(t.TempDir(), "missing", "telemetry.jsonl"))
+	if err := bad.Export(context.Background(), nil, nil); err == nil {
+		t.Errorf("expected an error exporting to a missing directory")
+	}
+}
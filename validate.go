@@ -0,0 +1,246 @@
+package pickem4me
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+// Validation finding severities.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// maxRank is the largest sensible rank for a team in a slate.
+const maxRank = 25
+
+// ValidationFinding is a problem found with a slate.
+type ValidationFinding struct {
+	// Severity is either "error" or "warning".
+	Severity string `json:"severity"`
+
+	// Row is the slate row of the game with the problem (zero if the problem is with the slate as a whole).
+	Row int `json:"row"`
+
+	// Message describes the problem.
+	Message string `json:"message"`
+}
+
+// ValidationReport is the result of validating a slate.
+type ValidationReport struct {
+	// Slate is the path to the slate that was validated.
+	Slate string `json:"slate"`
+
+	// Models are the names of the candidate models the slate was validated against, keyed by game type.
+	Models map[string]string `json:"models"`
+
+	// Findings are the problems found with the slate, ordered by row.
+	Findings []ValidationFinding `json:"findings"`
+}
+
+// Errors returns the number of findings with error severity.
+func (r *ValidationReport) Errors() int {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+// Write writes the report in human-readable form.
+func (r *ValidationReport) Write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Slate %s\n", r.Slate); err != nil {
+		return err
+	}
+	for _, gameType := range []string{"StraightUp", "NoisySpread", "Superdog"} {
+		if _, err := fmt.Fprintf(w, "  %s model: %s\n", gameType, r.Models[gameType]); err != nil {
+			return err
+		}
+	}
+	for _, f := range r.Findings {
+		where := "slate"
+		if f.Row > 0 {
+			where = fmt.Sprintf("row %d", f.Row)
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s: %s\n", f.Severity, where, f.Message); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d error(s), %d warning(s)\n", r.Errors(), len(r.Findings)-r.Errors())
+	return err
+}
+
+func (r *ValidationReport) add(severity string, row int, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, ValidationFinding{Severity: severity, Row: row, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateSlate checks that a slate can be picked with the candidate models.
+// Model paths are interpreted as they are by GetModels.
+// An error is returned only if the slate or models cannot be loaded: problems with the slate itself are reported as findings.
+func ValidateSlate(ctx context.Context, slatePath, suPath, nsPath, sdPath string) (*ValidationReport, error) {
+	if err := connected(); err != nil {
+		return nil, err
+	}
+	for _, p := range []string{slatePath, suPath, nsPath, sdPath} {
+		if p != "" && !validDocPath(p) {
+			return nil, newError(KindInvalidInput, "'%s' is not a document path", p)
+		}
+	}
+
+	var (
+		ls            *loadedSlate
+		teams         *TeamResolver
+		modelPerfDocs map[string]*firestore.DocumentSnapshot
+	)
+	g := newGroup(ctx, maxConcurrentReads)
+	g.Go(func(ctx context.Context) (err error) {
+		ls, err = loadSlate(ctx, slatePath)
+		return
+	})
+	g.Go(func(ctx context.Context) (err error) {
+		teams, err = LoadTeamResolver(ctx)
+		return
+	})
+	g.Go(func(ctx context.Context) (err error) {
+		modelPerfDocs, err = GetModels(ctx, suPath, nsPath, sdPath)
+		return
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	models, err := loadModels(ctx, modelPerfDocs, teams)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ValidationReport{
+		Slate:  slatePath,
+		Models: make(map[string]string),
+	}
+	for gameType, model := range models {
+		r.Models[gameType] = model.Performance.System
+	}
+	validateGames(r, ls.games, models, teams)
+
+	sort.SliceStable(r.Findings, func(i, j int) bool { return r.Findings[i].Row < r.Findings[j].Row })
+	return r, nil
+}
+
+// validateGames adds findings about the games in a slate to the report.
+// Teams are matched to their canonical teams before the games are checked.
+func validateGames(r *ValidationReport, games []bpefs.Game, models map[string]*Model, teams *TeamResolver) {
+	if len(games) == 0 {
+		r.add(SeverityError, 0, "slate has no games")
+		return
+	}
+
+	// Rows
+	seen := make(map[int]bool)
+	var pickRows, dogRows []int
+	for _, game := range games {
+		if game.Row <= 0 {
+			r.add(SeverityError, game.Row, "row %d is not a valid slate row", game.Row)
+		}
+		if seen[game.Row] {
+			r.add(SeverityError, game.Row, "more than one game in row %d", game.Row)
+		}
+		seen[game.Row] = true
+		if game.Superdog {
+			dogRows = append(dogRows, game.Row)
+		} else {
+			pickRows = append(pickRows, game.Row)
+		}
+	}
+	// The streak pick goes between the picks and the superdogs, so only gaps within each block are suspicious.
+	reportGaps(r, pickRows)
+	reportGaps(r, dogRows)
+	if len(pickRows) > 0 && len(dogRows) > 0 && dogRows[0] < pickRows[len(pickRows)-1] {
+		r.add(SeverityWarning, dogRows[0], "superdog game comes before the last straight-up or noisy spread game")
+	}
+
+	// Superdogs
+	if len(dogRows) == 0 {
+		r.add(SeverityError, 0, "slate has no superdog games")
+	}
+
+	for _, game := range games {
+		if game.HomeTeam == nil || game.AwayTeam == nil {
+			r.add(SeverityError, game.Row, "game is missing a home or road team")
+			continue
+		}
+
+		// Teams
+		for _, ref := range []*firestore.DocumentRef{game.HomeTeam, game.AwayTeam} {
+			if _, ok := teams.ResolveName(ref.ID); !ok {
+				r.add(SeverityWarning, game.Row, "team '%s' does not match any known team", ref.ID)
+			}
+		}
+		teams.resolveGame(&game)
+		if game.Superdog {
+			if game.NoisySpread != 0 {
+				r.add(SeverityError, game.Row, "superdog game has a noisy spread of %d", game.NoisySpread)
+			}
+			if game.Underdog == nil || game.Overdog == nil {
+				r.add(SeverityError, game.Row, "superdog game is missing an underdog or overdog")
+			}
+			if game.Value <= 0 {
+				r.add(SeverityError, game.Row, "superdog game has non-positive value %d", game.Value)
+			}
+		}
+
+		// Ranks
+		for _, rank := range []int{game.HomeRank, game.AwayRank} {
+			if rank < 0 || rank > maxRank {
+				r.add(SeverityError, game.Row, "rank %d is not between 0 and %d", rank, maxRank)
+			}
+		}
+		if game.HomeRank > 0 && game.HomeRank == game.AwayRank {
+			r.add(SeverityWarning, game.Row, "both teams are ranked #%d", game.HomeRank)
+		}
+
+		// Predictions
+		gameType := gameTypeOf(game)
+		for _, mt := range []string{"StraightUp", "NoisySpread", "Superdog"} {
+			model, ok := models[mt]
+			if !ok {
+				continue
+			}
+			pred, _, swap, err := model.Lookup(game.HomeTeam, game.AwayTeam)
+			if err != nil {
+				severity := SeverityWarning
+				if mt == gameType {
+					severity = SeverityError
+				}
+				r.add(severity, game.Row, "%s model '%s' has no prediction: %v", mt, model.Performance.System, err)
+				continue
+			}
+			if mt != gameType {
+				continue
+			}
+			if swap {
+				r.add(SeverityWarning, game.Row, "home and road teams are reversed relative to model '%s'", model.Performance.System)
+			}
+			if pred.NeutralSite != game.NeutralSite {
+				r.add(SeverityWarning, game.Row, "slate says neutral site is %t, but model '%s' says %t", game.NeutralSite, model.Performance.System, pred.NeutralSite)
+			}
+		}
+	}
+}
+
+// reportGaps adds a warning for every gap in a sorted list of rows.
+func reportGaps(r *ValidationReport, rows []int) {
+	sort.Ints(rows)
+	for i := 1; i < len(rows); i++ {
+		if rows[i]-rows[i-1] > 1 {
+			r.add(SeverityWarning, rows[i], "rows %d through %d are missing", rows[i-1]+1, rows[i]-1)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package pickem4me
+
+import (
+	"strings"
+	"testing"
+
+	bpefs "github.com/reallyasi9/b1gpickem/firestore"
+)
+
+func TestValidateGames(t *testing.T) {
+	teams := NewTeamResolver()
+	for _, id := range []string{"iowa", "purdue", "illinois", "maryland", "wisconsin"} {
+		teams.AddTeam(teamRef(id), bpefs.Team{School: id})
+	}
+	straight := bpefs.Game{Row: 1, HomeTeam: teamRef("iowa"), AwayTeam: teamRef("purdue")}
+	dog := bpefs.Game{Row: 2, HomeTeam: teamRef("maryland"), AwayTeam: teamRef("illinois"), Superdog: true, Underdog: teamRef("illinois"), Overdog: teamRef("maryland"), Value: 10}
+	models := func(su, sd *Model) map[string]*Model {
+		return map[string]*Model{"StraightUp": su, "Superdog": sd}
+	}
+	full := models(testModel("line", "iowa-purdue", "maryland-illinois"), testModel("sagarin", "iowa-purdue", "maryland-illinois"))
+
+	type finding struct {
+		severity string
+		row      int
+		message  string
+	}
+	tests := []struct {
+		name   string
+		games  []bpefs.Game
+		models map[string]*Model
+		want   []finding
+	}{
+		{"valid", []bpefs.Game{straight, dog}, full, nil},
+		{"unknown team", []bpefs.Game{{Row: 1, HomeTeam: teamRef("iowa"), AwayTeam: teamRef("hawaii")}, dog}, full, []finding{
+			{SeverityWarning, 1, "team 'hawaii' does not match any known team"},
+			{SeverityError, 1, "StraightUp model 'line' has no prediction"},
+			{SeverityWarning, 1, "Superdog model 'sagarin' has no prediction"},
+		}},
+		{"missing prediction for the game type", []bpefs.Game{straight, dog}, models(testModel("line", "maryland-illinois"), testModel("sagarin", "iowa-purdue", "maryland-illinois")), []finding{
+			{SeverityError, 1, "StraightUp model 'line' has no prediction"},
+		}},
+		{"missing prediction for another game type", []bpefs.Game{straight, dog}, models(testModel("line", "iowa-purdue", "maryland-illinois"), testModel("sagarin", "maryland-illinois")), []finding{
+			{SeverityWarning, 1, "Superdog model 'sagarin' has no prediction"},
+		}},
+		{"ambiguous matchup", []bpefs.Game{straight, dog}, models(testModel("line", "iowa-purdue", "purdue-iowa", "maryland-illinois"), testModel("sagarin", "iowa-purdue", "maryland-illinois")), []finding{
+			{SeverityError, 1, "play each other in 2 predicted games"},
+		}},
+		{"reversed teams", []bpefs.Game{{Row: 1, HomeTeam: teamRef("purdue"), AwayTeam: teamRef("iowa")}, dog}, full, []finding{
+			{SeverityWarning, 1, "home and road teams are reversed relative to model 'line'"},
+		}},
+		{"no models", []bpefs.Game{straight, dog}, nil, nil},
+		{"no games", nil, full, []finding{{SeverityError, 0, "slate has no games"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ValidationReport{}
+			validateGames(r, tt.games, tt.models, teams)
+			if len(r.Findings) != len(tt.want) {
+				t.Fatalf("expected %d findings, got %+v", len(tt.want), r.Findings)
+			}
+			for i, want := range tt.want {
+				got := r.Findings[i]
+				if got.Severity != want.severity || got.Row != want.row || !strings.Contains(got.Message, want.message) {
+					t.Errorf("expected %s in row %d containing %q, got %+v", want.severity, want.row, want.message, got)
+				}
+			}
+		})
+	}
+}